@@ -1,19 +1,54 @@
 package access_token
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/lock"
+	"github.com/38888/douyin-openapi/metrics"
 	"github.com/38888/douyin-openapi/util"
 	"sync"
 	"time"
 )
 
-// 正式地址
-const accessTokenURL = "https://developer.toutiao.com/api/apps/v2/token"
+// Endpoint 获取 access_token 的接口名称
+const Endpoint = "accessToken"
 
-// 沙盒地址
-const sandBoxTokenURL = "https://open-sandbox.douyin.com/api/apps/v2/token"
+// 获取token的接口地址, 域名由 Environment 决定
+const accessTokenPath = "/api/apps/v2/token"
+
+// expiresReserve 缓存 token 时在有效期基础上预留的秒数
+const expiresReserve = 1500
+
+// defaultExpiresIn 无法得知 token 有效期时按该秒数估算, 与平台返回的 expires_in 一致
+const defaultExpiresIn = 7200
+
+// defaultLockTTL 分布式锁默认的最长持有时间
+const defaultLockTTL = 30 * time.Second
+
+// lockPollInterval 其他实例持有锁时重新读取缓存的间隔
+const lockPollInterval = 100 * time.Millisecond
+
+// tokenSource token 的获取方式, 小程序 access_token 与开放平台 client_token 共用缓存/加锁/刷新逻辑
+type tokenSource struct {
+	endpoint string      // 接口名称, 用于重试/监控
+	family   util.Family // 接口分组, 决定使用的域名
+	path     string      // 接口地址
+	reserve  int         // 缓存时在有效期基础上预留的秒数
+	// get 从服务器获取 token
+	get func(ctx context.Context, client *util.Client, apiUrl, id, secret string) (ResAccessToken, error)
+}
+
+// appTokenSource 小程序 access_token
+var appTokenSource = tokenSource{
+	endpoint: Endpoint,
+	family:   util.FamilyMiniApp,
+	path:     accessTokenPath,
+	reserve:  expiresReserve,
+	get:      GetTokenFromServerContext,
+}
 
 // AccessToken 管理AccessToken 的基础接口
 type AccessToken interface {
@@ -22,15 +57,65 @@ type AccessToken interface {
 	GetAccessToken() (string, error) // 获取token
 }
 
+// ContextAccessToken 支持 context 的 AccessToken, 请求取消时可以中断 token 的获取
+type ContextAccessToken interface {
+	AccessToken
+	GetAccessTokenContext(ctx context.Context) (string, error) // 获取token
+}
+
+// GetAccessTokenContext 获取token, token 管理类实现了 ContextAccessToken 时透传 context
+func GetAccessTokenContext(ctx context.Context, token AccessToken) (string, error) {
+	if ct, ok := token.(ContextAccessToken); ok {
+		return ct.GetAccessTokenContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return token.GetAccessToken()
+}
+
+// Invalidator 支持作废 token 的 AccessToken, 平台提前判定 token 无效(撤销/密钥轮换)时使用
+type Invalidator interface {
+	AccessToken
+	InvalidateContext(ctx context.Context, token string) error // 缓存中的 token 仍为 token 时删除缓存
+}
+
+// Invalidate 作废被平台拒绝的 token, 下次获取时重新从服务器获取
+// token 管理类实现了 Invalidator 时调用其实现, 否则在 c 中缓存的值仍为 rejected 时删除 GetCacheKey
+func Invalidate(ctx context.Context, token AccessToken, c cache.Cache, rejected string) error {
+	if invalidator, ok := token.(Invalidator); ok {
+		return invalidator.InvalidateContext(ctx, rejected)
+	}
+	if c == nil {
+		return nil
+	}
+	if val, _ := cache.GetContext(ctx, c, token.GetCacheKey()).(string); val != rejected {
+		return nil
+	}
+	return cache.DeleteContext(ctx, c, token.GetCacheKey())
+}
+
 // DefaultAccessToken 默认的token管理类
 type DefaultAccessToken struct {
-	AppId               string      // app_id	string	是	小程序的 app_id
-	AppSecret           string      // app_secret	string	是	小程序的密钥
-	GrantType           string      // grant_type	string	是	固定值“client_credentials”
-	Cache               cache.Cache // 缓存组件
-	accessTokenLock     *sync.Mutex // 读写锁
-	accessTokenCacheKey string      // 缓存的key
-	SandBox             bool        // 是否沙盒地址 默认 false 线上地址
+	AppId               string            // app_id	string	是	小程序的 app_id
+	AppSecret           string            // app_secret	string	是	小程序的密钥
+	GrantType           string            // grant_type	string	是	固定值“client_credentials”
+	Cache               cache.Cache       // 缓存组件
+	accessTokenLock     chan struct{}     // 获取token的锁, 使用 channel 以便等待时可以被 context 取消
+	accessTokenCacheKey string            // 缓存的key
+	SandBox             bool              // 是否沙盒地址 默认 false 线上地址
+	Environment         util.Environment  // 接口环境, 可指向代理或本地 mock, 为空时根据 SandBox 选择
+	HttpClient          *util.Client      // http 请求执行器, 为空时使用默认执行器
+	RetryPolicy         *util.RetryPolicy // 获取token失败时的重试策略, 为空时不重试
+	Metrics             metrics.Metrics   // 监控指标收集, 为空时不记录
+	Locker              lock.Locker       // 多实例共享缓存时获取 token 使用的锁, 为空时只在本实例内加锁
+	LockTTL             time.Duration     // 锁的最长持有时间, 需大于获取 token(含重试)的耗时, 默认 30s
+	RefreshHooks                          // 刷新 token 的回调, 可用于刷新失败告警
+	stateLock           sync.Mutex        // 保护 token/issuedAt/expiresAt
+	token               string            // 本实例最近一次获取的 token
+	issuedAt            time.Time         // 本实例最近一次从服务器获取 token 的时间
+	expiresAt           time.Time         // 本实例最近一次获取的 token 的过期时间
+	source              *tokenSource      // token 的获取方式, 为空时为小程序 access_token
 }
 
 // NewDefaultAccessToken 实例化默认的token管理类
@@ -44,8 +129,10 @@ func NewDefaultAccessToken(appId, appSecret string, cache cache.Cache, IsSandbox
 		GrantType:           "client_credential",
 		Cache:               cache,
 		accessTokenCacheKey: fmt.Sprintf("douyin_openapi_access_token_%s", appId),
-		accessTokenLock:     new(sync.Mutex),
+		accessTokenLock:     make(chan struct{}, 1),
 		SandBox:             IsSandbox,
+		RetryPolicy:         util.DefaultRetryPolicy(),
+		Environment:         util.GetEnvironment(IsSandbox),
 	}
 	return token
 }
@@ -60,38 +147,243 @@ func (dd *DefaultAccessToken) SetCacheKey(key string) {
 	dd.accessTokenCacheKey = key
 }
 
+// tokenSource 获取 token 的方式
+func (dd *DefaultAccessToken) tokenSource() *tokenSource {
+	if dd.source == nil {
+		return &appTokenSource
+	}
+	return dd.source
+}
+
+// GetEnvironment 获取接口环境, 未设置时根据 SandBox 选择
+func (dd *DefaultAccessToken) GetEnvironment() util.Environment {
+	if dd.Environment.BaseUrls == nil {
+		return util.GetEnvironment(dd.SandBox)
+	}
+	return dd.Environment
+}
+
 // GetAccessToken 获取token
 func (dd *DefaultAccessToken) GetAccessToken() (string, error) {
+	return dd.GetAccessTokenContext(context.Background())
+}
+
+// GetAccessTokenContext 获取token, 支持传入 context
+func (dd *DefaultAccessToken) GetAccessTokenContext(ctx context.Context) (string, error) {
 	// 先尝试从缓存中获取如果不存在就调用接口获取
-	if val := dd.Cache.Get(dd.GetCacheKey()); val != nil {
+	val := cache.GetContext(ctx, dd.Cache, dd.GetCacheKey())
+	if dd.Metrics != nil {
+		dd.Metrics.ObserveCache(dd.tokenSource().endpoint, val != nil)
+	}
+	if val != nil {
 		return val.(string), nil
 	}
 
 	// 加锁防止并发获取接口
-	dd.accessTokenLock.Lock()
-	defer dd.accessTokenLock.Unlock()
+	select {
+	case dd.accessTokenLock <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-dd.accessTokenLock }()
 
 	// 双捡防止重复获取
-	if val := dd.Cache.Get(dd.GetCacheKey()); val != nil {
+	if val := cache.GetContext(ctx, dd.Cache, dd.GetCacheKey()); val != nil {
 		return val.(string), nil
 	}
+	return dd.fetch(ctx, "")
+}
 
-	// 开始调用接口获取token
-	api := accessTokenURL
-	if dd.SandBox {
-		api = sandBoxTokenURL
+// refreshLocked 加锁后从服务器获取新的 token, 获取期间其他调用方仍然可以从缓存读取旧的 token
+func (dd *DefaultAccessToken) refreshLocked(ctx context.Context) (string, error) {
+	select {
+	case dd.accessTokenLock <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-dd.accessTokenLock }()
+	// 本实例最近一次获取或采用的 token 视为需要替换的旧 token, 缓存中已经是其他实例获取的新 token 时直接使用
+	stale := dd.lastToken()
+	if token, ok := dd.reread(ctx, stale); ok {
+		return token, nil
 	}
-	reqAccessToken, err := GetTokenFromServer(api, dd.AppId, dd.AppSecret)
+	return dd.fetch(ctx, stale)
+}
+
+// GetTokenInfo 获取token及其有效期
+func (dd *DefaultAccessToken) GetTokenInfo() (TokenInfo, error) {
+	return dd.GetTokenInfoContext(context.Background())
+}
+
+// GetTokenInfoContext 获取token及其有效期, 支持传入 context
+// 缓存中的 token 不是本实例获取的(如其他实例写入或本实例重启)时, 有效期未知
+func (dd *DefaultAccessToken) GetTokenInfoContext(ctx context.Context) (TokenInfo, error) {
+	token, err := dd.GetAccessTokenContext(ctx)
 	if err != nil {
-		return "", err
+		return TokenInfo{}, err
+	}
+	return dd.tokenInfo(token), nil
+}
+
+// ForceRefresh 不论缓存中的 token 是否过期, 立即从服务器获取新的 token
+func (dd *DefaultAccessToken) ForceRefresh() (TokenInfo, error) {
+	return dd.ForceRefreshContext(context.Background())
+}
+
+// ForceRefreshContext 立即从服务器获取新的 token, 支持传入 context
+// 设置了 Locker 时, 其他实例已经替换了本实例最近一次获取的 token 则直接使用
+func (dd *DefaultAccessToken) ForceRefreshContext(ctx context.Context) (TokenInfo, error) {
+	select {
+	case dd.accessTokenLock <- struct{}{}:
+	case <-ctx.Done():
+		return TokenInfo{}, ctx.Err()
+	}
+	defer func() { <-dd.accessTokenLock }()
+	// 本实例还没有获取过 token 时, 替换缓存中的 token
+	stale := dd.lastToken()
+	if stale == "" {
+		stale, _ = cache.GetContext(ctx, dd.Cache, dd.GetCacheKey()).(string)
 	}
-	// 设置缓存
-	expires := reqAccessToken.Data.ExpiresIn - 1500
-	err = dd.Cache.Set(dd.GetCacheKey(), reqAccessToken.Data.AccessToken, time.Duration(expires)*time.Second)
+	token, err := dd.fetch(ctx, stale)
 	if err != nil {
-		return "", err
+		return TokenInfo{}, err
+	}
+	return dd.tokenInfo(token), nil
+}
+
+// tokenInfo token 为本实例最近一次获取的 token 时带上有效期
+func (dd *DefaultAccessToken) tokenInfo(token string) TokenInfo {
+	dd.stateLock.Lock()
+	defer dd.stateLock.Unlock()
+	if token != dd.token {
+		return TokenInfo{AccessToken: token}
+	}
+	return TokenInfo{AccessToken: token, IssuedAt: dd.issuedAt, ExpiresAt: dd.expiresAt}
+}
+
+// InvalidateContext 缓存中的 token 仍为 token 时删除缓存, 已被其他调用方替换为新的 token 时不做任何事
+func (dd *DefaultAccessToken) InvalidateContext(ctx context.Context, token string) error {
+	select {
+	case dd.accessTokenLock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-dd.accessTokenLock }()
+	if val, _ := cache.GetContext(ctx, dd.Cache, dd.GetCacheKey()).(string); val != token {
+		return nil
+	}
+	return cache.DeleteContext(ctx, dd.Cache, dd.GetCacheKey())
+}
+
+// lockKey 分布式锁的 key
+func (dd *DefaultAccessToken) lockKey() string {
+	return dd.GetCacheKey() + "_lock"
+}
+
+// fetch 获取新的 token, 调用方需持有 accessTokenLock
+// 设置了 Locker 时先获取锁, 锁被其他实例持有时等待并重新读取缓存, 读到与 stale 不同的 token 时直接使用
+func (dd *DefaultAccessToken) fetch(ctx context.Context, stale string) (string, error) {
+	if dd.Locker == nil {
+		return dd.refresh(ctx)
+	}
+	ttl := dd.LockTTL
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	for {
+		unlock, err := dd.Locker.TryLock(ctx, dd.lockKey(), ttl)
+		if err == nil {
+			defer func() { _ = unlock() }()
+			// 获取锁后再次检查, 其他实例可能刚刚写入了新的 token
+			if token, ok := dd.reread(ctx, stale); ok {
+				return token, nil
+			}
+			return dd.refresh(ctx)
+		}
+		if !errors.Is(err, lock.ErrLocked) {
+			return "", err
+		}
+		timer := time.NewTimer(lockPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+		if token, ok := dd.reread(ctx, stale); ok {
+			return token, nil
+		}
+	}
+}
+
+// reread 重新读取缓存, 读到与 stale 不同的 token 时采用其他实例获取的 token
+// 缓存不提供剩余有效期, 按本实例上一次的有效期(未获取过时按 2 小时)估算
+func (dd *DefaultAccessToken) reread(ctx context.Context, stale string) (string, bool) {
+	token, _ := cache.GetContext(ctx, dd.Cache, dd.GetCacheKey()).(string)
+	if token == "" || token == stale {
+		return "", false
+	}
+	now := time.Now()
+	dd.stateLock.Lock()
+	lifetime := dd.expiresAt.Sub(dd.issuedAt)
+	if dd.issuedAt.IsZero() {
+		lifetime = defaultExpiresIn * time.Second
 	}
-	return reqAccessToken.Data.AccessToken, nil
+	dd.token = token
+	dd.issuedAt = now
+	dd.expiresAt = now.Add(lifetime)
+	dd.stateLock.Unlock()
+	return token, true
+}
+
+// refresh 调用接口获取token并写入缓存, 调用方需持有 accessTokenLock
+func (dd *DefaultAccessToken) refresh(ctx context.Context) (string, error) {
+	source := dd.tokenSource()
+	api := dd.GetEnvironment().Url(source.family, source.path)
+	var reqAccessToken ResAccessToken
+	start := time.Now()
+	err := dd.RetryPolicy.Do(ctx, source.endpoint, func(ctx context.Context) (err error) {
+		reqAccessToken, err = source.get(ctx, dd.HttpClient, api, dd.AppId, dd.AppSecret)
+		return err
+	})
+	latency := time.Since(start)
+	if dd.Metrics != nil {
+		dd.Metrics.ObserveTokenRefresh(dd.AppId, latency, err)
+	}
+	event := RefreshEvent{Endpoint: source.endpoint, AppId: dd.AppId, Latency: latency, Err: err}
+	if err == nil {
+		// 设置缓存
+		expires := reqAccessToken.Data.ExpiresIn - source.reserve
+		event.Err = cache.SetContext(ctx, dd.Cache, dd.GetCacheKey(), reqAccessToken.Data.AccessToken, time.Duration(expires)*time.Second)
+	}
+	if event.Err == nil {
+		event.Token = TokenInfo{
+			AccessToken: reqAccessToken.Data.AccessToken,
+			IssuedAt:    start,
+			ExpiresAt:   start.Add(time.Duration(reqAccessToken.Data.ExpiresIn) * time.Second),
+		}
+		dd.stateLock.Lock()
+		dd.token = event.Token.AccessToken
+		dd.issuedAt = event.Token.IssuedAt
+		dd.expiresAt = event.Token.ExpiresAt
+		dd.stateLock.Unlock()
+	}
+	dd.Emit(event)
+	return event.Token.AccessToken, event.Err
+}
+
+// lastToken 本实例最近一次获取或采用的 token, 未获取过时为空
+func (dd *DefaultAccessToken) lastToken() string {
+	dd.stateLock.Lock()
+	defer dd.stateLock.Unlock()
+	return dd.token
+}
+
+// lifetime 本实例最近一次获取的 token 的获取时间及过期时间, 未获取过时为零值
+func (dd *DefaultAccessToken) lifetime() (issuedAt, expiresAt time.Time) {
+	dd.stateLock.Lock()
+	defer dd.stateLock.Unlock()
+	return dd.issuedAt, dd.expiresAt
 }
 
 // ResAccessToken 获取token的返回结构体
@@ -107,22 +399,27 @@ type ResAccessTokenData struct {
 }
 
 // GetTokenFromServer 从抖音服务器获取token
-func GetTokenFromServer(apiUrl string, appId, appSecret string) (resAccessToken ResAccessToken, err error) {
+func GetTokenFromServer(apiUrl string, appId, appSecret string) (ResAccessToken, error) {
+	return GetTokenFromServerContext(context.Background(), nil, apiUrl, appId, appSecret)
+}
+
+// GetTokenFromServerContext 从抖音服务器获取token, 支持传入 context 及自定义请求执行器
+func GetTokenFromServerContext(ctx context.Context, client *util.Client, apiUrl string, appId, appSecret string) (resAccessToken ResAccessToken, err error) {
 	params := map[string]interface{}{
 		"appid":      appId,
 		"secret":     appSecret,
 		"grant_type": "client_credential",
 	}
-	body, err := util.PostJSON(apiUrl, params)
+	res, err := client.Execute(ctx, &util.Call{Endpoint: Endpoint, URL: apiUrl, JSON: params})
 	if err != nil {
+		err = util.WrapError(Endpoint, err)
 		return
 	}
-	err = json.Unmarshal(body, &resAccessToken)
-	if err != nil {
+	if err = util.CheckResponse(Endpoint, res); err != nil {
 		return
 	}
-	if resAccessToken.ErrNo != 0 {
-		err = fmt.Errorf("get access_token error : errcode=%v , errormsg=%v", resAccessToken.ErrTips, resAccessToken.ErrNo)
+	if err = json.Unmarshal(res.Body, &resAccessToken); err != nil {
+		err = &util.APIError{Endpoint: Endpoint, StatusCode: res.StatusCode, Err: err}
 		return
 	}
 	return
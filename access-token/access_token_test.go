@@ -0,0 +1,121 @@
+package access_token
+
+import (
+	"context"
+	"fmt"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/lock"
+	"github.com/38888/douyin-openapi/util"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripFunc 使用函数模拟 http 请求
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// newTestClient 每次请求返回 handler 的结果
+func newTestClient(handler func(r *http.Request) (int, string)) *util.Client {
+	return util.NewClientWithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		status, body := handler(r)
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: r}, nil
+	}))
+}
+
+// 测试多个实例共享缓存时, 其他实例已经刷新的 token 不会被当作旧 token 再次刷新
+func TestDefaultAccessToken_RefreshAdoptsOtherInstance(t *testing.T) {
+	var requests int32
+	client := newTestClient(func(r *http.Request) (int, string) {
+		return http.StatusOK, fmt.Sprintf(`{"err_no":0,"data":{"access_token":"token_%d","expires_in":7200}}`, atomic.AddInt32(&requests, 1))
+	})
+	shared := cache.NewMemory()
+	locker := lock.NewMemory()
+	newToken := func() *DefaultAccessToken {
+		token := NewDefaultAccessToken("tt_test", "secret", shared, false).(*DefaultAccessToken)
+		token.HttpClient = client
+		token.Locker = locker
+		token.Environment = util.NewEnvironment("test", "http://token.test")
+		return token
+	}
+	a, b := newToken(), newToken()
+	ctx := context.Background()
+
+	steps := []struct {
+		name     string
+		refresh  func(ctx context.Context) (string, error)
+		want     string
+		requests int32
+	}{
+		{"a gets", a.GetAccessTokenContext, "token_1", 1},
+		{"b adopts", b.refreshLocked, "token_1", 1},
+		{"a refreshes", a.refreshLocked, "token_2", 2},
+		{"b adopts a's new token", b.refreshLocked, "token_2", 2},
+		{"b forces", func(ctx context.Context) (string, error) {
+			info, err := b.ForceRefreshContext(ctx)
+			return info.AccessToken, err
+		}, "token_3", 3},
+		{"a adopts forced token", func(ctx context.Context) (string, error) {
+			info, err := a.ForceRefreshContext(ctx)
+			return info.AccessToken, err
+		}, "token_3", 3},
+	}
+	for _, step := range steps {
+		token, err := step.refresh(ctx)
+		if err != nil || token != step.want || atomic.LoadInt32(&requests) != step.requests {
+			t.Fatalf("%s: got %s, %v after %d requests, want %s after %d", step.name, token, err, requests, step.want, step.requests)
+		}
+	}
+}
+
+// 测试多个实例共享缓存时通过锁只获取一次 token
+func TestDefaultAccessToken_Locker(t *testing.T) {
+	lockers := map[string]lock.Locker{
+		"memory": lock.NewMemory(),
+		"file":   lock.NewFile(t.TempDir()),
+	}
+	for name, locker := range lockers {
+		t.Run(name, func(t *testing.T) {
+			var requests int32
+			client := newTestClient(func(r *http.Request) (int, string) {
+				n := atomic.AddInt32(&requests, 1)
+				time.Sleep(50 * time.Millisecond)
+				return http.StatusOK, fmt.Sprintf(`{"err_no":0,"data":{"access_token":"token_%d","expires_in":7200}}`, n)
+			})
+			shared := cache.NewMemory()
+			instances := make([]*DefaultAccessToken, 2)
+			for i := range instances {
+				instances[i] = NewDefaultAccessToken("tt_test", "secret", shared, false).(*DefaultAccessToken)
+				instances[i].HttpClient = client
+				instances[i].Locker = locker
+				instances[i].Environment = util.NewEnvironment("test", "http://token.test")
+			}
+			var wg sync.WaitGroup
+			tokens := make([]string, 10)
+			errs := make([]error, len(tokens))
+			for i := range tokens {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					tokens[i], errs[i] = instances[i%len(instances)].GetAccessToken()
+				}(i)
+			}
+			wg.Wait()
+			for i := range tokens {
+				if errs[i] != nil || tokens[i] != "token_1" {
+					t.Fatalf("GetAccessToken() = %s, %v", tokens[i], errs[i])
+				}
+			}
+			if requests != 1 {
+				t.Errorf("want 1 token request, got %d", requests)
+			}
+		})
+	}
+}
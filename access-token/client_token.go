@@ -0,0 +1,100 @@
+package access_token
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/util"
+)
+
+// EndpointClientToken 获取 client_token 的接口名称
+const EndpointClientToken = "clientToken"
+
+// 获取 client_token 的接口地址, 域名由 Environment 的开放平台分组决定
+const clientTokenPath = "/oauth/client_token/"
+
+// clientTokenReserve 缓存 client_token 时在有效期基础上预留的秒数
+// 重新获取后旧的 client_token 还有 5 分钟的缓冲时间, 提前 5 分钟刷新即可
+const clientTokenReserve = 300
+
+// clientTokenSource 开放平台 client_token
+var clientTokenSource = tokenSource{
+	endpoint: EndpointClientToken,
+	family:   util.FamilyOpenPlatform,
+	path:     clientTokenPath,
+	reserve:  clientTokenReserve,
+	get:      getClientTokenFromServer,
+}
+
+// ClientToken 抖音开放平台 client_token 管理类, 用于 open.douyin.com 不需要用户授权的服务端接口
+// 缓存/加锁/后台刷新/作废等与 DefaultAccessToken 一致, AppId/AppSecret 为应用的 client_key/client_secret
+type ClientToken struct {
+	*DefaultAccessToken
+}
+
+// NewClientToken 实例化 client_token 管理类
+func NewClientToken(clientKey, clientSecret string, cache cache.Cache, isSandbox bool) *ClientToken {
+	token := NewDefaultAccessToken(clientKey, clientSecret, cache, isSandbox).(*DefaultAccessToken)
+	token.source = &clientTokenSource
+	token.SetCacheKey(fmt.Sprintf("douyin_openapi_client_token_%s", clientKey))
+	return &ClientToken{DefaultAccessToken: token}
+}
+
+// ResClientToken 获取 client_token 的返回结构体
+type ResClientToken struct {
+	Data    ResClientTokenData  `json:"data,omitempty"`
+	Extra   ResClientTokenExtra `json:"extra,omitempty"`
+	Message string              `json:"message,omitempty"`
+}
+
+type ResClientTokenData struct {
+	ErrorCode   int    `json:"error_code,omitempty"`
+	Description string `json:"description,omitempty"`
+	AccessToken string `json:"access_token,omitempty"`
+	ExpiresIn   int    `json:"expires_in,omitempty"`
+}
+
+type ResClientTokenExtra struct {
+	Logid string `json:"logid,omitempty"`
+	Now   int64  `json:"now,omitempty"`
+}
+
+// GetClientTokenFromServer 从抖音开放平台获取 client_token
+func GetClientTokenFromServer(apiUrl string, clientKey, clientSecret string) (ResClientToken, error) {
+	return GetClientTokenFromServerContext(context.Background(), nil, apiUrl, clientKey, clientSecret)
+}
+
+// GetClientTokenFromServerContext 从抖音开放平台获取 client_token, 支持传入 context 及自定义请求执行器
+// data.error_code 非 0 时返回 APIError, log_id 取自 extra.logid
+func GetClientTokenFromServerContext(ctx context.Context, client *util.Client, apiUrl string, clientKey, clientSecret string) (resClientToken ResClientToken, err error) {
+	params := map[string]interface{}{
+		"client_key":    clientKey,
+		"client_secret": clientSecret,
+		"grant_type":    "client_credential",
+	}
+	res, err := client.Execute(ctx, &util.Call{Endpoint: EndpointClientToken, URL: apiUrl, JSON: params})
+	if err != nil {
+		err = util.WrapError(EndpointClientToken, err)
+		return
+	}
+	if err = util.CheckResponse(EndpointClientToken, res); err != nil {
+		return
+	}
+	if err = json.Unmarshal(res.Body, &resClientToken); err != nil {
+		err = &util.APIError{Endpoint: EndpointClientToken, StatusCode: res.StatusCode, Err: err}
+		return
+	}
+	return
+}
+
+// getClientTokenFromServer 获取 client_token 并转换为与小程序 access_token 一致的结构
+func getClientTokenFromServer(ctx context.Context, client *util.Client, apiUrl, clientKey, clientSecret string) (res ResAccessToken, err error) {
+	clientToken, err := GetClientTokenFromServerContext(ctx, client, apiUrl, clientKey, clientSecret)
+	if err != nil {
+		return
+	}
+	res.Data.AccessToken = clientToken.Data.AccessToken
+	res.Data.ExpiresIn = clientToken.Data.ExpiresIn
+	return
+}
@@ -0,0 +1,48 @@
+package access_token
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/util"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+// 测试获取 client_token: 请求参数, 平台错误码转换为 APIError, 缓存及作废后重新获取
+func TestClientToken(t *testing.T) {
+	var requests int32
+	var clientSecret atomic.Value
+	clientSecret.Store("wrong")
+	token := NewClientToken("client_key", "client_secret", cache.NewMemory(), false)
+	token.RetryPolicy = nil
+	token.HttpClient = newTestClient(func(r *http.Request) (int, string) {
+		var params map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&params)
+		if r.URL.Path != clientTokenPath || params["client_key"] != "client_key" || params["client_secret"] != clientSecret.Load() || params["grant_type"] != "client_credential" {
+			return http.StatusOK, `{"data":{"error_code":10002,"description":"参数错误"},"extra":{"logid":"1"}}`
+		}
+		return http.StatusOK, fmt.Sprintf(`{"data":{"error_code":0,"access_token":"clt.%d","expires_in":7200},"message":"success"}`, atomic.AddInt32(&requests, 1))
+	})
+	token.Environment = util.NewEnvironment("test", "http://open.test")
+
+	_, err := token.GetAccessToken()
+	if apiErr, ok := util.AsAPIError(err); !ok || apiErr.Endpoint != EndpointClientToken || apiErr.Code != 10002 || apiErr.LogId != "1" {
+		t.Fatalf("want client token APIError, got %v", err)
+	}
+	clientSecret.Store("client_secret")
+	if accessToken, err := token.GetAccessToken(); err != nil || accessToken != "clt.1" {
+		t.Fatalf("GetAccessToken() = %s, %v", accessToken, err)
+	}
+	if accessToken, _ := token.GetAccessToken(); accessToken != "clt.1" || requests != 1 {
+		t.Fatalf("want cached clt.1, got %s after %d requests", accessToken, requests)
+	}
+	if err = token.InvalidateContext(context.Background(), "clt.1"); err != nil {
+		t.Fatal(err)
+	}
+	if accessToken, _ := token.GetAccessToken(); accessToken != "clt.2" || requests != 2 {
+		t.Errorf("want clt.2 after invalidate, got %s after %d requests", accessToken, requests)
+	}
+}
@@ -0,0 +1,135 @@
+package access_token
+
+import (
+	"context"
+	"github.com/38888/douyin-openapi/util"
+	"sync"
+	"time"
+)
+
+// RefresherConfig 后台刷新 token 的配置
+type RefresherConfig struct {
+	Fraction      float64         // 在 token 有效期的该比例处刷新, 取值 (0, 1), 默认 0.75
+	Jitter        float64         // 刷新时间的随机抖动, 占有效期的比例, 避免多个实例同时刷新, 默认 0.05, 小于 0 时不抖动
+	RetryDelay    time.Duration   // 刷新失败后第一次重试的等待时间, 按指数增长, 默认 1s
+	MaxRetryDelay time.Duration   // 刷新失败后最长的等待时间, 默认 1min
+	OnError       func(err error) // 刷新失败的回调, 为空时忽略
+}
+
+// withDefaults 填充默认值
+func (c RefresherConfig) withDefaults() RefresherConfig {
+	if c.Fraction <= 0 || c.Fraction >= 1 {
+		c.Fraction = 0.75
+	}
+	if c.Jitter < 0 || c.Jitter >= c.Fraction {
+		c.Jitter = 0
+	} else if c.Jitter == 0 {
+		c.Jitter = 0.05
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = time.Second
+	}
+	if c.MaxRetryDelay <= 0 {
+		c.MaxRetryDelay = time.Minute
+	}
+	return c
+}
+
+// latestRefresh 后台刷新最晚的时间: 有效期的 Fraction 处加上最大的抖动
+func (c RefresherConfig) latestRefresh(issuedAt, expiresAt time.Time) time.Time {
+	c = c.withDefaults()
+	return issuedAt.Add(time.Duration(float64(expiresAt.Sub(issuedAt)) * (c.Fraction + c.Jitter)))
+}
+
+// Refresher 后台刷新 token, 在 token 过期前主动获取新的 token 写入缓存
+// 刷新期间其他调用方继续从缓存读取旧的 token, 不会阻塞在获取 token 的锁上
+type Refresher struct {
+	token     *DefaultAccessToken
+	config    RefresherConfig
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// StartRefresher 启动后台刷新, 不再使用时需要调用 Close 停止
+// 本实例还没有获取过 token 时会立即获取一次, 以得到 token 的有效期
+func (dd *DefaultAccessToken) StartRefresher(config RefresherConfig) *Refresher {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Refresher{
+		token:  dd,
+		config: config.withDefaults(),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go r.run(ctx)
+	return r
+}
+
+// Close 停止后台刷新并等待刷新协程退出, 可以重复调用
+func (r *Refresher) Close() error {
+	r.closeOnce.Do(r.cancel)
+	<-r.done
+	return nil
+}
+
+// run 刷新循环
+func (r *Refresher) run(ctx context.Context) {
+	defer close(r.done)
+	delay := r.nextDelay(time.Now())
+	failures := 0
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if _, err := r.token.refreshLocked(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if r.config.OnError != nil {
+				r.config.OnError(err)
+			}
+			failures++
+			delay = r.retryDelay(failures)
+			continue
+		}
+		failures = 0
+		delay = r.nextDelay(time.Now())
+	}
+}
+
+// nextDelay 距离下一次刷新的时间: 有效期的 Fraction 处加减随机抖动, 未获取过 token 时立即刷新
+func (r *Refresher) nextDelay(now time.Time) time.Duration {
+	issuedAt, expiresAt := r.token.lifetime()
+	if issuedAt.IsZero() {
+		return 0
+	}
+	lifetime := expiresAt.Sub(issuedAt)
+	at := issuedAt.Add(time.Duration(float64(lifetime) * r.config.Fraction))
+	if spread := time.Duration(float64(lifetime) * r.config.Jitter); spread > 0 {
+		at = at.Add(util.Jitter(2*spread) - spread)
+	}
+	// 不晚于缓存过期, 否则调用方会在缓存失效后同步获取
+	if cacheExpiry := expiresAt.Add(-time.Duration(r.token.tokenSource().reserve) * time.Second); cacheExpiry.After(issuedAt) && at.After(cacheExpiry) {
+		at = cacheExpiry
+	}
+	if delay := at.Sub(now); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// retryDelay 第 failures 次失败后的等待时间, 不会晚于旧 token 过期
+func (r *Refresher) retryDelay(failures int) time.Duration {
+	policy := util.RetryPolicy{BaseDelay: r.config.RetryDelay, MaxDelay: r.config.MaxRetryDelay}
+	delay := policy.Backoff(failures)
+	if _, expiresAt := r.token.lifetime(); !expiresAt.IsZero() {
+		if remaining := time.Until(expiresAt) / 2; remaining > 0 && remaining < delay {
+			delay = remaining
+		}
+	}
+	return delay
+}
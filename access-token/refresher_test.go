@@ -0,0 +1,50 @@
+package access_token
+
+import (
+	"fmt"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/util"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试后台刷新 token: 缓存过期前换成新的 token, 刷新失败后重试, Close 后停止
+func TestRefresher(t *testing.T) {
+	var tokens, refreshErrors int32
+	failures := int32(3) // 第一次刷新的 3 次尝试全部失败
+	token := NewDefaultAccessToken("tt_test", "secret", cache.NewMemory(), false).(*DefaultAccessToken)
+	token.HttpClient = newTestClient(func(r *http.Request) (int, string) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			return http.StatusBadGateway, ""
+		}
+		// 缓存有效期为 expires_in - 1500 即 1 秒
+		return http.StatusOK, fmt.Sprintf(`{"err_no":0,"data":{"access_token":"token_%d","expires_in":1501}}`, atomic.AddInt32(&tokens, 1))
+	})
+	token.Environment = util.NewEnvironment("test", "http://token.test")
+	refresher := token.StartRefresher(RefresherConfig{
+		RetryDelay: 10 * time.Millisecond,
+		OnError:    func(err error) { atomic.AddInt32(&refreshErrors, 1) },
+	})
+	defer refresher.Close()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt32(&tokens) < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&tokens) < 2 || atomic.LoadInt32(&refreshErrors) == 0 {
+		t.Fatalf("tokens = %d, refresh errors = %d", atomic.LoadInt32(&tokens), atomic.LoadInt32(&refreshErrors))
+	}
+	if err := refresher.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if accessToken, err := token.GetAccessToken(); err != nil || accessToken == "token_1" {
+		t.Fatalf("GetAccessToken() = %s, %v", accessToken, err)
+	}
+	refreshed := atomic.LoadInt32(&tokens)
+	time.Sleep(1200 * time.Millisecond)
+	if atomic.LoadInt32(&tokens) != refreshed {
+		t.Fatal("refresher should stop after Close")
+	}
+}
@@ -0,0 +1,326 @@
+package access_token
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/util"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointRemoteToken 从 token 服务获取 token 的接口名称
+const EndpointRemoteToken = "remoteToken"
+
+// token 服务的接口地址, {appId} 为小程序的 app_id
+//
+//	GET  /token/{appId}            获取 token 及有效期
+//	POST /token/{appId}/refresh    立即刷新 token
+//	POST /token/{appId}/invalidate 作废被平台拒绝的 token, 请求内容为 {"access_token":"..."}
+const remoteTokenPath = "/token/"
+
+const (
+	// remoteTokenReserve 本地缓存 token 时在过期时间基础上预留的时间
+	remoteTokenReserve = 5 * time.Minute
+	// remoteUnknownTTL token 服务未返回过期时间时本地缓存的时间
+	remoteUnknownTTL = time.Minute
+	// remoteRefreshRecheck 已过 token 服务的刷新时间但服务还未刷新时本地缓存的时间
+	remoteRefreshRecheck = time.Minute
+)
+
+// RemoteToken token 服务返回的 token, 时间为 unix 秒, 未知时为 0
+type RemoteToken struct {
+	AccessToken string `json:"access_token"`
+	IssuedAt    int64  `json:"issued_at,omitempty"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"`
+	RefreshAt   int64  `json:"refresh_at,omitempty"` // token 服务最晚在该时间后台刷新, 客户端本地缓存不应晚于该时间失效
+}
+
+// newRemoteToken 转换为 token 服务的返回结构体
+func newRemoteToken(info TokenInfo) RemoteToken {
+	token := RemoteToken{AccessToken: info.AccessToken}
+	if !info.IssuedAt.IsZero() {
+		token.IssuedAt = info.IssuedAt.Unix()
+	}
+	if !info.ExpiresAt.IsZero() {
+		token.ExpiresAt = info.ExpiresAt.Unix()
+	}
+	return token
+}
+
+// Info 转换为 TokenInfo
+func (t RemoteToken) Info() TokenInfo {
+	info := TokenInfo{AccessToken: t.AccessToken}
+	if t.IssuedAt > 0 {
+		info.IssuedAt = time.Unix(t.IssuedAt, 0)
+	}
+	if t.ExpiresAt > 0 {
+		info.ExpiresAt = time.Unix(t.ExpiresAt, 0)
+	}
+	return info
+}
+
+// TokenServer token 服务, 按 app_id 路由到注册的 AccessToken, 使只有一个服务向平台获取 token
+// 其他语言的服务或短时任务通过 http 获取, 请求需要带上 Authorization: Bearer {Secret}
+type TokenServer struct {
+	Secret    string           // 共享密钥, 为空时拒绝所有请求
+	Cache     cache.Cache      // 自定义 AccessToken 未实现 Invalidator/ForceRefresher 时作废 token 使用的缓存
+	Refresher *RefresherConfig // 注册的 token 开启的后台刷新配置, 设置后返回 refresh_at, 使客户端在服务刷新后及时获取新的 token
+	mu        sync.RWMutex
+	tokens    map[string]AccessToken
+}
+
+// NewTokenServer 实例化 token 服务
+func NewTokenServer(secret string) *TokenServer {
+	return &TokenServer{Secret: secret, tokens: map[string]AccessToken{}}
+}
+
+// Register 注册小程序的 AccessToken, 重复注册时覆盖
+func (s *TokenServer) Register(appId string, token AccessToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[appId] = token
+}
+
+// get 获取注册的 AccessToken
+func (s *TokenServer) get(appId string) (AccessToken, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	token, ok := s.tokens[appId]
+	return token, ok
+}
+
+// ServeHTTP 实现 http.Handler
+func (s *TokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeRemoteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, remoteTokenPath)
+	if path == r.URL.Path {
+		writeRemoteError(w, http.StatusNotFound, "not found")
+		return
+	}
+	appId, action := path, ""
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		appId, action = path[:i], path[i+1:]
+	}
+	token, ok := s.get(appId)
+	if !ok {
+		writeRemoteError(w, http.StatusNotFound, fmt.Sprintf("app %s not registered", appId))
+		return
+	}
+
+	var info TokenInfo
+	var err error
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		info, err = GetTokenInfoContext(r.Context(), token)
+	case action == "refresh" && r.Method == http.MethodPost:
+		info, err = ForceRefresh(r.Context(), token, s.Cache)
+	case action == "invalidate" && r.Method == http.MethodPost:
+		var rejected RemoteToken
+		if err = json.NewDecoder(r.Body).Decode(&rejected); err != nil || rejected.AccessToken == "" {
+			writeRemoteError(w, http.StatusBadRequest, "access_token is required")
+			return
+		}
+		if err = Invalidate(r.Context(), token, s.Cache, rejected.AccessToken); err == nil {
+			info, err = GetTokenInfoContext(r.Context(), token)
+		}
+	default:
+		writeRemoteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err != nil {
+		// 透传平台的错误码及 log_id, 便于调用方排查
+		res := map[string]interface{}{"err_tips": err.Error()}
+		if apiErr, ok := util.AsAPIError(err); ok {
+			res["err_no"], res["log_id"] = apiErr.Code, apiErr.LogId
+		}
+		writeRemoteJson(w, http.StatusBadGateway, res)
+		return
+	}
+	res := newRemoteToken(info)
+	if s.Refresher != nil && info.Known() && !info.IssuedAt.IsZero() {
+		res.RefreshAt = s.Refresher.latestRefresh(info.IssuedAt, info.ExpiresAt).Unix()
+	}
+	writeRemoteJson(w, http.StatusOK, res)
+}
+
+// authorized 校验共享密钥, 请求头必须为 Bearer {Secret}
+func (s *TokenServer) authorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	authorization := r.Header.Get("Authorization")
+	if s.Secret == "" || !strings.HasPrefix(authorization, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(authorization[len(prefix):]), []byte(s.Secret)) == 1
+}
+
+// writeRemoteError 返回错误信息
+func writeRemoteError(w http.ResponseWriter, status int, message string) {
+	writeRemoteJson(w, status, map[string]interface{}{"err_tips": message})
+}
+
+// writeRemoteJson 返回 json
+func writeRemoteJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// RemoteAccessToken 从 TokenServer 获取 token 的 AccessToken
+// token 缓存在本实例内存中, 到期前 Reserve, token 服务的刷新时间 refresh_at 或被作废时重新向 token 服务获取
+type RemoteAccessToken struct {
+	ServerUrl   string            // token 服务的地址, 如 http://token-server:8080
+	AppId       string            // 小程序的 app_id
+	Secret      string            // 共享密钥
+	HttpClient  *util.Client      // http 请求执行器, 为空时使用默认执行器
+	RetryPolicy *util.RetryPolicy // 获取 token 失败时的重试策略, 为空时不重试
+	Reserve     time.Duration     // 本地缓存在 token 过期前该时间失效, 默认 5 分钟
+	cacheKey    string
+	fetchLock   chan struct{} // 获取 token 的锁, 使用 channel 以便等待时可以被 context 取消
+	mu          sync.Mutex    // 保护 token/validUntil
+	token       TokenInfo     // 本地缓存的 token
+	validUntil  time.Time     // 本地缓存的失效时间
+}
+
+// NewRemoteAccessToken 实例化从 token 服务获取 token 的 AccessToken
+func NewRemoteAccessToken(serverUrl, appId, secret string) *RemoteAccessToken {
+	return &RemoteAccessToken{
+		ServerUrl:   serverUrl,
+		AppId:       appId,
+		Secret:      secret,
+		RetryPolicy: util.DefaultRetryPolicy(),
+		Reserve:     remoteTokenReserve,
+		cacheKey:    fmt.Sprintf("douyin_openapi_remote_token_%s", appId),
+		fetchLock:   make(chan struct{}, 1),
+	}
+}
+
+// GetCacheKey 获取缓存key, token 只缓存在本实例内存中, 仅用于区分不同的 token
+func (rt *RemoteAccessToken) GetCacheKey() string {
+	return rt.cacheKey
+}
+
+// SetCacheKey 设置缓存key
+func (rt *RemoteAccessToken) SetCacheKey(key string) {
+	rt.cacheKey = key
+}
+
+// GetAccessToken 获取token
+func (rt *RemoteAccessToken) GetAccessToken() (string, error) {
+	return rt.GetAccessTokenContext(context.Background())
+}
+
+// GetAccessTokenContext 获取token, 支持传入 context
+func (rt *RemoteAccessToken) GetAccessTokenContext(ctx context.Context) (string, error) {
+	info, err := rt.GetTokenInfoContext(ctx)
+	return info.AccessToken, err
+}
+
+// GetTokenInfo 获取token及其有效期
+func (rt *RemoteAccessToken) GetTokenInfo() (TokenInfo, error) {
+	return rt.GetTokenInfoContext(context.Background())
+}
+
+// GetTokenInfoContext 获取token及其有效期, 本地缓存失效时向 token 服务获取
+func (rt *RemoteAccessToken) GetTokenInfoContext(ctx context.Context) (TokenInfo, error) {
+	if info, ok := rt.cached(); ok {
+		return info, nil
+	}
+	select {
+	case rt.fetchLock <- struct{}{}:
+	case <-ctx.Done():
+		return TokenInfo{}, ctx.Err()
+	}
+	defer func() { <-rt.fetchLock }()
+	// 双捡防止重复获取
+	if info, ok := rt.cached(); ok {
+		return info, nil
+	}
+	return rt.request(ctx, http.MethodGet, "", nil)
+}
+
+// ForceRefresh 让 token 服务立即刷新 token
+func (rt *RemoteAccessToken) ForceRefresh() (TokenInfo, error) {
+	return rt.ForceRefreshContext(context.Background())
+}
+
+// ForceRefreshContext 让 token 服务立即刷新 token, 支持传入 context
+func (rt *RemoteAccessToken) ForceRefreshContext(ctx context.Context) (TokenInfo, error) {
+	return rt.request(ctx, http.MethodPost, "/refresh", nil)
+}
+
+// InvalidateContext 通知 token 服务作废被平台拒绝的 token, 并获取新的 token
+func (rt *RemoteAccessToken) InvalidateContext(ctx context.Context, token string) error {
+	_, err := rt.request(ctx, http.MethodPost, "/invalidate", RemoteToken{AccessToken: token})
+	return err
+}
+
+// cached 本地缓存的 token, 已失效时返回 false
+func (rt *RemoteAccessToken) cached() (TokenInfo, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.token.AccessToken == "" || !time.Now().Before(rt.validUntil) {
+		return TokenInfo{}, false
+	}
+	return rt.token, true
+}
+
+// request 请求 token 服务并更新本地缓存, token 服务的错误转换为 APIError
+func (rt *RemoteAccessToken) request(ctx context.Context, method, action string, params interface{}) (info TokenInfo, err error) {
+	call := &util.Call{
+		Endpoint: EndpointRemoteToken,
+		Method:   method,
+		URL:      strings.TrimRight(rt.ServerUrl, "/") + remoteTokenPath + url.PathEscape(rt.AppId) + action,
+		Header:   http.Header{"Authorization": {"Bearer " + rt.Secret}},
+		JSON:     params,
+	}
+	var res RemoteToken
+	err = rt.RetryPolicy.Do(ctx, EndpointRemoteToken, func(ctx context.Context) error {
+		response, err := rt.HttpClient.Execute(ctx, call)
+		if err != nil {
+			return util.WrapError(EndpointRemoteToken, err)
+		}
+		if err = util.CheckResponse(EndpointRemoteToken, response); err != nil {
+			return err
+		}
+		if err = json.Unmarshal(response.Body, &res); err != nil {
+			return &util.APIError{Endpoint: EndpointRemoteToken, StatusCode: response.StatusCode, Err: err}
+		}
+		if res.AccessToken == "" {
+			return &util.APIError{Endpoint: EndpointRemoteToken, StatusCode: response.StatusCode, Err: errors.New("empty access_token")}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	info = res.Info()
+	now := time.Now()
+	validUntil := now.Add(remoteUnknownTTL)
+	if info.Known() {
+		validUntil = info.ExpiresAt.Add(-rt.Reserve)
+	}
+	if res.RefreshAt > 0 {
+		// token 服务刷新后旧的 token 仍然有效, 但应尽快换成新的 token; 已过刷新时间时等待服务刷新
+		refreshAt := time.Unix(res.RefreshAt, 0)
+		if recheck := now.Add(remoteRefreshRecheck); refreshAt.Before(recheck) {
+			refreshAt = recheck
+		}
+		if refreshAt.Before(validUntil) {
+			validUntil = refreshAt
+		}
+	}
+	rt.mu.Lock()
+	rt.token, rt.validUntil = info, validUntil
+	rt.mu.Unlock()
+	return
+}
@@ -0,0 +1,187 @@
+package access_token
+
+import (
+	"context"
+	"fmt"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/util"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试 token 服务及从 token 服务获取 token 的 RemoteAccessToken
+func TestRemoteAccessToken(t *testing.T) {
+	var tokens, served int32
+	token := NewDefaultAccessToken("tt_test", "secret", cache.NewMemory(), false).(*DefaultAccessToken)
+	token.HttpClient = newTestClient(func(r *http.Request) (int, string) {
+		return http.StatusOK, fmt.Sprintf(`{"err_no":0,"data":{"access_token":"token_%d","expires_in":7200}}`, atomic.AddInt32(&tokens, 1))
+	})
+	token.Environment = util.NewEnvironment("test", "http://token.test")
+	server := NewTokenServer("secret")
+	server.Register("tt_test", token)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&served, 1)
+		server.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	if _, err := NewRemoteAccessToken(ts.URL, "tt_test", "wrong").GetAccessToken(); err == nil {
+		t.Fatal("want error for wrong secret")
+	} else if apiErr, ok := util.AsAPIError(err); !ok || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("want 401 APIError, got %v", err)
+	}
+	if _, err := NewRemoteAccessToken(ts.URL, "tt_unknown", "secret").GetAccessToken(); err == nil {
+		t.Fatal("want error for unregistered app")
+	} else if apiErr, ok := util.AsAPIError(err); !ok || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("want 404 APIError, got %v", err)
+	}
+
+	remote := NewRemoteAccessToken(ts.URL, "tt_test", "secret")
+	info, err := remote.GetTokenInfo()
+	if err != nil || info.AccessToken != "token_1" || !info.Known() || info.ExpiresAt.Sub(info.IssuedAt) != 2*time.Hour {
+		t.Fatalf("GetTokenInfo() = %+v, %v", info, err)
+	}
+	atomic.StoreInt32(&served, 0)
+	if accessToken, _ := remote.GetAccessToken(); accessToken != "token_1" || served != 0 {
+		t.Fatalf("want locally cached token_1, got %s after %d requests", accessToken, served)
+	}
+
+	// 作废被拒绝的 token 后 token 服务重新获取
+	if err = remote.InvalidateContext(context.Background(), "token_1"); err != nil {
+		t.Fatal(err)
+	}
+	if accessToken, _ := remote.GetAccessToken(); accessToken != "token_2" {
+		t.Fatalf("want token_2 after invalidate, got %s", accessToken)
+	}
+	if info, err = remote.ForceRefresh(); err != nil || info.AccessToken != "token_3" {
+		t.Fatalf("ForceRefresh() = %+v, %v", info, err)
+	}
+	if accessToken, _ := remote.GetAccessToken(); accessToken != "token_3" || tokens != 3 {
+		t.Errorf("want token_3 after 3 platform requests, got %s after %d", accessToken, tokens)
+	}
+}
+
+// 测试 token 服务只接受 Bearer {Secret} 格式的请求头
+func TestTokenServer_Authorized(t *testing.T) {
+	server := NewTokenServer("secret")
+	for authorization, want := range map[string]bool{
+		"Bearer secret":  true,
+		"secret":         false,
+		"Bearer  secret": false,
+		"bearer secret":  false,
+		"Bearer wrong":   false,
+		"Bearer ":        false,
+		"":               false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/token/tt_test", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		if got := server.authorized(r); got != want {
+			t.Errorf("authorized(%q) = %v, want %v", authorization, got, want)
+		}
+	}
+	if NewTokenServer("").authorized(httptest.NewRequest(http.MethodGet, "/token/tt_test", nil)) {
+		t.Error("empty secret should reject all requests")
+	}
+}
+
+// stubAccessToken 只实现 AccessToken/Invalidator 的 token, 作废后下次获取返回新的 token
+type stubAccessToken struct {
+	mu      sync.Mutex
+	fetches int
+	token   string
+}
+
+func (s *stubAccessToken) GetCacheKey() string { return "stub_access_token" }
+
+func (s *stubAccessToken) SetCacheKey(string) {}
+
+func (s *stubAccessToken) GetAccessToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == "" {
+		s.fetches++
+		s.token = fmt.Sprintf("token_%d", s.fetches)
+	}
+	return s.token, nil
+}
+
+func (s *stubAccessToken) InvalidateContext(_ context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+	return nil
+}
+
+// 测试平台拒绝 token 后通过 RemoteAccessToken 通知 token 服务作废, 只有被拒绝的 token 会被作废
+func TestRemoteAccessToken_Invalidate(t *testing.T) {
+	stub := &stubAccessToken{}
+	server := NewTokenServer("secret")
+	server.Register("tt_test", stub)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	remote := NewRemoteAccessToken(ts.URL, "tt_test", "secret")
+	if token, err := remote.GetAccessToken(); err != nil || token != "token_1" {
+		t.Fatalf("GetAccessToken() = %s, %v", token, err)
+	}
+	if err := remote.InvalidateContext(context.Background(), "token_1"); err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := remote.GetAccessToken(); token != "token_2" {
+		t.Fatalf("want token_2 after invalidate, got %s", token)
+	}
+	// 其他实例已经作废过的旧 token 不会使新的 token 失效
+	if err := remote.InvalidateContext(context.Background(), "token_1"); err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := remote.GetAccessToken(); token != "token_2" || stub.fetches != 2 {
+		t.Errorf("want token_2 after 2 fetches, got %s after %d", token, stub.fetches)
+	}
+}
+
+// 测试 token 服务返回 refresh_at 时本地缓存不晚于服务后台刷新的时间失效
+func TestRemoteAccessToken_RefreshAt(t *testing.T) {
+	token := NewDefaultAccessToken("tt_test", "secret", cache.NewMemory(), false).(*DefaultAccessToken)
+	token.HttpClient = newTestClient(func(r *http.Request) (int, string) {
+		return http.StatusOK, `{"err_no":0,"data":{"access_token":"token_1","expires_in":7200}}`
+	})
+	token.Environment = util.NewEnvironment("test", "http://token.test")
+	server := NewTokenServer("secret")
+	server.Register("tt_test", token)
+	server.Refresher = &RefresherConfig{Jitter: -1}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	remote := NewRemoteAccessToken(ts.URL, "tt_test", "secret")
+	info, err := remote.GetTokenInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 有效期 2 小时, 服务在 0.75 处即 90 分钟后刷新
+	if want := time.Unix(info.IssuedAt.Add(90*time.Minute).Unix(), 0); !remote.validUntil.Equal(want) {
+		t.Errorf("validUntil = %v, want %v", remote.validUntil, want)
+	}
+
+	// 已过刷新时间但服务还未刷新时, 等待一段时间后重新获取
+	past := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		writeRemoteJson(w, http.StatusOK, RemoteToken{AccessToken: "token_1", IssuedAt: now.Add(-time.Hour).Unix(), ExpiresAt: now.Add(time.Hour).Unix(), RefreshAt: now.Add(-time.Minute).Unix()})
+	}))
+	defer past.Close()
+	remote = NewRemoteAccessToken(past.URL, "tt_test", "secret")
+	before := time.Now()
+	if _, err = remote.GetAccessToken(); err != nil {
+		t.Fatal(err)
+	}
+	if remote.validUntil.Before(before.Add(remoteRefreshRecheck)) || remote.validUntil.After(time.Now().Add(remoteRefreshRecheck)) {
+		t.Errorf("validUntil = %v, want %v after now", remote.validUntil, remoteRefreshRecheck)
+	}
+}
@@ -0,0 +1,106 @@
+package access_token
+
+import (
+	"context"
+	"errors"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/util"
+	"time"
+)
+
+// TokenInfo token 及其有效期
+type TokenInfo struct {
+	AccessToken string    // token
+	IssuedAt    time.Time // 获取时间, 未知时为零值
+	ExpiresAt   time.Time // 过期时间, 未知时为零值
+}
+
+// Known 是否知道 token 的过期时间, 缓存中的 token 由其他实例或自定义的 AccessToken 获取时可能未知
+func (t TokenInfo) Known() bool {
+	return !t.ExpiresAt.IsZero()
+}
+
+// Remaining token 的剩余有效期, 已过期时为 0, 过期时间未知时返回 false
+func (t TokenInfo) Remaining(now time.Time) (time.Duration, bool) {
+	if !t.Known() {
+		return 0, false
+	}
+	if remaining := t.ExpiresAt.Sub(now); remaining > 0 {
+		return remaining, true
+	}
+	return 0, true
+}
+
+// InfoAccessToken 支持查询有效期的 AccessToken
+type InfoAccessToken interface {
+	AccessToken
+	GetTokenInfoContext(ctx context.Context) (TokenInfo, error) // 获取 token 及其有效期
+}
+
+// ForceRefresher 支持立即刷新的 AccessToken
+type ForceRefresher interface {
+	AccessToken
+	ForceRefreshContext(ctx context.Context) (TokenInfo, error) // 不论缓存中的 token 是否过期, 立即获取新的 token
+}
+
+// GetTokenInfoContext 获取 token 及其有效期
+// token 管理类未实现 InfoAccessToken 时只返回 token, 有效期为零值
+func GetTokenInfoContext(ctx context.Context, token AccessToken) (TokenInfo, error) {
+	if it, ok := token.(InfoAccessToken); ok {
+		return it.GetTokenInfoContext(ctx)
+	}
+	accessToken, err := GetAccessTokenContext(ctx, token)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+	return TokenInfo{AccessToken: accessToken}, nil
+}
+
+// ForceRefresh 立即刷新 token, 如怀疑 token 已泄露或密钥刚刚轮换
+// token 管理类未实现 ForceRefresher 时作废 c 中缓存的 token 后重新获取
+func ForceRefresh(ctx context.Context, token AccessToken, c cache.Cache) (TokenInfo, error) {
+	if fr, ok := token.(ForceRefresher); ok {
+		return fr.ForceRefreshContext(ctx)
+	}
+	if c != nil {
+		current, _ := cache.GetContext(ctx, c, token.GetCacheKey()).(string)
+		if current != "" {
+			if err := Invalidate(ctx, token, c, current); err != nil {
+				return TokenInfo{}, err
+			}
+		}
+	}
+	return GetTokenInfoContext(ctx, token)
+}
+
+// RefreshEvent 一次 token 刷新的结果
+type RefreshEvent struct {
+	Endpoint string         // 获取 token 的接口名称
+	AppId    string         // 小程序 app_id/应用 client_key, 用户 token 为 open_id
+	Token    TokenInfo      // 获取到的 token, 失败时为零值
+	Latency  time.Duration  // 刷新耗时, 包含重试
+	Err      error          // 失败原因, 成功时为空
+	APIError *util.APIError // 平台返回的错误(错误码/错误信息/log_id/尝试次数), 非接口错误时为空
+}
+
+// RefreshHooks token 刷新的回调, 在获取 token 的协程中同步执行, 不要做耗时的操作
+type RefreshHooks struct {
+	OnRefresh      func(event RefreshEvent) // 刷新成功的回调, 为空时忽略
+	OnRefreshError func(event RefreshEvent) // 刷新失败的回调, 为空时忽略
+}
+
+// Emit 按 event.Err 调用对应的回调, 并从 event.Err 中解析出 APIError
+func (h RefreshHooks) Emit(event RefreshEvent) {
+	if event.Err == nil {
+		if h.OnRefresh != nil {
+			h.OnRefresh(event)
+		}
+		return
+	}
+	if event.APIError == nil {
+		errors.As(event.Err, &event.APIError)
+	}
+	if h.OnRefreshError != nil {
+		h.OnRefreshError(event)
+	}
+}
@@ -0,0 +1,93 @@
+package access_token
+
+import (
+	"context"
+	"fmt"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/util"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// legacyAccessToken 只实现了基础接口的自定义 AccessToken
+type legacyAccessToken struct {
+	cache   cache.Cache
+	fetches int
+}
+
+func (l *legacyAccessToken) GetCacheKey() string { return "legacy_access_token" }
+
+func (l *legacyAccessToken) SetCacheKey(string) {}
+
+func (l *legacyAccessToken) GetAccessToken() (string, error) {
+	if val, ok := l.cache.Get(l.GetCacheKey()).(string); ok {
+		return val, nil
+	}
+	l.fetches++
+	token := fmt.Sprintf("legacy_%d", l.fetches)
+	return token, l.cache.Set(l.GetCacheKey(), token, time.Hour)
+}
+
+// 测试 token 有效期查询/立即刷新/刷新回调
+func TestDefaultAccessToken_TokenInfo(t *testing.T) {
+	var requests int32
+	var refreshed, failed []RefreshEvent
+	token := NewDefaultAccessToken("tt_test", "secret", cache.NewMemory(), false).(*DefaultAccessToken)
+	token.RetryPolicy = nil
+	token.HttpClient = newTestClient(func(r *http.Request) (int, string) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			return http.StatusOK, `{"err_no":40015,"err_tips":"bad secret","log_id":"1"}`
+		}
+		return http.StatusOK, fmt.Sprintf(`{"err_no":0,"data":{"access_token":"token_%d","expires_in":7200}}`, requests)
+	})
+	token.Environment = util.NewEnvironment("test", "http://token.test")
+	token.RefreshHooks = RefreshHooks{
+		OnRefresh:      func(event RefreshEvent) { refreshed = append(refreshed, event) },
+		OnRefreshError: func(event RefreshEvent) { failed = append(failed, event) },
+	}
+
+	if _, err := token.GetTokenInfo(); err == nil {
+		t.Fatal("want error on first refresh")
+	}
+	if len(failed) != 1 || failed[0].APIError == nil || failed[0].APIError.Code != 40015 || failed[0].Endpoint != Endpoint || failed[0].AppId != "tt_test" {
+		t.Fatalf("unexpected OnRefreshError events %+v", failed)
+	}
+
+	before := time.Now()
+	info, err := token.GetTokenInfo()
+	if err != nil || info.AccessToken != "token_2" {
+		t.Fatalf("GetTokenInfo() = %+v, %v", info, err)
+	}
+	if remaining, ok := info.Remaining(info.IssuedAt); !ok || remaining != 2*time.Hour || info.IssuedAt.Before(before) {
+		t.Errorf("want 2h lifetime issued after %v, got %+v", before, info)
+	}
+	if len(refreshed) != 1 || refreshed[0].Token != info {
+		t.Errorf("unexpected OnRefresh events %+v", refreshed)
+	}
+
+	info, err = token.ForceRefresh()
+	if err != nil || info.AccessToken != "token_3" || !info.Known() {
+		t.Fatalf("ForceRefresh() = %+v, %v", info, err)
+	}
+	if accessToken, _ := token.GetAccessToken(); accessToken != "token_3" || len(refreshed) != 2 {
+		t.Errorf("want cached token_3 after 2 refreshes, got %s after %d", accessToken, len(refreshed))
+	}
+}
+
+// 测试只实现了基础接口的 AccessToken 有效期未知, 立即刷新时作废缓存后重新获取
+func TestForceRefresh_Legacy(t *testing.T) {
+	memory := cache.NewMemory()
+	legacy := &legacyAccessToken{cache: memory}
+	info, err := GetTokenInfoContext(context.Background(), legacy)
+	if err != nil || info.AccessToken != "legacy_1" || info.Known() {
+		t.Fatalf("GetTokenInfoContext() = %+v, %v", info, err)
+	}
+	if _, ok := info.Remaining(time.Now()); ok {
+		t.Error("want unknown remaining lifetime")
+	}
+	if info, err = ForceRefresh(context.Background(), legacy, memory); err != nil || info.AccessToken != "legacy_2" {
+		t.Fatalf("ForceRefresh() = %+v, %v", info, err)
+	}
+}
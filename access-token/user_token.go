@@ -0,0 +1,496 @@
+package access_token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/metrics"
+	"github.com/38888/douyin-openapi/util"
+	"hash/fnv"
+	"net/url"
+	"time"
+)
+
+// 用户授权 token 的接口名称
+const (
+	EndpointUserAccessToken       = "oauthAccessToken"       // 通过授权码获取用户 access_token
+	EndpointUserRefreshToken      = "oauthRefreshToken"      // 刷新用户 access_token
+	EndpointUserRenewRefreshToken = "oauthRenewRefreshToken" // 续期 refresh_token
+)
+
+// 用户授权 token 的接口地址, 域名由 Environment 的开放平台分组决定
+const (
+	userAccessTokenPath       = "/oauth/access_token/"
+	userRefreshTokenPath      = "/oauth/refresh_token/"
+	userRenewRefreshTokenPath = "/oauth/renew_refresh_token/"
+)
+
+var (
+	// ErrUserTokenNotFound 缓存中没有该用户的 token, 需要用户重新授权
+	ErrUserTokenNotFound = errors.New("access_token: user token not found")
+	// ErrUserTokenExpired 用户的 refresh_token 已过期, 需要用户重新授权
+	ErrUserTokenExpired = errors.New("access_token: user refresh token expired")
+)
+
+// userTokenLocks 按 open_id 分段加锁的段数
+const userTokenLocks = 64
+
+// UserToken 用户授权的 token
+type UserToken struct {
+	OpenId           string    `json:"open_id"`            // 授权用户的 open_id
+	Scope            string    `json:"scope"`              // 用户授权的作用域, 以逗号分隔
+	AccessToken      string    `json:"access_token"`       // 用户 access_token
+	ExpiresAt        time.Time `json:"expires_at"`         // access_token 的过期时间
+	RefreshToken     string    `json:"refresh_token"`      // 用于刷新 access_token
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"` // refresh_token 的过期时间
+}
+
+// Expired access_token 在 reserve 时间内是否过期
+func (t UserToken) Expired(reserve time.Duration) bool {
+	return !time.Now().Add(reserve).Before(t.ExpiresAt)
+}
+
+// info 转换为 TokenInfo, issuedAt 为获取时间, 未知时传零值
+func (t UserToken) info(issuedAt time.Time) TokenInfo {
+	return TokenInfo{AccessToken: t.AccessToken, IssuedAt: issuedAt, ExpiresAt: t.ExpiresAt}
+}
+
+// RefreshExpired refresh_token 在 reserve 时间内是否过期
+func (t UserToken) RefreshExpired(reserve time.Duration) bool {
+	return !time.Now().Add(reserve).Before(t.RefreshExpiresAt)
+}
+
+// ResUserToken 获取/刷新用户 token 的返回结构体
+type ResUserToken struct {
+	Data    ResUserTokenData `json:"data,omitempty"`
+	Message string           `json:"message,omitempty"`
+}
+
+type ResUserTokenData struct {
+	ErrorCode        int    `json:"error_code,omitempty"`
+	Description      string `json:"description,omitempty"`
+	AccessToken      string `json:"access_token,omitempty"`
+	ExpiresIn        int    `json:"expires_in,omitempty"`
+	OpenId           string `json:"open_id,omitempty"`
+	RefreshExpiresIn int    `json:"refresh_expires_in,omitempty"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	Scope            string `json:"scope,omitempty"`
+}
+
+// UserTokenManager 用户授权 token 管理类, 按 open_id 在缓存中保存 access_token/refresh_token
+// access_token 即将过期时使用 refresh_token 刷新, refresh_token 即将过期时自动续期
+type UserTokenManager struct {
+	ClientKey      string            // 应用的 client_key
+	ClientSecret   string            // 应用的 client_secret
+	Cache          cache.Cache       // 缓存组件
+	SandBox        bool              // 是否沙盒地址 默认 false 线上地址
+	Environment    util.Environment  // 接口环境, 为空时根据 SandBox 选择
+	HttpClient     *util.Client      // http 请求执行器, 为空时使用默认执行器
+	RetryPolicy    *util.RetryPolicy // 刷新 access_token 失败时的重试策略, 为空时不重试; 授权码及续期的 refresh_token 只能使用一次, 不重试
+	Metrics        metrics.Metrics   // 监控指标收集, 为空时不记录
+	RefreshReserve time.Duration     // access_token 剩余有效期小于该值时刷新, 默认 5 分钟
+	RenewReserve   time.Duration     // refresh_token 剩余有效期小于该值时续期, 默认 1 天, 小于 0 时不自动续期
+	RefreshHooks                     // 刷新/续期的回调, AppId 为用户的 open_id
+	cacheKeyPrefix string
+	locks          [userTokenLocks]chan struct{} // 按 open_id 分段的锁, 防止并发刷新同一个用户的 token
+}
+
+// NewUserTokenManager 实例化用户授权 token 管理类
+func NewUserTokenManager(clientKey, clientSecret string, cache cache.Cache, isSandbox bool) *UserTokenManager {
+	if cache == nil {
+		panic(any("cache is need"))
+	}
+	m := &UserTokenManager{
+		ClientKey:      clientKey,
+		ClientSecret:   clientSecret,
+		Cache:          cache,
+		SandBox:        isSandbox,
+		Environment:    util.GetEnvironment(isSandbox),
+		RetryPolicy:    util.DefaultRetryPolicy(),
+		RefreshReserve: 5 * time.Minute,
+		RenewReserve:   24 * time.Hour,
+		cacheKeyPrefix: fmt.Sprintf("douyin_openapi_user_token_%s_", clientKey),
+	}
+	for i := range m.locks {
+		m.locks[i] = make(chan struct{}, 1)
+	}
+	return m
+}
+
+// GetCacheKey 获取用户 token 的缓存key
+func (m *UserTokenManager) GetCacheKey(openId string) string {
+	return m.cacheKeyPrefix + openId
+}
+
+// SetCacheKeyPrefix 设置缓存key的前缀, 缓存key为前缀加 open_id
+func (m *UserTokenManager) SetCacheKeyPrefix(prefix string) {
+	m.cacheKeyPrefix = prefix
+}
+
+// GetEnvironment 获取接口环境, 未设置时根据 SandBox 选择
+func (m *UserTokenManager) GetEnvironment() util.Environment {
+	if m.Environment.BaseUrls == nil {
+		return util.GetEnvironment(m.SandBox)
+	}
+	return m.Environment
+}
+
+// lock 对 open_id 加锁
+func (m *UserTokenManager) lock(ctx context.Context, openId string) (func(), error) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(openId))
+	l := m.locks[h.Sum32()%userTokenLocks]
+	select {
+	case l <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return func() { <-l }, nil
+}
+
+// ExchangeCode 通过用户授权的 code 获取 token 并保存
+func (m *UserTokenManager) ExchangeCode(code string) (UserToken, error) {
+	return m.ExchangeCodeContext(context.Background(), code)
+}
+
+// ExchangeCodeContext 通过用户授权的 code 获取 token 并保存, 支持传入 context
+func (m *UserTokenManager) ExchangeCodeContext(ctx context.Context, code string) (token UserToken, err error) {
+	res, err := m.request(ctx, EndpointUserAccessToken, &util.Call{
+		Endpoint: EndpointUserAccessToken,
+		URL:      m.GetEnvironment().Url(util.FamilyOpenPlatform, userAccessTokenPath),
+		JSON: map[string]interface{}{
+			"client_key":    m.ClientKey,
+			"client_secret": m.ClientSecret,
+			"code":          code,
+			"grant_type":    "authorization_code",
+		},
+	})
+	if err != nil {
+		return
+	}
+	token = newUserToken(time.Now(), res.Data)
+	err = m.SetTokenContext(ctx, token)
+	return
+}
+
+// newUserToken 根据接口返回值生成 token
+func newUserToken(now time.Time, data ResUserTokenData) UserToken {
+	return UserToken{
+		OpenId:           data.OpenId,
+		Scope:            data.Scope,
+		AccessToken:      data.AccessToken,
+		ExpiresAt:        now.Add(time.Duration(data.ExpiresIn) * time.Second),
+		RefreshToken:     data.RefreshToken,
+		RefreshExpiresAt: now.Add(time.Duration(data.RefreshExpiresIn) * time.Second),
+	}
+}
+
+// GetToken 获取用户的 token, access_token 即将过期时自动刷新
+func (m *UserTokenManager) GetToken(openId string) (UserToken, error) {
+	return m.GetTokenContext(context.Background(), openId)
+}
+
+// GetTokenContext 获取用户的 token, access_token 即将过期时自动刷新, 支持传入 context
+// 没有该用户的 token 时返回 ErrUserTokenNotFound, refresh_token 及 access_token 均已过期时返回 ErrUserTokenExpired, 均需要用户重新授权
+func (m *UserTokenManager) GetTokenContext(ctx context.Context, openId string) (UserToken, error) {
+	token, err := m.LoadTokenContext(ctx, openId)
+	if err != nil {
+		return UserToken{}, err
+	}
+	if token.RefreshExpired(0) {
+		// refresh_token 已过期时无法续期或刷新, 不需要加锁, access_token 仍有效时继续使用
+		if token.Expired(0) {
+			return UserToken{}, fmt.Errorf("%w: %s", ErrUserTokenExpired, openId)
+		}
+		return token, nil
+	}
+	if !token.Expired(m.RefreshReserve) && !m.needRenew(token) {
+		return token, nil
+	}
+	unlock, err := m.lock(ctx, openId)
+	if err != nil {
+		return UserToken{}, err
+	}
+	defer unlock()
+	// 双捡防止重复刷新
+	if token, err = m.LoadTokenContext(ctx, openId); err != nil {
+		return UserToken{}, err
+	}
+	if m.needRenew(token) && !token.RefreshExpired(0) {
+		// 续期失败已通过 RefreshHooks 通知, refresh_token 仍未过期, 继续使用当前的 token, 下次获取时再续期
+		if renewed, err := m.renew(ctx, token); err == nil {
+			token = renewed
+		}
+	}
+	if token.Expired(m.RefreshReserve) {
+		return m.refresh(ctx, token)
+	}
+	return token, nil
+}
+
+// GetAccessToken 获取用户的 access_token, access_token 即将过期时自动刷新
+func (m *UserTokenManager) GetAccessToken(openId string) (string, error) {
+	return m.GetAccessTokenContext(context.Background(), openId)
+}
+
+// GetAccessTokenContext 获取用户的 access_token, 支持传入 context
+func (m *UserTokenManager) GetAccessTokenContext(ctx context.Context, openId string) (string, error) {
+	token, err := m.GetTokenContext(ctx, openId)
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// RefreshToken 立即使用 refresh_token 刷新用户的 access_token
+func (m *UserTokenManager) RefreshToken(openId string) (UserToken, error) {
+	return m.RefreshTokenContext(context.Background(), openId)
+}
+
+// RefreshTokenContext 立即使用 refresh_token 刷新用户的 access_token, 支持传入 context
+func (m *UserTokenManager) RefreshTokenContext(ctx context.Context, openId string) (UserToken, error) {
+	unlock, err := m.lock(ctx, openId)
+	if err != nil {
+		return UserToken{}, err
+	}
+	defer unlock()
+	token, err := m.LoadTokenContext(ctx, openId)
+	if err != nil {
+		return UserToken{}, err
+	}
+	return m.refresh(ctx, token)
+}
+
+// RenewRefreshToken 立即续期用户的 refresh_token
+func (m *UserTokenManager) RenewRefreshToken(openId string) (UserToken, error) {
+	return m.RenewRefreshTokenContext(context.Background(), openId)
+}
+
+// RenewRefreshTokenContext 立即续期用户的 refresh_token, 支持传入 context
+func (m *UserTokenManager) RenewRefreshTokenContext(ctx context.Context, openId string) (UserToken, error) {
+	unlock, err := m.lock(ctx, openId)
+	if err != nil {
+		return UserToken{}, err
+	}
+	defer unlock()
+	token, err := m.LoadTokenContext(ctx, openId)
+	if err != nil {
+		return UserToken{}, err
+	}
+	return m.renew(ctx, token)
+}
+
+// needRenew refresh_token 是否需要续期
+func (m *UserTokenManager) needRenew(token UserToken) bool {
+	return m.RenewReserve >= 0 && token.RefreshExpired(m.RenewReserve)
+}
+
+// refresh 调用接口刷新 access_token 并保存, 调用方需持有该用户的锁
+func (m *UserTokenManager) refresh(ctx context.Context, token UserToken) (UserToken, error) {
+	if token.RefreshExpired(0) {
+		return UserToken{}, fmt.Errorf("%w: %s", ErrUserTokenExpired, token.OpenId)
+	}
+	now := time.Now()
+	res, err := m.request(ctx, EndpointUserRefreshToken, &util.Call{
+		Endpoint: EndpointUserRefreshToken,
+		URL:      m.GetEnvironment().Url(util.FamilyOpenPlatform, userRefreshTokenPath),
+		Form: url.Values{
+			"client_key":    {m.ClientKey},
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {token.RefreshToken},
+		},
+	})
+	event := RefreshEvent{Endpoint: EndpointUserRefreshToken, AppId: token.OpenId, Latency: time.Since(now), Err: err}
+	defer func() { m.Emit(event) }()
+	if err != nil {
+		return UserToken{}, err
+	}
+	refreshed := newUserToken(now, res.Data)
+	if refreshed.OpenId == "" {
+		refreshed.OpenId = token.OpenId
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken, refreshed.RefreshExpiresAt = token.RefreshToken, token.RefreshExpiresAt
+	}
+	if event.Err = m.SetTokenContext(ctx, refreshed); event.Err != nil {
+		return UserToken{}, event.Err
+	}
+	event.Token = refreshed.info(now)
+	return refreshed, nil
+}
+
+// renew 调用接口续期 refresh_token 并保存, 调用方需持有该用户的锁
+func (m *UserTokenManager) renew(ctx context.Context, token UserToken) (UserToken, error) {
+	if token.RefreshExpired(0) {
+		return UserToken{}, fmt.Errorf("%w: %s", ErrUserTokenExpired, token.OpenId)
+	}
+	now := time.Now()
+	res, err := m.request(ctx, EndpointUserRenewRefreshToken, &util.Call{
+		Endpoint: EndpointUserRenewRefreshToken,
+		URL:      m.GetEnvironment().Url(util.FamilyOpenPlatform, userRenewRefreshTokenPath),
+		Form: url.Values{
+			"client_key":    {m.ClientKey},
+			"refresh_token": {token.RefreshToken},
+		},
+	})
+	event := RefreshEvent{Endpoint: EndpointUserRenewRefreshToken, AppId: token.OpenId, Latency: time.Since(now), Err: err}
+	defer func() { m.Emit(event) }()
+	if err != nil {
+		return UserToken{}, err
+	}
+	// 续期接口的 expires_in 为新 refresh_token 的有效期, access_token 不变
+	token.RefreshToken = res.Data.RefreshToken
+	token.RefreshExpiresAt = now.Add(time.Duration(res.Data.ExpiresIn) * time.Second)
+	if event.Err = m.SetTokenContext(ctx, token); event.Err != nil {
+		return UserToken{}, event.Err
+	}
+	event.Token = TokenInfo{AccessToken: token.AccessToken, ExpiresAt: token.ExpiresAt}
+	return token, nil
+}
+
+// request 请求接口并解析返回值, 只有刷新 access_token 按重试策略重试
+func (m *UserTokenManager) request(ctx context.Context, endpoint string, call *util.Call) (res ResUserToken, err error) {
+	var policy *util.RetryPolicy
+	if endpoint == EndpointUserRefreshToken {
+		policy = m.RetryPolicy
+	}
+	start := time.Now()
+	err = policy.Do(ctx, endpoint, func(ctx context.Context) error {
+		response, err := m.HttpClient.Execute(ctx, call)
+		if err != nil {
+			return util.WrapError(endpoint, err)
+		}
+		if err = util.CheckResponse(endpoint, response); err != nil {
+			return err
+		}
+		if err = json.Unmarshal(response.Body, &res); err != nil {
+			return &util.APIError{Endpoint: endpoint, StatusCode: response.StatusCode, Err: err}
+		}
+		return nil
+	})
+	if m.Metrics != nil && endpoint != EndpointUserAccessToken {
+		m.Metrics.ObserveTokenRefresh(m.ClientKey, time.Since(start), err)
+	}
+	return
+}
+
+// LoadToken 从缓存读取用户的 token, 不刷新
+func (m *UserTokenManager) LoadToken(openId string) (UserToken, error) {
+	return m.LoadTokenContext(context.Background(), openId)
+}
+
+// LoadTokenContext 从缓存读取用户的 token, 不刷新, 支持传入 context
+// token 以 json 字符串保存, 以便 redis 等远程缓存序列化
+func (m *UserTokenManager) LoadTokenContext(ctx context.Context, openId string) (token UserToken, err error) {
+	val := cache.GetContext(ctx, m.Cache, m.GetCacheKey(openId))
+	if m.Metrics != nil {
+		m.Metrics.ObserveCache(EndpointUserAccessToken, val != nil)
+	}
+	var data []byte
+	switch v := val.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		err = fmt.Errorf("%w: %s", ErrUserTokenNotFound, openId)
+		return
+	}
+	err = json.Unmarshal(data, &token)
+	return
+}
+
+// SetToken 保存用户的 token, 如从其他系统迁移的 token
+func (m *UserTokenManager) SetToken(token UserToken) error {
+	return m.SetTokenContext(context.Background(), token)
+}
+
+// SetTokenContext 保存用户的 token, 缓存有效期与 refresh_token 一致, 支持传入 context
+func (m *UserTokenManager) SetTokenContext(ctx context.Context, token UserToken) error {
+	if token.OpenId == "" {
+		return errors.New("access_token: user token open_id is empty")
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	timeout := time.Until(token.RefreshExpiresAt)
+	if expires := time.Until(token.ExpiresAt); expires > timeout {
+		timeout = expires
+	}
+	return cache.SetContext(ctx, m.Cache, m.GetCacheKey(token.OpenId), string(data), timeout)
+}
+
+// DeleteToken 删除用户的 token, 如用户取消授权
+func (m *UserTokenManager) DeleteToken(openId string) error {
+	return m.DeleteTokenContext(context.Background(), openId)
+}
+
+// DeleteTokenContext 删除用户的 token, 支持传入 context
+func (m *UserTokenManager) DeleteTokenContext(ctx context.Context, openId string) error {
+	return cache.DeleteContext(ctx, m.Cache, m.GetCacheKey(openId))
+}
+
+// ForUser 返回该用户的 AccessToken, 可以用于需要 AccessToken 接口的场景
+func (m *UserTokenManager) ForUser(openId string) AccessToken {
+	return &userAccessToken{manager: m, openId: openId}
+}
+
+// userAccessToken 单个用户的 AccessToken
+type userAccessToken struct {
+	manager *UserTokenManager
+	openId  string
+}
+
+// GetCacheKey 获取缓存key
+func (u *userAccessToken) GetCacheKey() string {
+	return u.manager.GetCacheKey(u.openId)
+}
+
+// SetCacheKey 用户 token 的缓存key由前缀及 open_id 决定, 不支持单独设置
+func (u *userAccessToken) SetCacheKey(string) {}
+
+// GetAccessToken 获取token
+func (u *userAccessToken) GetAccessToken() (string, error) {
+	return u.manager.GetAccessTokenContext(context.Background(), u.openId)
+}
+
+// GetAccessTokenContext 获取token, 支持传入 context
+func (u *userAccessToken) GetAccessTokenContext(ctx context.Context) (string, error) {
+	return u.manager.GetAccessTokenContext(ctx, u.openId)
+}
+
+// GetTokenInfoContext 获取token及其过期时间, 用户 token 不记录获取时间
+func (u *userAccessToken) GetTokenInfoContext(ctx context.Context) (TokenInfo, error) {
+	token, err := u.manager.GetTokenContext(ctx, u.openId)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+	return token.info(time.Time{}), nil
+}
+
+// ForceRefreshContext 立即使用 refresh_token 刷新
+func (u *userAccessToken) ForceRefreshContext(ctx context.Context) (TokenInfo, error) {
+	token, err := u.manager.RefreshTokenContext(ctx, u.openId)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+	return token.info(time.Time{}), nil
+}
+
+// InvalidateContext 平台拒绝了 token 时使用 refresh_token 刷新, 已被其他调用方刷新时不做任何事
+func (u *userAccessToken) InvalidateContext(ctx context.Context, token string) error {
+	unlock, err := u.manager.lock(ctx, u.openId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, err := u.manager.LoadTokenContext(ctx, u.openId)
+	if err != nil || current.AccessToken != token {
+		return err
+	}
+	_, err = u.manager.refresh(ctx, current)
+	return err
+}
@@ -0,0 +1,148 @@
+package access_token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/util"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestUserTokens 使用模拟接口的用户 token 管理类
+func newTestUserTokens(handler func(r *http.Request) (int, string)) *UserTokenManager {
+	m := NewUserTokenManager("client_key", "client_secret", cache.NewMemory(), false)
+	m.HttpClient = newTestClient(handler)
+	m.RetryPolicy = nil
+	return m
+}
+
+// 测试用户授权: 授权码换取 token, access_token 即将过期时刷新, refresh_token 即将过期时续期
+func TestUserTokenManager(t *testing.T) {
+	var refreshes, renews int32
+	m := newTestUserTokens(func(r *http.Request) (int, string) {
+		switch r.URL.Path {
+		case userAccessTokenPath:
+			var params map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&params)
+			if params["code"] != "code" || params["client_secret"] != "client_secret" {
+				return http.StatusOK, `{"data":{"error_code":10007,"description":"授权码过期"},"extra":{"logid":"202301010000"},"message":"error"}`
+			}
+			// access_token 的有效期小于刷新预留时间, 获取时会立即刷新
+			return http.StatusOK, `{"data":{"error_code":0,"access_token":"access_1","expires_in":60,"open_id":"open_id","refresh_token":"refresh_1","refresh_expires_in":2592000,"scope":"user_info"},"message":"success"}`
+		case userRefreshTokenPath:
+			if r.PostFormValue("grant_type") != "refresh_token" || r.PostFormValue("client_key") != "client_key" {
+				return http.StatusOK, `{"data":{"error_code":10002,"description":"参数错误"}}`
+			}
+			n := atomic.AddInt32(&refreshes, 1)
+			return http.StatusOK, fmt.Sprintf(`{"data":{"error_code":0,"access_token":"access_%d","expires_in":1296000,"open_id":"open_id","refresh_token":"%s","refresh_expires_in":2592000,"scope":"user_info"}}`, n+1, r.PostFormValue("refresh_token"))
+		case userRenewRefreshTokenPath:
+			atomic.AddInt32(&renews, 1)
+			return http.StatusOK, `{"data":{"error_code":0,"expires_in":2592000,"refresh_token":"refresh_2"}}`
+		}
+		return http.StatusNotFound, ""
+	})
+
+	_, err := m.ExchangeCode("bad")
+	if apiErr, ok := util.AsAPIError(err); !ok || apiErr.Code != 10007 || apiErr.Message != "授权码过期" || apiErr.LogId != "202301010000" {
+		t.Fatalf("ExchangeCode() error = %v", err)
+	}
+	token, err := m.ExchangeCode("code")
+	if err != nil || token.OpenId != "open_id" || token.RefreshToken != "refresh_1" {
+		t.Fatalf("ExchangeCode() = %+v, %v", token, err)
+	}
+	userToken, err := m.ForUser("open_id").GetAccessToken()
+	if err != nil || userToken != "access_2" {
+		t.Fatalf("GetAccessToken() = %s, %v", userToken, err)
+	}
+	if userToken, _ = m.GetAccessToken("open_id"); userToken != "access_2" || refreshes != 1 {
+		t.Fatalf("want cached access_2, got %s after %d refreshes", userToken, refreshes)
+	}
+
+	// refresh_token 剩余有效期小于续期预留时间时自动续期
+	m.RenewReserve = 31 * 24 * time.Hour
+	token, err = m.GetToken("open_id")
+	if err != nil || token.RefreshToken != "refresh_2" || token.AccessToken != "access_2" || renews != 1 {
+		t.Fatalf("GetToken() = %+v, %v after %d renews", token, err, renews)
+	}
+
+	if _, err = m.GetToken("unknown"); !errors.Is(err, ErrUserTokenNotFound) {
+		t.Errorf("want ErrUserTokenNotFound, got %v", err)
+	}
+}
+
+// 测试续期 refresh_token 失败时继续使用未过期的 access_token 并通知回调
+func TestUserTokenManager_RenewFailure(t *testing.T) {
+	var renews, refreshes int32
+	m := newTestUserTokens(func(r *http.Request) (int, string) {
+		switch r.URL.Path {
+		case userRenewRefreshTokenPath:
+			atomic.AddInt32(&renews, 1)
+		case userRefreshTokenPath:
+			atomic.AddInt32(&refreshes, 1)
+		}
+		return http.StatusOK, `{"data":{"error_code":2190002,"description":"系统繁忙"}}`
+	})
+	var failures []string
+	m.OnRefreshError = func(event RefreshEvent) {
+		failures = append(failures, event.Endpoint)
+	}
+	token := UserToken{
+		OpenId:           "open_id",
+		AccessToken:      "access",
+		ExpiresAt:        time.Now().Add(time.Hour),
+		RefreshToken:     "refresh",
+		RefreshExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := m.SetToken(token); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.GetToken("open_id")
+	if err != nil || got.AccessToken != "access" {
+		t.Fatalf("GetToken() = %+v, %v", got, err)
+	}
+	if renews != 1 || refreshes != 0 {
+		t.Errorf("renews = %d, refreshes = %d", renews, refreshes)
+	}
+	if len(failures) != 1 || failures[0] != EndpointUserRenewRefreshToken {
+		t.Errorf("OnRefreshError endpoints = %v", failures)
+	}
+}
+
+// 测试 refresh_token 过期后不再加锁及续期, access_token 未过期时继续使用
+func TestUserTokenManager_RefreshExpired(t *testing.T) {
+	var requests int32
+	m := newTestUserTokens(func(r *http.Request) (int, string) {
+		atomic.AddInt32(&requests, 1)
+		return http.StatusOK, `{"data":{"error_code":0}}`
+	})
+	token := UserToken{
+		OpenId:           "open_id",
+		AccessToken:      "access",
+		ExpiresAt:        time.Now().Add(time.Minute),
+		RefreshToken:     "refresh",
+		RefreshExpiresAt: time.Now().Add(-time.Second),
+	}
+	if err := m.SetToken(token); err != nil {
+		t.Fatal(err)
+	}
+	// 持有该用户的锁, 获取 token 时加锁会等到 context 超时
+	unlock, err := m.lock(context.Background(), "open_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	got, err := m.GetTokenContext(ctx, "open_id")
+	if err != nil || got.AccessToken != "access" {
+		t.Fatalf("GetTokenContext() = %+v, %v", got, err)
+	}
+	if requests != 0 {
+		t.Errorf("want no requests, got %d", requests)
+	}
+}
@@ -0,0 +1,275 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 熔断器处于打开状态, 请求被直接拒绝, 可以用 errors.Is 判断
+var ErrCircuitOpen = errors.New("breaker: circuit breaker is open")
+
+// OpenError 熔断器拒绝请求时返回的错误
+type OpenError struct {
+	Endpoint   string        // 接口名称
+	State      State         // 拒绝时的状态, 打开或半开(探测请求已满)
+	RetryAfter time.Duration // 距离进入半开状态的时间
+}
+
+// Error 实现 error 接口
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s: %s, retry after %s", ErrCircuitOpen, e.Endpoint, e.RetryAfter)
+}
+
+// Is 支持 errors.Is(err, ErrCircuitOpen)
+func (e *OpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// State 熔断器状态
+type State int
+
+const (
+	StateClosed   State = iota // 关闭, 正常放行请求
+	StateOpen                  // 打开, 直接拒绝请求
+	StateHalfOpen              // 半开, 放行少量探测请求
+)
+
+// String 状态名称
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// CircuitBreaker 熔断器接口, 实现此接口可以接入其他熔断组件
+type CircuitBreaker interface {
+	// Allow 判断 endpoint 接口是否可以发起请求, 拒绝时返回 ErrCircuitOpen
+	// 允许时返回的 done 需要在请求结束后调用, err 为需要计入失败的错误
+	Allow(endpoint string) (done func(err error, duration time.Duration), err error)
+}
+
+// Config 熔断配置
+type Config struct {
+	Window           time.Duration                               // 统计的滑动窗口, 默认 10s, 最小 10ms
+	MinRequests      int                                         // 窗口内请求数达到该值才会触发熔断, 默认 20
+	ErrorRate        float64                                     // 失败比例阈值(0-1], 默认 0.5
+	SlowCall         time.Duration                               // 耗时超过该值计为慢调用, 为 0 时不统计慢调用
+	SlowCallRate     float64                                     // 慢调用比例阈值(0-1], 默认 0.5
+	OpenTimeout      time.Duration                               // 打开后经过多久进入半开状态, 默认 30s
+	HalfOpenRequests int                                         // 半开状态允许的探测请求数, 全部成功后关闭, 默认 1
+	OnStateChange    func(endpoint string, from State, to State) // 状态变化的回调, 在锁外同步调用
+}
+
+const (
+	// windowBuckets 滑动窗口切分的桶数
+	windowBuckets = 10
+	// minWindow 最小的滑动窗口, 保证每个桶的宽度不为 0
+	minWindow = windowBuckets * time.Millisecond
+)
+
+// withDefaults 填充默认值
+func (c Config) withDefaults() Config {
+	if c.Window <= 0 {
+		c.Window = 10 * time.Second
+	} else if c.Window < minWindow {
+		c.Window = minWindow
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 20
+	}
+	if c.ErrorRate <= 0 {
+		c.ErrorRate = 0.5
+	}
+	if c.SlowCallRate <= 0 {
+		c.SlowCallRate = 0.5
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 30 * time.Second
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = 1
+	}
+	return c
+}
+
+// bucket 滑动窗口中的一个桶
+type bucket struct {
+	epoch    int64 // 桶对应的时间片
+	total    int
+	failures int
+	slow     int
+}
+
+// circuit 单个接口的熔断状态
+type circuit struct {
+	config     Config
+	state      State
+	generation int // 每次状态变化加一, 用于忽略上一个状态中发起的请求
+	openedAt   time.Time
+	probes     int // 半开状态已放行的探测请求数
+	successes  int // 半开状态成功的探测请求数
+	buckets    [windowBuckets]bucket
+}
+
+// Breaker 按接口区分的熔断器, 统计滑动窗口内的失败比例及慢调用比例
+type Breaker struct {
+	mu       sync.Mutex
+	config   Config
+	configs  map[string]Config
+	circuits map[string]*circuit
+	changes  []func() // 待触发的状态变化回调
+	now      func() time.Time
+}
+
+// New 实例化一个熔断器, config 为未单独配置的接口使用的配置
+func New(config Config) *Breaker {
+	return &Breaker{
+		config:   config.withDefaults(),
+		configs:  map[string]Config{},
+		circuits: map[string]*circuit{},
+		now:      time.Now,
+	}
+}
+
+// SetConfig 设置某个接口的熔断配置, 会重置该接口的状态
+func (b *Breaker) SetConfig(endpoint string, config Config) {
+	b.mu.Lock()
+	defer b.unlock()
+	b.configs[endpoint] = config.withDefaults()
+	delete(b.circuits, endpoint)
+}
+
+// State 获取接口当前的状态
+func (b *Breaker) State(endpoint string) State {
+	b.mu.Lock()
+	defer b.unlock()
+	c := b.circuit(endpoint)
+	b.refresh(endpoint, c, b.now())
+	return c.state
+}
+
+// Allow 判断接口是否可以发起请求
+func (b *Breaker) Allow(endpoint string) (func(err error, duration time.Duration), error) {
+	b.mu.Lock()
+	defer b.unlock()
+	now := b.now()
+	c := b.circuit(endpoint)
+	b.refresh(endpoint, c, now)
+	switch c.state {
+	case StateOpen:
+		return nil, &OpenError{Endpoint: endpoint, State: StateOpen, RetryAfter: c.openedAt.Add(c.config.OpenTimeout).Sub(now)}
+	case StateHalfOpen:
+		if c.probes >= c.config.HalfOpenRequests {
+			return nil, &OpenError{Endpoint: endpoint, State: StateHalfOpen}
+		}
+		c.probes++
+	}
+	generation := c.generation
+	return func(err error, duration time.Duration) {
+		b.mu.Lock()
+		defer b.unlock()
+		b.record(endpoint, c, generation, err != nil, c.config.SlowCall > 0 && duration >= c.config.SlowCall)
+	}, nil
+}
+
+// unlock 解锁后触发期间产生的状态变化回调, 回调中可以再次调用熔断器
+func (b *Breaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+	for _, change := range changes {
+		change()
+	}
+}
+
+// circuit 获取接口的熔断状态, 调用方需持有锁
+func (b *Breaker) circuit(endpoint string) *circuit {
+	c, ok := b.circuits[endpoint]
+	if !ok {
+		config, ok := b.configs[endpoint]
+		if !ok {
+			config = b.config
+		}
+		c = &circuit{config: config}
+		b.circuits[endpoint] = c
+	}
+	return c
+}
+
+// refresh 打开超过 OpenTimeout 后进入半开状态
+func (b *Breaker) refresh(endpoint string, c *circuit, now time.Time) {
+	if c.state == StateOpen && !now.Before(c.openedAt.Add(c.config.OpenTimeout)) {
+		b.transition(endpoint, c, StateHalfOpen, now)
+	}
+}
+
+// record 记录一次请求的结果并判断是否需要切换状态
+func (b *Breaker) record(endpoint string, c *circuit, generation int, failure, slow bool) {
+	if generation != c.generation {
+		return
+	}
+	now := b.now()
+	switch c.state {
+	case StateHalfOpen:
+		if failure || slow {
+			b.transition(endpoint, c, StateOpen, now)
+			return
+		}
+		c.successes++
+		if c.successes >= c.config.HalfOpenRequests {
+			b.transition(endpoint, c, StateClosed, now)
+		}
+	case StateClosed:
+		width := int64(c.config.Window) / windowBuckets
+		epoch := now.UnixNano() / width
+		current := &c.buckets[epoch%windowBuckets]
+		if current.epoch != epoch {
+			*current = bucket{epoch: epoch}
+		}
+		current.total++
+		if failure {
+			current.failures++
+		}
+		if slow {
+			current.slow++
+		}
+		var total, failures, slowCalls int
+		for _, item := range c.buckets {
+			if epoch-item.epoch < windowBuckets {
+				total += item.total
+				failures += item.failures
+				slowCalls += item.slow
+			}
+		}
+		if total < c.config.MinRequests {
+			return
+		}
+		if float64(failures)/float64(total) >= c.config.ErrorRate || (c.config.SlowCall > 0 && float64(slowCalls)/float64(total) >= c.config.SlowCallRate) {
+			b.transition(endpoint, c, StateOpen, now)
+		}
+	}
+}
+
+// transition 切换状态并重置统计
+func (b *Breaker) transition(endpoint string, c *circuit, to State, now time.Time) {
+	from := c.state
+	c.state = to
+	c.generation++
+	c.probes = 0
+	c.successes = 0
+	c.buckets = [windowBuckets]bucket{}
+	if to == StateOpen {
+		c.openedAt = now
+	}
+	if onStateChange := c.config.OnStateChange; onStateChange != nil {
+		b.changes = append(b.changes, func() { onStateChange(endpoint, from, to) })
+	}
+}
@@ -0,0 +1,110 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// call 发起一次请求并记录结果, 被拒绝时返回拒绝的错误
+func call(cb *Breaker, endpoint string, failure error, duration time.Duration) error {
+	done, err := cb.Allow(endpoint)
+	if err != nil {
+		return err
+	}
+	done(failure, duration)
+	return nil
+}
+
+// 测试熔断: 失败比例超过阈值后打开, 超时后半开探测, 探测成功后关闭
+func TestBreaker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var changes []string
+	cb := New(Config{
+		MinRequests: 2,
+		OpenTimeout: 30 * time.Second,
+		OnStateChange: func(endpoint string, from, to State) {
+			changes = append(changes, fmt.Sprintf("%s:%s->%s", endpoint, from, to))
+		},
+	})
+	cb.now = func() time.Time { return now }
+
+	failure := errors.New("failure")
+	for i := 0; i < 2; i++ {
+		if err := call(cb, "queryOrder", failure, 0); err != nil {
+			t.Fatalf("call %d rejected: %v", i, err)
+		}
+	}
+	err := call(cb, "queryOrder", nil, 0)
+	var openErr *OpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) || openErr.Endpoint != "queryOrder" || openErr.RetryAfter != 30*time.Second {
+		t.Fatalf("want ErrCircuitOpen, got %v", err)
+	}
+	// 其他接口不受影响
+	if cb.State("queryRefund") != StateClosed {
+		t.Fatal("queryRefund should be closed")
+	}
+
+	now = now.Add(30 * time.Second)
+	if state := cb.State("queryOrder"); state != StateHalfOpen {
+		t.Fatalf("want half-open, got %s", state)
+	}
+	done, err := cb.Allow("queryOrder")
+	if err != nil {
+		t.Fatalf("half-open probe rejected: %v", err)
+	}
+	// 探测请求已满时拒绝
+	if err = call(cb, "queryOrder", nil, 0); !errors.As(err, &openErr) || openErr.State != StateHalfOpen {
+		t.Fatalf("want half-open rejection, got %v", err)
+	}
+	done(nil, 0)
+	if state := cb.State("queryOrder"); state != StateClosed {
+		t.Fatalf("want closed, got %s", state)
+	}
+	want := []string{"queryOrder:closed->open", "queryOrder:open->half-open", "queryOrder:half-open->closed"}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Errorf("want %v, got %v", want, changes)
+	}
+}
+
+// 测试慢调用比例超过阈值后打开, 窗口外的请求不计入统计
+func TestBreaker_SlowCall(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cb := New(Config{Window: 10 * time.Second, MinRequests: 2, SlowCall: time.Second})
+	cb.now = func() time.Time { return now }
+
+	_ = call(cb, "queryOrder", nil, 2*time.Second)
+	now = now.Add(20 * time.Second)
+	_ = call(cb, "queryOrder", nil, 2*time.Second)
+	if state := cb.State("queryOrder"); state != StateClosed {
+		t.Fatalf("calls outside the window should not count, got %s", state)
+	}
+	_ = call(cb, "queryOrder", nil, 2*time.Second)
+	if state := cb.State("queryOrder"); state != StateOpen {
+		t.Fatalf("want open after slow calls, got %s", state)
+	}
+	// 重新配置后重置状态
+	cb.SetConfig("queryOrder", Config{MinRequests: 2})
+	if state := cb.State("queryOrder"); state != StateClosed {
+		t.Fatalf("want closed after SetConfig, got %s", state)
+	}
+}
+
+// 测试过小的滑动窗口被调整为最小值, 统计时不会除以 0
+func TestBreaker_MinWindow(t *testing.T) {
+	for _, window := range []time.Duration{time.Nanosecond, 9 * time.Nanosecond, time.Millisecond} {
+		cb := New(Config{Window: window, MinRequests: 1})
+		if cb.config.Window != minWindow {
+			t.Errorf("Window %v adjusted to %v, want %v", window, cb.config.Window, minWindow)
+		}
+		done, err := cb.Allow("endpoint")
+		if err != nil {
+			t.Fatal(err)
+		}
+		done(errors.New("failure"), 0)
+		if state := cb.State("endpoint"); state != StateOpen {
+			t.Errorf("Window %v: want open, got %s", window, state)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package cache
 
 import (
+	"container/list"
+	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,71 +16,269 @@ type Cache interface {
 	Delete(key string) error
 }
 
+// ContextCache 支持 context 的缓存接口, redis 等远程缓存可以实现此接口, 以便请求被取消时及时中断
+type ContextCache interface {
+	Cache
+	GetContext(ctx context.Context, key string) interface{}
+	SetContext(ctx context.Context, key string, val interface{}, timeout time.Duration) error
+	IsExistContext(ctx context.Context, key string) bool
+	DeleteContext(ctx context.Context, key string) error
+}
+
+// GetContext 获取缓存的值, 缓存实现了 ContextCache 时透传 context
+func GetContext(ctx context.Context, c Cache, key string) interface{} {
+	if ctx.Err() != nil {
+		return nil
+	}
+	if cc, ok := c.(ContextCache); ok {
+		return cc.GetContext(ctx, key)
+	}
+	return c.Get(key)
+}
+
+// SetContext 设置一个值, 缓存实现了 ContextCache 时透传 context
+func SetContext(ctx context.Context, c Cache, key string, val interface{}, timeout time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cc, ok := c.(ContextCache); ok {
+		return cc.SetContext(ctx, key, val, timeout)
+	}
+	return c.Set(key, val, timeout)
+}
+
+// IsExistContext 判断值是否存在, 缓存实现了 ContextCache 时透传 context
+func IsExistContext(ctx context.Context, c Cache, key string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if cc, ok := c.(ContextCache); ok {
+		return cc.IsExistContext(ctx, key)
+	}
+	return c.IsExist(key)
+}
+
+// DeleteContext 删除一个值, 缓存实现了 ContextCache 时透传 context
+func DeleteContext(ctx context.Context, c Cache, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cc, ok := c.(ContextCache); ok {
+		return cc.DeleteContext(ctx, key)
+	}
+	return c.Delete(key)
+}
+
 // data 存储数据用的
 type data struct {
+	key     string
 	Data    interface{}
 	Expired time.Time
 }
 
+// MemoryOptions 内存缓存的配置
+type MemoryOptions struct {
+	CleanupInterval time.Duration // 后台清理过期 key 的间隔, 为 0 时不启动后台清理, 过期的 key 在读取时删除
+	MaxEntries      int           // 最多缓存的 key 数量, 超出时淘汰最久未使用的 key, 为 0 时不限制
+}
+
+// MemoryStats 内存缓存的统计
+type MemoryStats struct {
+	Hits      int64 // Get 命中的次数
+	Misses    int64 // Get 未命中(含已过期)的次数
+	Evictions int64 // 超出 MaxEntries 淘汰的 key 数量
+	Expired   int64 // 过期删除的 key 数量
+	Entries   int   // 当前缓存的 key 数量, 包含已过期但还未删除的 key
+}
+
 // Memory 实现一个内存缓存
 type Memory struct {
-	sync.Mutex // 读写锁
-	data       map[string]*data
+	hits         int64 // 统计字段使用 atomic 读写, 放在最前面保证 32 位平台上 64 位对齐
+	misses       int64
+	evictions    int64
+	expired      int64
+	sync.RWMutex // 读写锁
+	data         map[string]*list.Element
+	lru          *list.List // 按最近使用排序, 最前面为最近使用的 key
+	maxEntries   int
+	stop         chan struct{} // 关闭后台清理
+	closeOnce    sync.Once
 }
 
-// NewMemory 实例化一个内存缓存器
+// NewMemory 实例化一个内存缓存器, 不限制数量, 不启动后台清理
 func NewMemory() Cache {
-	return &Memory{
-		data: map[string]*data{},
+	return NewMemoryWithOptions(MemoryOptions{})
+}
+
+// NewMemoryWithOptions 按配置实例化一个内存缓存器, 设置了 CleanupInterval 时不再使用需要调用 Close 停止后台清理
+func NewMemoryWithOptions(options MemoryOptions) *Memory {
+	mem := &Memory{
+		data:       map[string]*list.Element{},
+		lru:        list.New(),
+		maxEntries: options.MaxEntries,
+		stop:       make(chan struct{}),
 	}
+	if options.CleanupInterval > 0 {
+		go mem.janitor(options.CleanupInterval)
+	}
+	return mem
 }
 
 // Get 获取缓存的值
 func (mem *Memory) Get(key string) interface{} {
-	if val, ok := mem.data[key]; ok {
-		// 判断缓存是否过期
-		if val.Expired.Before(time.Now()) {
-			// 删除这个key
-			mem.deleteKey(key)
+	// 限制数量时需要更新最近使用的顺序, 使用写锁
+	if mem.maxEntries > 0 {
+		mem.Lock()
+		defer mem.Unlock()
+		elem, ok := mem.data[key]
+		if !ok || mem.expire(elem, time.Now()) {
+			atomic.AddInt64(&mem.misses, 1)
 			return nil
 		}
-		return val.Data
+		mem.lru.MoveToFront(elem)
+		atomic.AddInt64(&mem.hits, 1)
+		return elem.Value.(*data).Data
 	}
-	return nil
+
+	mem.RLock()
+	elem, ok := mem.data[key]
+	var val *data
+	if ok {
+		val = elem.Value.(*data)
+	}
+	mem.RUnlock()
+	if !ok {
+		atomic.AddInt64(&mem.misses, 1)
+		return nil
+	}
+	// 判断缓存是否过期
+	if val.Expired.Before(time.Now()) {
+		// 删除这个key, 加写锁后重新检查, 其他协程可能已经写入了新的值
+		mem.Lock()
+		if elem, ok := mem.data[key]; ok {
+			mem.expire(elem, time.Now())
+		}
+		mem.Unlock()
+		atomic.AddInt64(&mem.misses, 1)
+		return nil
+	}
+	atomic.AddInt64(&mem.hits, 1)
+	return val.Data
 }
 
 // Set 设置一个值
 func (mem *Memory) Set(key string, val interface{}, timeout time.Duration) error {
 	mem.Lock()
 	defer mem.Unlock()
-	mem.data[key] = &data{
+	item := &data{
+		key:     key,
 		Data:    val,
 		Expired: time.Now().Add(timeout),
 	}
+	if elem, ok := mem.data[key]; ok {
+		elem.Value = item
+		mem.lru.MoveToFront(elem)
+		return nil
+	}
+	mem.data[key] = mem.lru.PushFront(item)
+	if mem.maxEntries > 0 && mem.lru.Len() > mem.maxEntries {
+		mem.evict()
+	}
 	return nil
 }
 
-// IsExist 判断值是否存在
+// IsExist 判断值是否存在, 不影响统计及最近使用的顺序
 func (mem *Memory) IsExist(key string) bool {
-	if val, ok := mem.data[key]; ok {
-		if val.Expired.Before(time.Now()) {
-			return false
-		}
-		return true
+	mem.RLock()
+	defer mem.RUnlock()
+	if elem, ok := mem.data[key]; ok {
+		return !elem.Value.(*data).Expired.Before(time.Now())
 	}
 	return false
 }
 
 // Delete 删除一个值
 func (mem *Memory) Delete(key string) error {
-	mem.deleteKey(key)
+	mem.Lock()
+	defer mem.Unlock()
+	if elem, ok := mem.data[key]; ok {
+		mem.remove(elem)
+	}
 	return nil
 }
 
-// deleteKey 删除一个缓存key
-func (mem *Memory) deleteKey(key string) {
+// DeleteExpired 删除所有已过期的 key, 返回删除的数量
+func (mem *Memory) DeleteExpired() int {
 	mem.Lock()
 	defer mem.Unlock()
-	delete(mem.data, key)
-	return
+	now := time.Now()
+	count := 0
+	for elem := mem.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		if mem.expire(elem, now) {
+			count++
+		}
+		elem = prev
+	}
+	return count
+}
+
+// Stats 获取统计信息
+func (mem *Memory) Stats() MemoryStats {
+	mem.RLock()
+	entries := len(mem.data)
+	mem.RUnlock()
+	return MemoryStats{
+		Hits:      atomic.LoadInt64(&mem.hits),
+		Misses:    atomic.LoadInt64(&mem.misses),
+		Evictions: atomic.LoadInt64(&mem.evictions),
+		Expired:   atomic.LoadInt64(&mem.expired),
+		Entries:   entries,
+	}
+}
+
+// Close 停止后台清理, 可以重复调用, 关闭后仍然可以读写
+func (mem *Memory) Close() error {
+	mem.closeOnce.Do(func() { close(mem.stop) })
+	return nil
+}
+
+// janitor 定时删除过期的 key
+func (mem *Memory) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mem.stop:
+			return
+		case <-ticker.C:
+			mem.DeleteExpired()
+		}
+	}
+}
+
+// expire key 在 now 时已过期时删除, 调用方需持有写锁
+func (mem *Memory) expire(elem *list.Element, now time.Time) bool {
+	if !elem.Value.(*data).Expired.Before(now) {
+		return false
+	}
+	mem.remove(elem)
+	atomic.AddInt64(&mem.expired, 1)
+	return true
+}
+
+// evict 淘汰最久未使用的 key, 已过期的计入过期删除, 调用方需持有写锁
+func (mem *Memory) evict() {
+	for mem.lru.Len() > mem.maxEntries {
+		if elem := mem.lru.Back(); !mem.expire(elem, time.Now()) {
+			mem.remove(elem)
+			atomic.AddInt64(&mem.evictions, 1)
+		}
+	}
+}
+
+// remove 删除一个缓存key, 调用方需持有写锁
+func (mem *Memory) remove(elem *list.Element) {
+	mem.lru.Remove(elem)
+	delete(mem.data, elem.Value.(*data).key)
 }
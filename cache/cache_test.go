@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试读写/过期/统计
+func TestMemory(t *testing.T) {
+	mem := NewMemory().(*Memory)
+	if mem.Get("key") != nil || mem.IsExist("key") {
+		t.Fatal("want empty cache")
+	}
+	_ = mem.Set("key", "val", time.Hour)
+	_ = mem.Set("expired", "val", -time.Second)
+	if mem.Get("key") != "val" || !mem.IsExist("key") {
+		t.Fatal("want cached key")
+	}
+	if mem.IsExist("expired") || mem.Get("expired") != nil {
+		t.Fatal("want expired key missing")
+	}
+	_ = mem.Delete("key")
+	if mem.Get("key") != nil {
+		t.Fatal("want deleted key missing")
+	}
+	want := MemoryStats{Hits: 1, Misses: 3, Expired: 1}
+	if stats := mem.Stats(); stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+// 测试超出数量时淘汰最久未使用的 key
+func TestMemory_MaxEntries(t *testing.T) {
+	mem := NewMemoryWithOptions(MemoryOptions{MaxEntries: 2})
+	_ = mem.Set("a", 1, time.Hour)
+	_ = mem.Set("b", 2, time.Hour)
+	mem.Get("a")
+	_ = mem.Set("c", 3, time.Hour)
+	if mem.IsExist("b") || mem.Get("a") != 1 || mem.Get("c") != 3 {
+		t.Fatal("want least recently used key b evicted")
+	}
+	// 覆盖已有的 key 不淘汰
+	_ = mem.Set("a", 4, time.Hour)
+	if stats := mem.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	// 已过期的 key 计入过期删除
+	_ = mem.Set("d", 5, -time.Second)
+	_ = mem.Set("e", 6, time.Hour)
+	_ = mem.Set("f", 7, time.Hour)
+	if stats := mem.Stats(); stats.Evictions != 3 || stats.Expired != 1 || stats.Entries != 2 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+// 测试后台清理过期的 key
+func TestMemory_Janitor(t *testing.T) {
+	mem := NewMemoryWithOptions(MemoryOptions{CleanupInterval: 10 * time.Millisecond})
+	defer mem.Close()
+	_ = mem.Set("expired", "val", time.Millisecond)
+	_ = mem.Set("key", "val", time.Hour)
+	deadline := time.Now().Add(time.Second)
+	for mem.Stats().Entries != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("want expired key cleaned up, got %+v", mem.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := mem.Stats(); stats.Expired != 1 || stats.Misses != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	if err := mem.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if mem.Get("key") != "val" {
+		t.Error("want cache usable after Close")
+	}
+}
+
+// 测试并发读写, 需要配合 -race 运行
+func TestMemory_Concurrent(t *testing.T) {
+	for name, options := range map[string]MemoryOptions{
+		"unbounded": {CleanupInterval: time.Millisecond},
+		"bounded":   {CleanupInterval: time.Millisecond, MaxEntries: 8},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mem := NewMemoryWithOptions(options)
+			defer mem.Close()
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 500; j++ {
+						key := fmt.Sprintf("key_%d", j%16)
+						switch (i + j) % 4 {
+						case 0:
+							_ = mem.Set(key, j, time.Duration(j%3)*time.Millisecond)
+						case 1:
+							mem.Get(key)
+						case 2:
+							mem.IsExist(key)
+						default:
+							_ = mem.Delete(key)
+						}
+					}
+				}(i)
+			}
+			wg.Wait()
+			if stats := mem.Stats(); stats.Hits+stats.Misses != 8*500/4 {
+				t.Errorf("Stats() = %+v", stats)
+			}
+			if options.MaxEntries > 0 && mem.Stats().Entries > options.MaxEntries {
+				t.Errorf("want at most %d entries, got %d", options.MaxEntries, mem.Stats().Entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// token-server 小程序 access_token 服务, 统一向平台获取 token, 其他服务通过 http 获取
+//
+// 小程序配置从 json 文件(-config)或环境变量(DOUYIN_APP_ID/DOUYIN_APPS 等, 见 LoadAppConfigsFromEnv)读取
+// 共享密钥从环境变量 TOKEN_SERVER_SECRET 读取, 避免出现在进程参数中
+//
+//	TOKEN_SERVER_SECRET=secret DOUYIN_APP_ID=tt123 DOUYIN_APP_SECRET=xxx token-server -addr :8080
+//	curl -H 'Authorization: Bearer secret' http://127.0.0.1:8080/token/tt123
+//
+// Go 服务可以使用 access_token.NewRemoteAccessToken 作为 DouYinOpenApiConfig.AccessToken
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	douyinOpenapi "github.com/38888/douyin-openapi"
+	accessToken "github.com/38888/douyin-openapi/access-token"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "监听地址")
+	configFile := flag.String("config", "", "小程序配置 json 文件, 为空时从环境变量读取")
+	envPrefix := flag.String("env-prefix", douyinOpenapi.DefaultEnvPrefix, "小程序配置的环境变量前缀")
+	flag.Parse()
+
+	secret := os.Getenv("TOKEN_SERVER_SECRET")
+	if secret == "" {
+		log.Fatal("TOKEN_SERVER_SECRET is required")
+	}
+	var apps []douyinOpenapi.AppConfig
+	var err error
+	if *configFile != "" {
+		apps, err = douyinOpenapi.LoadAppConfigsFile(*configFile)
+	} else {
+		apps, err = douyinOpenapi.LoadAppConfigsFromEnv(*envPrefix)
+	}
+	if err != nil {
+		log.Fatalf("load app configs: %v", err)
+	}
+
+	refresher := &accessToken.RefresherConfig{}
+	manager := douyinOpenapi.NewManager(douyinOpenapi.DouYinOpenApiConfig{
+		AccessTokenRefresher: refresher,
+		TokenRefreshHooks: accessToken.RefreshHooks{
+			OnRefresh: func(event accessToken.RefreshEvent) {
+				log.Printf("refreshed %s token for %s in %v, expires at %v", event.Endpoint, event.AppId, event.Latency, event.Token.ExpiresAt)
+			},
+			OnRefreshError: func(event accessToken.RefreshEvent) {
+				log.Printf("refresh %s token for %s failed after %v: %v", event.Endpoint, event.AppId, event.Latency, event.Err)
+			},
+		},
+	})
+	defer func() { _ = manager.Close() }()
+	server := accessToken.NewTokenServer(secret)
+	server.Refresher = refresher
+	for _, app := range apps {
+		config := app.Config()
+		if err = config.Validate(douyinOpenapi.FeatureAccessToken); err != nil {
+			log.Fatalf("app %s: %v", app.AppId, err)
+		}
+		manager.Register(config)
+		openApi, err := manager.Get(app.AppId)
+		if err != nil {
+			log.Fatalf("app %s: %v", app.AppId, err)
+		}
+		server.Register(app.AppId, openApi.Config.AccessToken)
+		log.Printf("serving token for %s", app.AppId)
+	}
+
+	httpServer := &http.Server{Addr: *addr, Handler: server, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("listen: %v", err)
+		}
+	}()
+	log.Printf("token server listening on %s", *addr)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err = httpServer.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+package component
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	accessToken "github.com/38888/douyin-openapi/access-token"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/util"
+	"hash/fnv"
+	"time"
+)
+
+// authorizerRefreshTTL 平台未返回 refresh_token 有效期时按 30 天保存授权信息
+const authorizerRefreshTTL = 30 * 24 * time.Hour
+
+// keyLockCount 按 key 分段加锁的段数
+const keyLockCount = 64
+
+// keyLocks 按 key 分段的锁
+type keyLocks [keyLockCount]chan struct{}
+
+// newKeyLocks 实例化分段锁
+func newKeyLocks() *keyLocks {
+	var locks keyLocks
+	for i := range locks {
+		locks[i] = make(chan struct{}, 1)
+	}
+	return &locks
+}
+
+// lock 对 key 加锁
+func (l *keyLocks) lock(ctx context.Context, key string) (func(), error) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	ch := l[h.Sum32()%keyLockCount]
+	select {
+	case ch <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return func() { <-ch }, nil
+}
+
+// Permission 小程序授权给第三方平台的权限集
+type Permission struct {
+	Id          int    `json:"id"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+}
+
+// AuthorizerToken 授权小程序的 token
+type AuthorizerToken struct {
+	AuthorizerAppId  string       `json:"authorizer_appid"`   // 授权小程序的 appid
+	AccessToken      string       `json:"access_token"`       // authorizer_access_token
+	ExpiresAt        time.Time    `json:"expires_at"`         // authorizer_access_token 的过期时间
+	RefreshToken     string       `json:"refresh_token"`      // authorizer_refresh_token
+	RefreshExpiresAt time.Time    `json:"refresh_expires_at"` // authorizer_refresh_token 的过期时间
+	Permissions      []Permission `json:"permissions"`        // 授权的权限集
+}
+
+// Expired authorizer_access_token 在 reserve 时间内是否过期
+func (t AuthorizerToken) Expired(reserve time.Duration) bool {
+	return !time.Now().Add(reserve).Before(t.ExpiresAt)
+}
+
+// ResAuthorizerToken 获取/刷新授权小程序 token 的返回结构体
+type ResAuthorizerToken struct {
+	Errno                  int          `json:"errno,omitempty"`
+	Message                string       `json:"message,omitempty"`
+	AuthorizerAccessToken  string       `json:"authorizer_access_token,omitempty"`
+	ExpiresIn              int          `json:"expires_in,omitempty"`
+	AuthorizerRefreshToken string       `json:"authorizer_refresh_token,omitempty"`
+	RefreshExpiresIn       int          `json:"refresh_expires_in,omitempty"`
+	AuthorizerAppId        string       `json:"authorizer_appid,omitempty"`
+	AuthorizePermission    []Permission `json:"authorize_permission,omitempty"`
+}
+
+// authorizerCacheKey 授权小程序 token 的缓存key
+func (c *Component) authorizerCacheKey(appId string) string {
+	return fmt.Sprintf("douyin_openapi_authorizer_token_%s_%s", c.ComponentAppId, appId)
+}
+
+// ExchangeAuthorizationCode 使用授权回调中的 authorization_code 获取授权小程序的 token 并保存
+func (c *Component) ExchangeAuthorizationCode(code string) (AuthorizerToken, error) {
+	return c.ExchangeAuthorizationCodeContext(context.Background(), code)
+}
+
+// ExchangeAuthorizationCodeContext 使用 authorization_code 获取授权小程序的 token 并保存, 支持传入 context
+func (c *Component) ExchangeAuthorizationCodeContext(ctx context.Context, code string) (token AuthorizerToken, err error) {
+	query, err := c.componentQuery(ctx)
+	if err != nil {
+		return
+	}
+	query.Set("authorization_code", code)
+	query.Set("grant_type", "app_to_tp_authorization_code")
+	var res ResAuthorizerToken
+	now := time.Now()
+	// authorization_code 只能使用一次, 不重试
+	err = c.do(ctx, nil, &util.Call{
+		Endpoint: EndpointAuthorizerToken,
+		Method:   "GET",
+		URL:      c.GetEnvironment().Url(util.FamilyThirdParty, authorizerTokenPath),
+		Query:    query,
+	}, &res)
+	if err != nil {
+		return
+	}
+	token = AuthorizerToken{AuthorizerAppId: res.AuthorizerAppId}
+	token = updateAuthorizerToken(now, token, res)
+	err = c.SetAuthorizerTokenContext(ctx, token)
+	return
+}
+
+// updateAuthorizerToken 根据接口返回值更新 token, 未返回的字段保持不变
+func updateAuthorizerToken(now time.Time, token AuthorizerToken, res ResAuthorizerToken) AuthorizerToken {
+	if res.AuthorizerAppId != "" {
+		token.AuthorizerAppId = res.AuthorizerAppId
+	}
+	token.AccessToken = res.AuthorizerAccessToken
+	token.ExpiresAt = now.Add(time.Duration(res.ExpiresIn) * time.Second)
+	if res.AuthorizerRefreshToken != "" {
+		token.RefreshToken = res.AuthorizerRefreshToken
+		token.RefreshExpiresAt = now.Add(authorizerRefreshTTL)
+		if res.RefreshExpiresIn > 0 {
+			token.RefreshExpiresAt = now.Add(time.Duration(res.RefreshExpiresIn) * time.Second)
+		}
+	}
+	if res.AuthorizePermission != nil {
+		token.Permissions = res.AuthorizePermission
+	}
+	return token
+}
+
+// GetAuthorizerToken 获取授权小程序的 token, authorizer_access_token 即将过期时自动刷新
+func (c *Component) GetAuthorizerToken(appId string) (AuthorizerToken, error) {
+	return c.GetAuthorizerTokenContext(context.Background(), appId)
+}
+
+// GetAuthorizerTokenContext 获取授权小程序的 token, 支持传入 context
+// 没有该小程序的授权信息时返回 ErrAuthorizerNotFound
+func (c *Component) GetAuthorizerTokenContext(ctx context.Context, appId string) (AuthorizerToken, error) {
+	token, err := c.LoadAuthorizerTokenContext(ctx, appId)
+	if err != nil || !token.Expired(tokenReserve) {
+		return token, err
+	}
+	unlock, err := c.authorizerLocks.lock(ctx, appId)
+	if err != nil {
+		return AuthorizerToken{}, err
+	}
+	defer unlock()
+	// 双捡防止重复刷新
+	if token, err = c.LoadAuthorizerTokenContext(ctx, appId); err != nil || !token.Expired(tokenReserve) {
+		return token, err
+	}
+	return c.refreshAuthorizer(ctx, token)
+}
+
+// RefreshAuthorizerToken 立即刷新授权小程序的 authorizer_access_token
+func (c *Component) RefreshAuthorizerToken(appId string) (AuthorizerToken, error) {
+	return c.RefreshAuthorizerTokenContext(context.Background(), appId)
+}
+
+// RefreshAuthorizerTokenContext 立即刷新授权小程序的 authorizer_access_token, 支持传入 context
+func (c *Component) RefreshAuthorizerTokenContext(ctx context.Context, appId string) (AuthorizerToken, error) {
+	unlock, err := c.authorizerLocks.lock(ctx, appId)
+	if err != nil {
+		return AuthorizerToken{}, err
+	}
+	defer unlock()
+	token, err := c.LoadAuthorizerTokenContext(ctx, appId)
+	if err != nil {
+		return AuthorizerToken{}, err
+	}
+	return c.refreshAuthorizer(ctx, token)
+}
+
+// refreshAuthorizer 使用 authorizer_refresh_token 刷新并保存, 调用方需持有该小程序的锁
+func (c *Component) refreshAuthorizer(ctx context.Context, token AuthorizerToken) (AuthorizerToken, error) {
+	query, err := c.componentQuery(ctx)
+	if err != nil {
+		return AuthorizerToken{}, err
+	}
+	query.Set("authorizer_refresh_token", token.RefreshToken)
+	query.Set("grant_type", "app_to_tp_refresh_token")
+	var res ResAuthorizerToken
+	now := time.Now()
+	err = c.do(ctx, c.RetryPolicy, &util.Call{
+		Endpoint: EndpointAuthorizerToken,
+		Method:   "GET",
+		URL:      c.GetEnvironment().Url(util.FamilyThirdParty, authorizerTokenPath),
+		Query:    query,
+	}, &res)
+	event := accessToken.RefreshEvent{Endpoint: EndpointAuthorizerToken, AppId: token.AuthorizerAppId, Latency: time.Since(now), Err: err}
+	defer func() { c.Emit(event) }()
+	if c.Metrics != nil {
+		c.Metrics.ObserveTokenRefresh(token.AuthorizerAppId, event.Latency, err)
+	}
+	if err != nil {
+		return AuthorizerToken{}, err
+	}
+	token = updateAuthorizerToken(now, token, res)
+	if event.Err = c.SetAuthorizerTokenContext(ctx, token); event.Err != nil {
+		return AuthorizerToken{}, event.Err
+	}
+	event.Token = accessToken.TokenInfo{AccessToken: token.AccessToken, IssuedAt: now, ExpiresAt: token.ExpiresAt}
+	return token, nil
+}
+
+// LoadAuthorizerToken 从缓存读取授权小程序的 token, 不刷新
+func (c *Component) LoadAuthorizerToken(appId string) (AuthorizerToken, error) {
+	return c.LoadAuthorizerTokenContext(context.Background(), appId)
+}
+
+// LoadAuthorizerTokenContext 从缓存读取授权小程序的 token, 不刷新, 支持传入 context
+// token 以 json 字符串保存, 以便 redis 等远程缓存序列化
+func (c *Component) LoadAuthorizerTokenContext(ctx context.Context, appId string) (token AuthorizerToken, err error) {
+	val := cache.GetContext(ctx, c.Cache, c.authorizerCacheKey(appId))
+	if c.Metrics != nil {
+		c.Metrics.ObserveCache(EndpointAuthorizerToken, val != nil)
+	}
+	var data []byte
+	switch v := val.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		err = fmt.Errorf("%w: %s", ErrAuthorizerNotFound, appId)
+		return
+	}
+	err = json.Unmarshal(data, &token)
+	return
+}
+
+// SetAuthorizerToken 保存授权小程序的 token, 如从其他系统迁移的 authorizer_refresh_token
+func (c *Component) SetAuthorizerToken(token AuthorizerToken) error {
+	return c.SetAuthorizerTokenContext(context.Background(), token)
+}
+
+// SetAuthorizerTokenContext 保存授权小程序的 token, 缓存有效期与 authorizer_refresh_token 一致, 支持传入 context
+func (c *Component) SetAuthorizerTokenContext(ctx context.Context, token AuthorizerToken) error {
+	if token.AuthorizerAppId == "" {
+		return fmt.Errorf("component: authorizer appid is empty")
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	timeout := time.Until(token.RefreshExpiresAt)
+	if expires := time.Until(token.ExpiresAt); expires > timeout {
+		timeout = expires
+	}
+	return cache.SetContext(ctx, c.Cache, c.authorizerCacheKey(token.AuthorizerAppId), string(data), timeout)
+}
+
+// DeleteAuthorizer 删除授权小程序的 token, 如收到取消授权的推送
+func (c *Component) DeleteAuthorizer(appId string) error {
+	return c.DeleteAuthorizerContext(context.Background(), appId)
+}
+
+// DeleteAuthorizerContext 删除授权小程序的 token, 支持传入 context
+func (c *Component) DeleteAuthorizerContext(ctx context.Context, appId string) error {
+	return cache.DeleteContext(ctx, c.Cache, c.authorizerCacheKey(appId))
+}
+
+// AuthorizerAccessToken 返回授权小程序的 AccessToken, 用于以第三方平台身份调用该小程序的接口
+//
+//	openApi := douyin_openapi.NewDouYinOpenApi(douyin_openapi.DouYinOpenApiConfig{
+//		AppId:       appId,
+//		AccessToken: component.AuthorizerAccessToken(appId),
+//	})
+func (c *Component) AuthorizerAccessToken(appId string) accessToken.AccessToken {
+	return &authorizerAccessToken{component: c, appId: appId}
+}
+
+// authorizerAccessToken 单个授权小程序的 AccessToken
+type authorizerAccessToken struct {
+	component *Component
+	appId     string
+}
+
+// GetCacheKey 获取缓存key
+func (a *authorizerAccessToken) GetCacheKey() string {
+	return a.component.authorizerCacheKey(a.appId)
+}
+
+// SetCacheKey 授权小程序 token 的缓存key由第三方平台及小程序的 appid 决定, 不支持单独设置
+func (a *authorizerAccessToken) SetCacheKey(string) {}
+
+// GetAccessToken 获取token
+func (a *authorizerAccessToken) GetAccessToken() (string, error) {
+	return a.GetAccessTokenContext(context.Background())
+}
+
+// GetAccessTokenContext 获取token, 支持传入 context
+func (a *authorizerAccessToken) GetAccessTokenContext(ctx context.Context) (string, error) {
+	token, err := a.component.GetAuthorizerTokenContext(ctx, a.appId)
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// GetTokenInfoContext 获取token及其过期时间, 授权小程序的 token 不记录获取时间
+func (a *authorizerAccessToken) GetTokenInfoContext(ctx context.Context) (accessToken.TokenInfo, error) {
+	token, err := a.component.GetAuthorizerTokenContext(ctx, a.appId)
+	if err != nil {
+		return accessToken.TokenInfo{}, err
+	}
+	return accessToken.TokenInfo{AccessToken: token.AccessToken, ExpiresAt: token.ExpiresAt}, nil
+}
+
+// ForceRefreshContext 立即使用 authorizer_refresh_token 刷新
+func (a *authorizerAccessToken) ForceRefreshContext(ctx context.Context) (accessToken.TokenInfo, error) {
+	token, err := a.component.RefreshAuthorizerTokenContext(ctx, a.appId)
+	if err != nil {
+		return accessToken.TokenInfo{}, err
+	}
+	return accessToken.TokenInfo{AccessToken: token.AccessToken, ExpiresAt: token.ExpiresAt}, nil
+}
+
+// InvalidateContext 平台拒绝了 token 时使用 authorizer_refresh_token 刷新, 已被其他调用方刷新时不做任何事
+func (a *authorizerAccessToken) InvalidateContext(ctx context.Context, token string) error {
+	unlock, err := a.component.authorizerLocks.lock(ctx, a.appId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, err := a.component.LoadAuthorizerTokenContext(ctx, a.appId)
+	if err != nil || current.AccessToken != token {
+		return err
+	}
+	_, err = a.component.refreshAuthorizer(ctx, current)
+	return err
+}
+
+// do 按 policy 请求第三方平台接口并解析返回值, policy 为空时不重试, errno 非 0 时返回 APIError
+func (c *Component) do(ctx context.Context, policy *util.RetryPolicy, call *util.Call, response interface{}) error {
+	return policy.Do(ctx, call.Endpoint, func(ctx context.Context) error {
+		res, err := c.HttpClient.Execute(ctx, call)
+		if err != nil {
+			return util.WrapError(call.Endpoint, err)
+		}
+		if err = util.CheckResponse(call.Endpoint, res); err != nil {
+			return err
+		}
+		if err = json.Unmarshal(res.Body, response); err != nil {
+			return &util.APIError{Endpoint: call.Endpoint, StatusCode: res.StatusCode, Err: err}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,55 @@
+package component
+
+import (
+	douyin "github.com/38888/douyin-openapi"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/util"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试以第三方平台授权小程序的身份调用接口, 即将过期的授权小程序 token 在请求前刷新
+func TestAuthorizerAccessToken_OpenApi(t *testing.T) {
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body := `{"errno":0}`
+		switch r.URL.Path {
+		case "/openapi/v1/auth/tp/token":
+			body = `{"component_access_token":"component_1","expires_in":7200}`
+		case "/openapi/v1/oauth/token":
+			body = `{"authorizer_access_token":"authorizer_2","expires_in":7200,"authorizer_refresh_token":"refresh_2"}`
+		case "/api/v2/tags/text/antidirt":
+			if r.Header.Get("X-Token") != "authorizer_2" {
+				body = `{"code":401,"message":"bad token"}`
+				break
+			}
+			body = `{"log_id":"1","data":[{"code":0,"task_id":"task"}]}`
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: r}, nil
+	})
+	comp := NewComponent("tp_appid", "tp_secret", "tp_token", "", cache.NewMemory())
+	comp.HttpClient = util.NewClientWithTransport(transport)
+	comp.Environment = util.NewEnvironment("test", "http://tp.test")
+	_ = comp.SetTicket("ticket")
+	_ = comp.SetAuthorizerToken(AuthorizerToken{
+		AuthorizerAppId:  "tt_authorizer",
+		AccessToken:      "authorizer_1",
+		ExpiresAt:        time.Now().Add(time.Minute),
+		RefreshToken:     "refresh_1",
+		RefreshExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	openApi := douyin.NewDouYinOpenApi(douyin.DouYinOpenApiConfig{
+		AppId:       "tt_authorizer",
+		AccessToken: comp.AuthorizerAccessToken("tt_authorizer"),
+		Transport:   transport,
+	})
+	if _, err := openApi.SecurityCensorText("text"); err != nil {
+		t.Fatalf("SecurityCensorText() error = %v", err)
+	}
+	if token, _ := comp.LoadAuthorizerToken("tt_authorizer"); token.RefreshToken != "refresh_2" {
+		t.Errorf("want refreshed authorizer token, got %+v", token)
+	}
+}
@@ -0,0 +1,295 @@
+package component
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	accessToken "github.com/38888/douyin-openapi/access-token"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/metrics"
+	"github.com/38888/douyin-openapi/sign"
+	"github.com/38888/douyin-openapi/util"
+	"net/url"
+	"time"
+)
+
+// 第三方平台接口名称
+const (
+	EndpointComponentAccessToken = "componentAccessToken" // 获取 component_access_token
+	EndpointPreAuthCode          = "preAuthCode"          // 获取预授权码
+	EndpointAuthorizerToken      = "authorizerToken"      // 获取/刷新授权小程序的 authorizer_access_token
+)
+
+// 第三方平台接口地址, 域名由 Environment 的第三方平台分组决定
+const (
+	componentAccessTokenPath = "/openapi/v1/auth/tp/token"
+	preAuthCodePath          = "/openapi/v2/auth/pre_auth_code"
+	authorizerTokenPath      = "/openapi/v1/oauth/token"
+	authorizationPath        = "/mappconsole/tp/authorization"
+)
+
+const (
+	// ticketTTL component_ticket 的缓存时间, 平台每 10 分钟推送一次
+	ticketTTL = 12 * time.Hour
+	// tokenReserve 缓存 component_access_token/authorizer_access_token 时在有效期基础上预留的时间
+	tokenReserve = 5 * time.Minute
+)
+
+var (
+	// ErrTicketNotFound 还没有收到平台推送的 component_ticket
+	ErrTicketNotFound = errors.New("component: component_ticket not found")
+	// ErrAuthorizerNotFound 没有该小程序的授权信息, 需要小程序管理员重新授权
+	ErrAuthorizerNotFound = errors.New("component: authorizer not found")
+)
+
+// Component 小程序第三方平台, 管理 component_ticket/component_access_token/预授权码及授权小程序的 token
+// ticket 及 token 均保存在 Cache 中, 多个实例共享缓存时可以共用平台推送的 ticket
+type Component struct {
+	ComponentAppId     string            // 第三方平台 appid
+	ComponentAppSecret string            // 第三方平台 appsecret
+	Token              string            // 消息校验 Token, 用于校验推送消息的签名
+	EncodingAESKey     string            // 消息加解密 Key
+	Cache              cache.Cache       // 缓存组件
+	Environment        util.Environment  // 接口环境, 为空时使用正式环境
+	HttpClient         *util.Client      // http 请求执行器, 为空时使用默认执行器
+	RetryPolicy        *util.RetryPolicy // 获取 token 失败时的重试策略, 为空时不重试
+	Metrics            metrics.Metrics   // 监控指标收集, 为空时不记录
+	tokenLock          chan struct{}     // 获取 component_access_token 的锁
+	authorizerLocks    *keyLocks         // 按授权小程序加锁, 防止并发刷新同一个小程序的 token
+
+	// RefreshHooks 获取 component_access_token 及刷新授权小程序 token 的回调
+	accessToken.RefreshHooks
+}
+
+// NewComponent 实例化第三方平台
+func NewComponent(componentAppId, componentAppSecret, token, encodingAESKey string, cache cache.Cache) *Component {
+	if cache == nil {
+		panic(any("cache is need"))
+	}
+	return &Component{
+		ComponentAppId:     componentAppId,
+		ComponentAppSecret: componentAppSecret,
+		Token:              token,
+		EncodingAESKey:     encodingAESKey,
+		Cache:              cache,
+		Environment:        util.ProductionEnvironment(),
+		RetryPolicy:        util.DefaultRetryPolicy(),
+		tokenLock:          make(chan struct{}, 1),
+		authorizerLocks:    newKeyLocks(),
+	}
+}
+
+// GetEnvironment 获取接口环境, 未设置时使用正式环境
+func (c *Component) GetEnvironment() util.Environment {
+	if c.Environment.BaseUrls == nil {
+		return util.ProductionEnvironment()
+	}
+	return c.Environment
+}
+
+// ticketCacheKey component_ticket 的缓存key
+func (c *Component) ticketCacheKey() string {
+	return fmt.Sprintf("douyin_openapi_component_ticket_%s", c.ComponentAppId)
+}
+
+// tokenCacheKey component_access_token 的缓存key
+func (c *Component) tokenCacheKey() string {
+	return fmt.Sprintf("douyin_openapi_component_access_token_%s", c.ComponentAppId)
+}
+
+// PushMessage 平台推送的加密消息
+type PushMessage struct {
+	Nonce        string `json:"Nonce"`
+	TimeStamp    string `json:"TimeStamp"`
+	Encrypt      string `json:"Encrypt"`
+	MsgSignature string `json:"MsgSignature"`
+}
+
+// Message 解密后的推送消息, Raw 为解密后的原始内容, 可以按需解析其他字段
+type Message struct {
+	MsgType    string          `json:"MsgType"`    // 消息类型, component_ticket 推送为 Ticket
+	Ticket     string          `json:"Ticket"`     // component_ticket
+	CreateTime int64           `json:"CreateTime"` // 推送时间
+	Raw        json.RawMessage `json:"-"`
+}
+
+// MsgTypeTicket component_ticket 推送的消息类型
+const MsgTypeTicket = "Ticket"
+
+// HandlePush 处理平台的推送: 校验签名并解密, component_ticket 推送会保存到缓存
+// body 为推送的原始请求内容, 处理成功后需要返回 success
+func (c *Component) HandlePush(body []byte) (Message, error) {
+	return c.HandlePushContext(context.Background(), body)
+}
+
+// HandlePushContext 处理平台的推送, 支持传入 context
+func (c *Component) HandlePushContext(ctx context.Context, body []byte) (message Message, err error) {
+	var push PushMessage
+	if err = json.Unmarshal(body, &push); err != nil {
+		return
+	}
+	if err = (sign.SHA1Token{Token: c.Token}).Verify(push.MsgSignature, push.TimeStamp, push.Nonce, push.Encrypt); err != nil {
+		return
+	}
+	raw, appId, err := DecryptMessage(c.EncodingAESKey, push.Encrypt)
+	if err != nil {
+		return
+	}
+	if appId != c.ComponentAppId {
+		err = fmt.Errorf("%w: unexpected component appid %s", ErrDecrypt, appId)
+		return
+	}
+	if err = json.Unmarshal(raw, &message); err != nil {
+		return
+	}
+	message.Raw = raw
+	if message.MsgType == MsgTypeTicket && message.Ticket != "" {
+		err = c.SetTicketContext(ctx, message.Ticket)
+	}
+	return
+}
+
+// SetTicket 保存 component_ticket, 如从其他系统同步的 ticket
+func (c *Component) SetTicket(ticket string) error {
+	return c.SetTicketContext(context.Background(), ticket)
+}
+
+// SetTicketContext 保存 component_ticket, 支持传入 context
+func (c *Component) SetTicketContext(ctx context.Context, ticket string) error {
+	return cache.SetContext(ctx, c.Cache, c.ticketCacheKey(), ticket, ticketTTL)
+}
+
+// GetTicket 获取最近一次推送的 component_ticket, 未收到推送时返回 ErrTicketNotFound
+func (c *Component) GetTicket() (string, error) {
+	return c.GetTicketContext(context.Background())
+}
+
+// GetTicketContext 获取最近一次推送的 component_ticket, 支持传入 context
+func (c *Component) GetTicketContext(ctx context.Context) (string, error) {
+	ticket, _ := cache.GetContext(ctx, c.Cache, c.ticketCacheKey()).(string)
+	if ticket == "" {
+		return "", ErrTicketNotFound
+	}
+	return ticket, nil
+}
+
+// ResComponentAccessToken 获取 component_access_token 的返回结构体
+type ResComponentAccessToken struct {
+	Errno                int    `json:"errno,omitempty"`
+	Message              string `json:"message,omitempty"`
+	ComponentAccessToken string `json:"component_access_token,omitempty"`
+	ExpiresIn            int    `json:"expires_in,omitempty"`
+}
+
+// GetComponentAccessToken 获取 component_access_token, 缓存过期时使用 component_ticket 重新获取
+func (c *Component) GetComponentAccessToken() (string, error) {
+	return c.GetComponentAccessTokenContext(context.Background())
+}
+
+// GetComponentAccessTokenContext 获取 component_access_token, 支持传入 context
+func (c *Component) GetComponentAccessTokenContext(ctx context.Context) (string, error) {
+	val := cache.GetContext(ctx, c.Cache, c.tokenCacheKey())
+	if c.Metrics != nil {
+		c.Metrics.ObserveCache(EndpointComponentAccessToken, val != nil)
+	}
+	if val != nil {
+		return val.(string), nil
+	}
+
+	select {
+	case c.tokenLock <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-c.tokenLock }()
+
+	// 双捡防止重复获取
+	if val := cache.GetContext(ctx, c.Cache, c.tokenCacheKey()); val != nil {
+		return val.(string), nil
+	}
+	ticket, err := c.GetTicketContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	var res ResComponentAccessToken
+	start := time.Now()
+	err = c.do(ctx, c.RetryPolicy, &util.Call{
+		Endpoint: EndpointComponentAccessToken,
+		Method:   "GET",
+		URL:      c.GetEnvironment().Url(util.FamilyThirdParty, componentAccessTokenPath),
+		Query: url.Values{
+			"component_appid":     {c.ComponentAppId},
+			"component_appsecret": {c.ComponentAppSecret},
+			"component_ticket":    {ticket},
+		},
+	}, &res)
+	event := accessToken.RefreshEvent{Endpoint: EndpointComponentAccessToken, AppId: c.ComponentAppId, Latency: time.Since(start), Err: err}
+	defer func() { c.Emit(event) }()
+	if c.Metrics != nil {
+		c.Metrics.ObserveTokenRefresh(c.ComponentAppId, event.Latency, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	expires := time.Duration(res.ExpiresIn)*time.Second - tokenReserve
+	if event.Err = cache.SetContext(ctx, c.Cache, c.tokenCacheKey(), res.ComponentAccessToken, expires); event.Err != nil {
+		return "", event.Err
+	}
+	event.Token = accessToken.TokenInfo{
+		AccessToken: res.ComponentAccessToken,
+		IssuedAt:    start,
+		ExpiresAt:   start.Add(time.Duration(res.ExpiresIn) * time.Second),
+	}
+	return res.ComponentAccessToken, nil
+}
+
+// ResPreAuthCode 获取预授权码的返回结构体
+type ResPreAuthCode struct {
+	Errno       int    `json:"errno,omitempty"`
+	Message     string `json:"message,omitempty"`
+	PreAuthCode string `json:"pre_auth_code,omitempty"`
+	ExpiresIn   int    `json:"expires_in,omitempty"`
+}
+
+// GetPreAuthCode 获取预授权码, 用于生成授权链接
+func (c *Component) GetPreAuthCode() (ResPreAuthCode, error) {
+	return c.GetPreAuthCodeContext(context.Background())
+}
+
+// GetPreAuthCodeContext 获取预授权码, 支持传入 context
+func (c *Component) GetPreAuthCodeContext(ctx context.Context) (res ResPreAuthCode, err error) {
+	query, err := c.componentQuery(ctx)
+	if err != nil {
+		return
+	}
+	err = c.do(ctx, c.RetryPolicy, &util.Call{
+		Endpoint: EndpointPreAuthCode,
+		URL:      c.GetEnvironment().Url(util.FamilyThirdParty, preAuthCodePath),
+		Query:    query,
+		JSON:     map[string]interface{}{},
+	}, &res)
+	return
+}
+
+// AuthorizationUrl 生成小程序管理员授权给第三方平台的链接, 授权后跳转到 redirectUri 并带上 authorization_code
+func (c *Component) AuthorizationUrl(preAuthCode, redirectUri string) string {
+	query := url.Values{
+		"component_appid": {c.ComponentAppId},
+		"pre_auth_code":   {preAuthCode},
+		"redirect_uri":    {redirectUri},
+	}
+	return c.GetEnvironment().Url(util.FamilyThirdParty, authorizationPath) + "?" + query.Encode()
+}
+
+// componentQuery 第三方平台接口公共的查询参数
+func (c *Component) componentQuery(ctx context.Context) (url.Values, error) {
+	token, err := c.GetComponentAccessTokenContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"component_appid":        {c.ComponentAppId},
+		"component_access_token": {token},
+	}, nil
+}
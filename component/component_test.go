@@ -0,0 +1,112 @@
+package component
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/sign"
+	"github.com/38888/douyin-openapi/util"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// roundTripFunc 使用函数模拟 http 请求
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// 测试 ticket 推送/component_access_token/预授权码/授权小程序 token 的获取及刷新
+func TestComponent(t *testing.T) {
+	var componentTokens int32
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		query := r.URL.Query()
+		body := `{"errno":0}`
+		switch r.URL.Path {
+		case "/openapi/v1/auth/tp/token":
+			if query.Get("component_ticket") != "ticket" || query.Get("component_appsecret") != "tp_secret" {
+				body = `{"errno":40001,"message":"invalid ticket"}`
+				break
+			}
+			n := atomic.AddInt32(&componentTokens, 1)
+			body = fmt.Sprintf(`{"component_access_token":"component_%d","expires_in":7200}`, n)
+		case "/openapi/v2/auth/pre_auth_code":
+			if query.Get("component_access_token") != "component_1" {
+				body = `{"errno":40002,"message":"invalid component_access_token"}`
+				break
+			}
+			body = `{"pre_auth_code":"pre_code","expires_in":600}`
+		case "/openapi/v1/oauth/token":
+			switch {
+			case query.Get("grant_type") == "app_to_tp_authorization_code" && query.Get("authorization_code") == "auth_code":
+				// 有效期小于预留时间, 使用时会立即刷新
+				body = `{"authorizer_access_token":"authorizer_1","expires_in":60,"authorizer_refresh_token":"refresh_1","authorizer_appid":"tt_authorizer","authorize_permission":[{"id":1,"category":"基础信息"}]}`
+			case query.Get("grant_type") == "app_to_tp_refresh_token" && query.Get("authorizer_refresh_token") == "refresh_1":
+				body = `{"authorizer_access_token":"authorizer_2","expires_in":7200,"authorizer_refresh_token":"refresh_2"}`
+			default:
+				body = `{"errno":40003,"message":"invalid authorization_code"}`
+			}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: r}, nil
+	})
+	encodingAESKey := strings.TrimSuffix(base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")), "=")
+	comp := NewComponent("tp_appid", "tp_secret", "tp_token", encodingAESKey, cache.NewMemory())
+	comp.HttpClient = util.NewClientWithTransport(transport)
+	comp.Environment = util.NewEnvironment("test", "http://tp.test")
+
+	if _, err := comp.GetComponentAccessToken(); !errors.Is(err, ErrTicketNotFound) {
+		t.Fatalf("want ErrTicketNotFound, got %v", err)
+	}
+	encrypted, err := EncryptMessage(encodingAESKey, "tp_appid", []byte(`{"MsgType":"Ticket","Ticket":"ticket","CreateTime":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, _ := sign.SHA1Token{Token: "tp_token"}.Sign("1700000000", "nonce", encrypted)
+	push, _ := json.Marshal(PushMessage{Nonce: "nonce", TimeStamp: "1700000000", Encrypt: encrypted, MsgSignature: "bad"})
+	if _, err = comp.HandlePush(push); !errors.Is(err, sign.ErrSignature) {
+		t.Fatalf("want ErrSignature, got %v", err)
+	}
+	push, _ = json.Marshal(PushMessage{Nonce: "nonce", TimeStamp: "1700000000", Encrypt: encrypted, MsgSignature: signature})
+	message, err := comp.HandlePush(push)
+	if err != nil || message.MsgType != MsgTypeTicket {
+		t.Fatalf("HandlePush() = %+v, %v", message, err)
+	}
+	if ticket, _ := comp.GetTicket(); ticket != "ticket" {
+		t.Fatalf("GetTicket() = %s", ticket)
+	}
+
+	preAuthCode, err := comp.GetPreAuthCode()
+	if err != nil || preAuthCode.PreAuthCode != "pre_code" {
+		t.Fatalf("GetPreAuthCode() = %+v, %v", preAuthCode, err)
+	}
+	if u := comp.AuthorizationUrl(preAuthCode.PreAuthCode, "https://example.com/callback"); !strings.Contains(u, "pre_auth_code=pre_code") {
+		t.Errorf("AuthorizationUrl() = %s", u)
+	}
+
+	_, err = comp.ExchangeAuthorizationCode("bad")
+	if apiErr, ok := util.AsAPIError(err); !ok || apiErr.Code != 40003 {
+		t.Fatalf("ExchangeAuthorizationCode() error = %v", err)
+	}
+	token, err := comp.ExchangeAuthorizationCode("auth_code")
+	if err != nil || token.AuthorizerAppId != "tt_authorizer" || len(token.Permissions) != 1 {
+		t.Fatalf("ExchangeAuthorizationCode() = %+v, %v", token, err)
+	}
+
+	// 即将过期的授权小程序 token 在获取时刷新
+	accessToken, err := comp.AuthorizerAccessToken("tt_authorizer").GetAccessToken()
+	if err != nil || accessToken != "authorizer_2" {
+		t.Fatalf("AuthorizerAccessToken().GetAccessToken() = %s, %v", accessToken, err)
+	}
+	if token, _ = comp.LoadAuthorizerToken("tt_authorizer"); token.RefreshToken != "refresh_2" || componentTokens != 1 {
+		t.Errorf("want refreshed token with 1 component token request, got %+v after %d", token, componentTokens)
+	}
+	if _, err = comp.GetAuthorizerToken("tt_unknown"); !errors.Is(err, ErrAuthorizerNotFound) {
+		t.Errorf("want ErrAuthorizerNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package component
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrDecrypt 推送消息解密失败
+var ErrDecrypt = errors.New("component: decrypt message failed")
+
+// aesKey 解析 EncodingAESKey, 43 位的 base64 字符串补上 = 后解码为 32 字节的 AES 密钥
+func aesKey(encodingAESKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return nil, fmt.Errorf("component: invalid EncodingAESKey: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("component: invalid EncodingAESKey length %d", len(key))
+	}
+	return key, nil
+}
+
+// EncryptMessage 加密推送消息, 与平台的加密方式一致, 可用于本地模拟推送
+// 明文为 16 字节随机串 + 4 字节网络序的消息长度 + 消息 + 第三方平台 appid, PKCS#7 填充后 AES-256-CBC 加密(iv 为密钥前 16 字节)并 base64
+func EncryptMessage(encodingAESKey, componentAppId string, msg []byte) (string, error) {
+	key, err := aesKey(encodingAESKey)
+	if err != nil {
+		return "", err
+	}
+	var plain bytes.Buffer
+	random := make([]byte, 16)
+	if _, err = rand.Read(random); err != nil {
+		return "", err
+	}
+	plain.Write(random)
+	_ = binary.Write(&plain, binary.BigEndian, uint32(len(msg)))
+	plain.Write(msg)
+	plain.WriteString(componentAppId)
+	padding := 32 - plain.Len()%32
+	plain.Write(bytes.Repeat([]byte{byte(padding)}, padding))
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	encrypted := make([]byte, plain.Len())
+	cipher.NewCBCEncrypter(block, key[:aes.BlockSize]).CryptBlocks(encrypted, plain.Bytes())
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// DecryptMessage 解密推送消息, 返回消息内容及消息中的第三方平台 appid
+func DecryptMessage(encodingAESKey, encrypted string) (msg []byte, componentAppId string, err error) {
+	key, err := aesKey(encodingAESKey)
+	if err != nil {
+		return
+	}
+	raw, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		err = fmt.Errorf("%w: %s", ErrDecrypt, err)
+		return
+	}
+	if len(raw) == 0 || len(raw)%aes.BlockSize != 0 {
+		err = fmt.Errorf("%w: invalid length %d", ErrDecrypt, len(raw))
+		return
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	plain := make([]byte, len(raw))
+	cipher.NewCBCDecrypter(block, key[:aes.BlockSize]).CryptBlocks(plain, raw)
+	padding := int(plain[len(plain)-1])
+	if padding < 1 || padding > 32 || padding > len(plain) {
+		err = fmt.Errorf("%w: invalid padding", ErrDecrypt)
+		return
+	}
+	plain = plain[:len(plain)-padding]
+	if len(plain) < 20 {
+		err = fmt.Errorf("%w: message too short", ErrDecrypt)
+		return
+	}
+	length := int(binary.BigEndian.Uint32(plain[16:20]))
+	if length > len(plain)-20 {
+		err = fmt.Errorf("%w: invalid message length", ErrDecrypt)
+		return
+	}
+	msg = plain[20 : 20+length]
+	componentAppId = string(plain[20+length:])
+	return
+}
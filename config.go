@@ -0,0 +1,282 @@
+package douyin_openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultEnvPrefix 从环境变量读取配置时默认的前缀
+const DefaultEnvPrefix = "DOUYIN"
+
+// AppConfig 配置文件/环境变量中一个小程序的配置
+type AppConfig struct {
+	AppId        string            `json:"app_id"`                  // 小程序 app_id
+	AppSecret    string            `json:"app_secret"`              // 小程序密钥
+	Salt         string            `json:"salt,omitempty"`          // 担保支付 SALT
+	Token        string            `json:"token,omitempty"`         // 担保支付回调 Token
+	ThirdpartyId string            `json:"thirdparty_id,omitempty"` // 服务商代开发时的第三方平台 id
+	ClientKey    string            `json:"client_key,omitempty"`    // 抖音开放平台应用的 client_key
+	ClientSecret string            `json:"client_secret,omitempty"` // 抖音开放平台应用的 client_secret
+	IsSandbox    bool              `json:"is_sandbox,omitempty"`    // 是否使用沙盒环境
+	BaseUrls     map[Family]string `json:"base_urls,omitempty"`     // 按接口分组覆盖域名
+}
+
+// Config 转换为实例化配置
+func (c AppConfig) Config() DouYinOpenApiConfig {
+	return DouYinOpenApiConfig{
+		AppId:        c.AppId,
+		AppSecret:    c.AppSecret,
+		Salt:         c.Salt,
+		Token:        c.Token,
+		ClientKey:    c.ClientKey,
+		ClientSecret: c.ClientSecret,
+		IsSandbox:    c.IsSandbox,
+		BaseUrls:     c.BaseUrls,
+	}
+}
+
+// LoadConfigFromEnv 从环境变量读取单个小程序的配置, prefix 为空时使用 DOUYIN
+//
+//	DOUYIN_APP_ID DOUYIN_APP_SECRET DOUYIN_SALT DOUYIN_TOKEN DOUYIN_THIRDPARTY_ID DOUYIN_CLIENT_KEY DOUYIN_CLIENT_SECRET DOUYIN_SANDBOX DOUYIN_BASE_URL
+func LoadConfigFromEnv(prefix string) (config DouYinOpenApiConfig, err error) {
+	app, err := loadAppConfigFromEnv(envPrefix(prefix))
+	if err != nil {
+		return
+	}
+	config = app.Config()
+	return
+}
+
+// LoadAppConfigsFromEnv 从环境变量读取多个小程序的配置
+// 设置了 DOUYIN_APPS=a,b 时依次读取 DOUYIN_A_APP_ID/DOUYIN_B_APP_ID 等, 否则按单个小程序读取
+func LoadAppConfigsFromEnv(prefix string) ([]AppConfig, error) {
+	prefix = envPrefix(prefix)
+	names := os.Getenv(prefix + "_APPS")
+	if names == "" {
+		app, err := loadAppConfigFromEnv(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return []AppConfig{app}, nil
+	}
+	var apps []AppConfig
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		app, err := loadAppConfigFromEnv(prefix + "_" + name)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, app)
+	}
+	return apps, nil
+}
+
+// envPrefix 环境变量前缀
+func envPrefix(prefix string) string {
+	if prefix == "" {
+		return DefaultEnvPrefix
+	}
+	return strings.TrimSuffix(prefix, "_")
+}
+
+// loadAppConfigFromEnv 按前缀读取一个小程序的配置
+func loadAppConfigFromEnv(prefix string) (app AppConfig, err error) {
+	app = AppConfig{
+		AppId:        os.Getenv(prefix + "_APP_ID"),
+		AppSecret:    os.Getenv(prefix + "_APP_SECRET"),
+		Salt:         os.Getenv(prefix + "_SALT"),
+		Token:        os.Getenv(prefix + "_TOKEN"),
+		ThirdpartyId: os.Getenv(prefix + "_THIRDPARTY_ID"),
+		ClientKey:    os.Getenv(prefix + "_CLIENT_KEY"),
+		ClientSecret: os.Getenv(prefix + "_CLIENT_SECRET"),
+	}
+	if sandbox := os.Getenv(prefix + "_SANDBOX"); sandbox != "" {
+		if app.IsSandbox, err = strconv.ParseBool(sandbox); err != nil {
+			err = fmt.Errorf("%s_SANDBOX: %w", prefix, err)
+			return
+		}
+	}
+	if baseUrl := os.Getenv(prefix + "_BASE_URL"); baseUrl != "" {
+		app.BaseUrls = map[Family]string{}
+		for _, family := range []Family{FamilyMiniApp, FamilyEcpay, FamilyCensor, FamilyOpenPlatform, FamilyThirdParty} {
+			app.BaseUrls[family] = baseUrl
+		}
+	}
+	return
+}
+
+// LoadConfigFile 从 json 文件读取单个小程序的配置, 文件中有多个小程序时返回错误
+func LoadConfigFile(path string) (config DouYinOpenApiConfig, err error) {
+	apps, err := LoadAppConfigsFile(path)
+	if err != nil {
+		return
+	}
+	if len(apps) != 1 {
+		err = fmt.Errorf("%s: want 1 app, got %d", path, len(apps))
+		return
+	}
+	config = apps[0].Config()
+	return
+}
+
+// LoadAppConfigsFile 从 json 文件读取小程序配置, 支持单个对象/数组/{"apps": [...]} 三种格式
+func LoadAppConfigsFile(path string) ([]AppConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	apps, err := ParseAppConfigs(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return apps, nil
+}
+
+// ParseAppConfigs 解析 json 格式的小程序配置, 支持单个对象/数组/{"apps": [...]} 三种格式
+func ParseAppConfigs(data []byte) ([]AppConfig, error) {
+	data = bytes.TrimSpace(data)
+	var apps []AppConfig
+	if bytes.HasPrefix(data, []byte("[")) {
+		err := json.Unmarshal(data, &apps)
+		return apps, err
+	}
+	var file struct {
+		AppConfig
+		Apps []AppConfig `json:"apps"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Apps != nil {
+		return file.Apps, nil
+	}
+	return []AppConfig{file.AppConfig}, nil
+}
+
+// Feature 需要校验配置的功能
+type Feature string
+
+const (
+	FeatureLogin       Feature = "login"       // 小程序登录, 需要 AppId/AppSecret
+	FeatureAccessToken Feature = "accessToken" // 获取 access_token(内容安全/订单推送等), 需要 AppId/AppSecret 或自定义 AccessToken
+	FeatureEcpay       Feature = "ecpay"       // 担保支付请求签名, 需要 AppId/Salt
+	FeatureCallback    Feature = "callback"    // 担保支付回调验签, 需要 Token
+	FeatureUserToken   Feature = "userToken"   // 用户授权(open.douyin.com), 需要 ClientKey/ClientSecret
+)
+
+// AllFeatures 小程序的所有功能, 用户授权需要单独校验
+var AllFeatures = []Feature{FeatureLogin, FeatureAccessToken, FeatureEcpay, FeatureCallback}
+
+// ConfigProblem 一个配置问题
+type ConfigProblem struct {
+	Feature Feature // 受影响的功能, 通用问题为空
+	Field   string  // 配置字段
+	Message string  // 问题描述
+}
+
+// String 问题描述
+func (p ConfigProblem) String() string {
+	if p.Feature == "" {
+		return fmt.Sprintf("%s %s", p.Field, p.Message)
+	}
+	return fmt.Sprintf("[%s] %s %s", p.Feature, p.Field, p.Message)
+}
+
+// ConfigError 配置校验失败, 包含所有发现的问题
+type ConfigError struct {
+	AppId    string
+	Problems []ConfigProblem
+}
+
+// Error 实现 error 接口
+func (e *ConfigError) Error() string {
+	problems := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		problems = append(problems, problem.String())
+	}
+	return fmt.Sprintf("douyin_openapi: invalid config for %q: %s", e.AppId, strings.Join(problems, "; "))
+}
+
+// Validate 校验配置, features 为需要使用的功能, 为空时校验所有功能
+// 有问题时返回 *ConfigError, 按功能列出缺失或格式错误的字段
+func (c DouYinOpenApiConfig) Validate(features ...Feature) error {
+	if len(features) == 0 {
+		features = AllFeatures
+	}
+	var problems []ConfigProblem
+	add := func(feature Feature, field, message string) {
+		problems = append(problems, ConfigProblem{Feature: feature, Field: field, Message: message})
+	}
+	// 通用的格式检查
+	fields := []struct{ name, value string }{{"AppId", c.AppId}, {"AppSecret", c.AppSecret}, {"Salt", c.Salt}, {"Token", c.Token}, {"ClientKey", c.ClientKey}, {"ClientSecret", c.ClientSecret}}
+	for _, field := range fields {
+		if field.value != strings.TrimSpace(field.value) {
+			add("", field.name, "has leading or trailing whitespace")
+		}
+	}
+	for family, baseUrl := range c.BaseUrls {
+		if u, err := url.Parse(baseUrl); err != nil || u.Scheme == "" || u.Host == "" {
+			add("", fmt.Sprintf("BaseUrls[%s]", family), "is not an absolute url")
+		}
+	}
+	if c.Environment != nil {
+		for family, baseUrl := range c.Environment.BaseUrls {
+			if u, err := url.Parse(baseUrl); err != nil || u.Scheme == "" || u.Host == "" {
+				add("", fmt.Sprintf("Environment.BaseUrls[%s]", family), "is not an absolute url")
+			}
+		}
+	}
+	for _, feature := range features {
+		switch feature {
+		case FeatureLogin:
+			if c.AppId == "" {
+				add(feature, "AppId", "is required")
+			}
+			if c.AppSecret == "" {
+				add(feature, "AppSecret", "is required")
+			}
+		case FeatureAccessToken:
+			if c.AccessToken == nil {
+				if c.AppId == "" {
+					add(feature, "AppId", "is required")
+				}
+				if c.AppSecret == "" {
+					add(feature, "AppSecret", "is required")
+				}
+			}
+		case FeatureEcpay:
+			if c.AppId == "" {
+				add(feature, "AppId", "is required")
+			}
+			if c.Salt == "" {
+				add(feature, "Salt", "is required")
+			}
+		case FeatureCallback:
+			if c.Token == "" {
+				add(feature, "Token", "is required")
+			}
+		case FeatureUserToken:
+			if c.ClientKey == "" {
+				add(feature, "ClientKey", "is required")
+			}
+			if c.ClientSecret == "" {
+				add(feature, "ClientSecret", "is required")
+			}
+		default:
+			add(feature, "", "is not a known feature")
+		}
+	}
+	if len(problems) > 0 {
+		return &ConfigError{AppId: c.AppId, Problems: problems}
+	}
+	return nil
+}
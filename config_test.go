@@ -0,0 +1,67 @@
+package douyin_openapi
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 测试从环境变量及 json 文件读取配置并校验
+func TestConfig(t *testing.T) {
+	t.Setenv("DOUYIN_APP_ID", "tt_env")
+	t.Setenv("DOUYIN_APP_SECRET", "secret")
+	t.Setenv("DOUYIN_SANDBOX", "true")
+	config, err := LoadConfigFromEnv("")
+	if err != nil || config.AppId != "tt_env" || !config.IsSandbox {
+		t.Fatalf("LoadConfigFromEnv() = %+v, %v", config, err)
+	}
+	var configErr *ConfigError
+	if err = config.Validate(); !errors.As(err, &configErr) || len(configErr.Problems) != 2 {
+		t.Fatalf("Validate() = %v", err)
+	}
+	if err = config.Validate(FeatureLogin, FeatureAccessToken); err != nil {
+		t.Fatalf("Validate(login) = %v", err)
+	}
+
+	t.Setenv("PAY_APPS", "a,b")
+	t.Setenv("PAY_A_APP_ID", "tt_a")
+	t.Setenv("PAY_B_APP_ID", "tt_b")
+	t.Setenv("PAY_B_THIRDPARTY_ID", "tp")
+	apps, err := LoadAppConfigsFromEnv("PAY")
+	if err != nil || len(apps) != 2 || apps[1].AppId != "tt_b" || apps[1].ThirdpartyId != "tp" {
+		t.Fatalf("LoadAppConfigsFromEnv() = %+v, %v", apps, err)
+	}
+
+	for _, data := range []string{
+		`{"app_id":"tt_a","salt":"s"}`,
+		`[{"app_id":"tt_a","salt":"s"}]`,
+		`{"apps":[{"app_id":"tt_a","salt":"s"},{"app_id":"tt_b","base_urls":{"ecpay":"localhost"}}]}`,
+	} {
+		apps, err = ParseAppConfigs([]byte(data))
+		if err != nil || apps[0].AppId != "tt_a" || apps[0].Salt != "s" {
+			t.Fatalf("ParseAppConfigs(%s) = %+v, %v", data, apps, err)
+		}
+	}
+	path := t.TempDir() + "/douyin.json"
+	if err = os.WriteFile(path, []byte(`{"apps":[{"app_id":"tt_a","salt":"s"},{"app_id":"tt_b","base_urls":{"ecpay":"localhost"}}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadConfigFile(path); err == nil {
+		t.Fatal("LoadConfigFile() with 2 apps should fail")
+	}
+	apps, _ = LoadAppConfigsFile(path)
+	err = apps[1].Config().Validate(FeatureEcpay)
+	if !errors.As(err, &configErr) || len(configErr.Problems) != 2 || !strings.Contains(err.Error(), "BaseUrls[ecpay] is not an absolute url") {
+		t.Fatalf("Validate(ecpay) = %v", err)
+	}
+
+	// 未配置 Salt/Token 时签名及验签直接报错
+	openApi := NewDouYinOpenApi(DouYinOpenApiConfig{AppId: "tt_a"})
+	if _, err = openApi.QueryOrder("1", ""); !errors.As(err, &configErr) {
+		t.Fatalf("QueryOrder() without Salt = %v", err)
+	}
+	if _, err = openApi.PayCallback(PayCallbackResponse{Msg: "{}"}, true); !errors.As(err, &configErr) {
+		t.Fatalf("PayCallback() without Token = %v", err)
+	}
+}
@@ -3,12 +3,10 @@ package douyin_openapi
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/sha1"
 	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"github.com/38888/douyin-openapi/sign"
 )
 
 type watermark struct {
@@ -38,9 +36,7 @@ type Phone struct {
 
 // https://developer.toutiao.com/docs/open/dataCodec.html#%E6%A0%A1%E9%AA%8C%E6%95%B0%E6%8D%AE%E5%90%88%E6%B3%95%E6%80%A7
 func validate(rawData, sessionKey, signature string) bool {
-	r := sha1.Sum([]byte(rawData + sessionKey))
-	fmt.Println(hex.EncodeToString(r[:]), signature, "signature", rawData, sessionKey)
-	return signature == hex.EncodeToString(r[:])
+	return sign.SHA1SessionKey{SessionKey: sessionKey}.Verify(signature, rawData) == nil
 }
 
 // https://developer.toutiao.com/docs/open/dataCodec.html#%E8%A7%A3%E5%AF%86%E6%95%8F%E6%84%9F%E6%95%B0%E6%8D%AE
@@ -1,17 +1,33 @@
 package douyin_openapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	accessToken "github.com/38888/douyin-openapi/access-token"
+	"github.com/38888/douyin-openapi/breaker"
 	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/lock"
+	"github.com/38888/douyin-openapi/metrics"
+	"github.com/38888/douyin-openapi/ratelimit"
+	"github.com/38888/douyin-openapi/sign"
 	"github.com/38888/douyin-openapi/util"
+	"net/http"
+	"sync"
+	"time"
 )
 
 const (
 	code2Session = "/api/apps/v2/jscode2session" // 小程序登录地址
 )
 
+type (
+	// Call 一次接口调用的描述: 请求方法/地址/查询参数/请求头/json、表单或 multipart 请求内容
+	Call = util.Call
+	// Multipart multipart/form-data 请求内容, 用于上传文件
+	Multipart = util.Multipart
+)
+
 // DouYinOpenApiConfig 实例化配置
 type DouYinOpenApiConfig struct {
 	AppId       string
@@ -21,12 +37,69 @@ type DouYinOpenApiConfig struct {
 	IsSandbox   bool
 	Token       string
 	Salt        string
+	HttpClient  *http.Client      // 自定义 http 客户端, 可设置代理/TLS/超时等
+	Transport   http.RoundTripper // 自定义 Transport, 设置了 HttpClient 时忽略
+	// RetryPolicy 默认开启重试的接口(查询类及幂等的担保支付接口)使用的重试策略, 为空时使用 util.DefaultRetryPolicy
+	RetryPolicy *util.RetryPolicy
+	// EndpointRetryPolicies 按接口名称(Endpoint 常量)覆盖重试策略, 值为 nil 时关闭该接口的重试
+	EndpointRetryPolicies map[string]*util.RetryPolicy
+	// Interceptors 请求拦截器, 按顺序由外到内执行, 也可以通过 Use 添加
+	Interceptors []Interceptor
+	// RateLimiter 客户端限流器, 按 AppId 及接口名称限流, 为空时不限流
+	RateLimiter ratelimit.Limiter
+	// Metrics 监控指标收集, 记录接口请求/平台错误码/token 刷新/缓存命中等, 为空时不记录
+	Metrics metrics.Metrics
+	// CircuitBreaker 按接口熔断, 平台故障时快速失败并返回 breaker.ErrCircuitOpen, 为空时不熔断
+	CircuitBreaker breaker.CircuitBreaker
+	// Signers 按接口名称覆盖请求签名方式, 如替换为自定义签名
+	// 实现了 sign.RequestSigner 的签名方式(如 sign.RSASHA256)对整个请求签名并通过请求头传递, 请求内容不再带 sign 字段
+	Signers map[string]sign.Signer
+	// Verifiers 按接口或回调名称覆盖验签方式
+	Verifiers map[string]sign.Verifier
+	// AccessTokenRefresher 开启后在 token 过期前后台刷新, 使用 DefaultAccessToken 时生效, 需要调用 Close 停止
+	AccessTokenRefresher *accessToken.RefresherConfig
+	// AccessTokenLocker 多实例共享缓存时获取 token 使用的分布式锁, 未抢到锁的实例等待并读取缓存中的新 token
+	// 使用 DefaultAccessToken 时生效, 为空时只在本实例内加锁
+	AccessTokenLocker lock.Locker
+	// TokenInvalidateInterval 接口返回 access_token 无效时会作废缓存并用新 token 重放一次请求
+	// 两次作废的最小间隔, 新 token 仍被拒绝时不再重复获取, 防止刷新风暴; 默认 10s, 小于 0 时关闭自动重放
+	TokenInvalidateInterval time.Duration
+	// Environment 接口环境, 为空时根据 IsSandbox 选择正式或沙盒环境
+	Environment *Environment
+	// BaseUrls 按接口分组覆盖域名, 如指向预发代理或本地 mock
+	BaseUrls map[Family]string
+	// ClientKey 抖音开放平台应用的 client_key, 设置后可以通过 UserTokens 管理用户授权(open.douyin.com)的 token
+	ClientKey string
+	// ClientSecret 抖音开放平台应用的 client_secret
+	ClientSecret string
+	// FamilyAccessTokens 按接口分组使用不同的 token, 未配置的分组使用 AccessToken
+	// 设置了 ClientKey 时开放平台接口(FamilyOpenPlatform)默认使用 client_token
+	FamilyAccessTokens map[Family]accessToken.AccessToken
+	// TokenRefreshHooks 内置的 token 管理类(access_token/client_token/用户 token)刷新成功或失败的回调, 可用于告警
+	TokenRefreshHooks accessToken.RefreshHooks
 }
 
 // DouYinOpenApi 基类
 type DouYinOpenApi struct {
-	Config  DouYinOpenApiConfig
-	BaseApi string
+	Config      DouYinOpenApiConfig
+	BaseApi     string                        // 小程序接口的域名
+	Client      *util.Client                  // http 请求执行器, 所有接口共用
+	Environment Environment                   // 接口环境
+	UserTokens  *accessToken.UserTokenManager // 用户授权 token 管理, 设置了 ClientKey 时可用
+	tokens      map[Family]accessToken.AccessToken
+	refreshers  []*accessToken.Refresher
+	guardLock   sync.Mutex
+	tokenGuards map[string]*tokenGuard // 按 token 的缓存 key 记录作废情况
+}
+
+// defaultTokenInvalidateInterval 两次作废 token 的默认最小间隔
+const defaultTokenInvalidateInterval = 10 * time.Second
+
+// tokenGuard 记录最近一次作废的 token, 防止并发请求重复作废及新 token 被拒绝时反复刷新
+type tokenGuard struct {
+	mu       sync.Mutex
+	rejected string    // 最近一次作废的 token
+	at       time.Time // 最近一次作废的时间
 }
 
 // NewDouYinOpenApi 实例化一个抖音openapi实例
@@ -34,19 +107,135 @@ func NewDouYinOpenApi(config DouYinOpenApiConfig) *DouYinOpenApi {
 	if config.Cache == nil {
 		config.Cache = cache.NewMemory()
 	}
-	if config.AccessToken == nil {
-		config.AccessToken = accessToken.NewDefaultAccessToken(config.AppId, config.AppSecret, config.Cache, config.IsSandbox)
+	client := util.NewClient(config.HttpClient)
+	if config.HttpClient == nil && config.Transport != nil {
+		client = util.NewClientWithTransport(config.Transport)
+	}
+	client.Use(config.Interceptors...)
+	// 限流放在熔断及监控外层, 等待令牌的时间不计入接口耗时; 被拒绝的请求单独记录, 不计入请求次数
+	if config.RateLimiter != nil {
+		client.Use(rateLimitInterceptor(config.AppId, config.RateLimiter, config.Metrics))
+	}
+	if config.CircuitBreaker != nil {
+		client.Use(circuitBreakerInterceptor(config.CircuitBreaker, config.Metrics))
+	}
+	if config.Metrics != nil {
+		client.Use(metricsInterceptor(config.Metrics))
+	}
+	for _, signer := range config.Signers {
+		if _, ok := signer.(sign.RequestSigner); ok {
+			client.Use(requestSignInterceptor(config.AppId, config.Signers))
+			break
+		}
+	}
+	environment := util.GetEnvironment(config.IsSandbox)
+	if config.Environment != nil {
+		environment = *config.Environment
+	}
+	environment = environment.With(config.BaseUrls)
+	d := &DouYinOpenApi{
+		Config:      config,
+		BaseApi:     environment.BaseUrl(FamilyMiniApp),
+		Client:      client,
+		Environment: environment,
+		tokens:      map[Family]accessToken.AccessToken{},
+		tokenGuards: map[string]*tokenGuard{},
+	}
+	if d.Config.AccessToken == nil {
+		token := accessToken.NewDefaultAccessToken(config.AppId, config.AppSecret, config.Cache, config.IsSandbox).(*accessToken.DefaultAccessToken)
+		d.setupToken(token, EndpointAccessToken)
+		d.Config.AccessToken = token
+	}
+	for family, token := range config.FamilyAccessTokens {
+		d.tokens[family] = token
+	}
+	if config.ClientKey != "" {
+		users := accessToken.NewUserTokenManager(config.ClientKey, config.ClientSecret, config.Cache, config.IsSandbox)
+		users.HttpClient = client
+		users.RetryPolicy = d.GetRetryPolicy(EndpointUserRefreshToken)
+		users.Metrics = config.Metrics
+		users.Environment = environment
+		users.RefreshHooks = config.TokenRefreshHooks
+		d.UserTokens = users
+		if _, ok := d.tokens[FamilyOpenPlatform]; !ok {
+			token := accessToken.NewClientToken(config.ClientKey, config.ClientSecret, config.Cache, config.IsSandbox)
+			d.setupToken(token.DefaultAccessToken, EndpointClientToken)
+			d.tokens[FamilyOpenPlatform] = token
+		}
+	}
+	if config.AccessTokenRefresher != nil {
+		d.startRefreshers(*config.AccessTokenRefresher)
+	}
+	return d
+}
+
+// setupToken 内置的 token 管理类使用实例的请求执行器/重试策略/监控/环境/锁
+func (d *DouYinOpenApi) setupToken(token *accessToken.DefaultAccessToken, endpoint string) {
+	token.HttpClient = d.Client
+	token.RetryPolicy = d.GetRetryPolicy(endpoint)
+	token.Metrics = d.Config.Metrics
+	token.Environment = d.Environment
+	token.Locker = d.Config.AccessTokenLocker
+	token.RefreshHooks = d.Config.TokenRefreshHooks
+}
+
+// startRefreshers 对支持后台刷新的 token 开启后台刷新, 同一个 token 只开启一次
+func (d *DouYinOpenApi) startRefreshers(config accessToken.RefresherConfig) {
+	type refreshable interface {
+		StartRefresher(config accessToken.RefresherConfig) *accessToken.Refresher
 	}
-	BaseApi := "https://developer.toutiao.com"
-	if config.IsSandbox {
-		BaseApi = "https://open-sandbox.douyin.com"
+	started := map[accessToken.AccessToken]bool{}
+	tokens := []accessToken.AccessToken{d.Config.AccessToken}
+	for _, token := range d.tokens {
+		tokens = append(tokens, token)
 	}
-	return &DouYinOpenApi{
-		Config:  config,
-		BaseApi: BaseApi,
+	for _, token := range tokens {
+		if r, ok := token.(refreshable); ok && !started[token] {
+			started[token] = true
+			d.refreshers = append(d.refreshers, r.StartRefresher(config))
+		}
 	}
 }
 
+// Close 停止后台刷新 token 等后台任务, 未开启时不做任何事
+func (d *DouYinOpenApi) Close() error {
+	var errs []error
+	for _, refresher := range d.refreshers {
+		if err := refresher.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// GetAccessTokenFor 获取接口分组使用的 token, 未单独配置时使用 Config.AccessToken
+func (d *DouYinOpenApi) GetAccessTokenFor(family Family) accessToken.AccessToken {
+	if token, ok := d.tokens[family]; ok {
+		return token
+	}
+	return d.Config.AccessToken
+}
+
+// GetAccessTokenInfo 获取接口分组使用的 token 及其有效期
+func (d *DouYinOpenApi) GetAccessTokenInfo(family Family) (accessToken.TokenInfo, error) {
+	return d.GetAccessTokenInfoContext(context.Background(), family)
+}
+
+// GetAccessTokenInfoContext 获取接口分组使用的 token 及其有效期, 自定义的 AccessToken 未实现 InfoAccessToken 时有效期未知
+func (d *DouYinOpenApi) GetAccessTokenInfoContext(ctx context.Context, family Family) (accessToken.TokenInfo, error) {
+	return accessToken.GetTokenInfoContext(ctx, d.GetAccessTokenFor(family))
+}
+
+// ForceRefreshAccessToken 立即刷新接口分组使用的 token, 如密钥轮换后
+func (d *DouYinOpenApi) ForceRefreshAccessToken(family Family) (accessToken.TokenInfo, error) {
+	return d.ForceRefreshAccessTokenContext(context.Background(), family)
+}
+
+// ForceRefreshAccessTokenContext 立即刷新接口分组使用的 token, 支持传入 context
+func (d *DouYinOpenApi) ForceRefreshAccessTokenContext(ctx context.Context, family Family) (accessToken.TokenInfo, error) {
+	return accessToken.ForceRefresh(ctx, d.GetAccessTokenFor(family), d.Config.Cache)
+}
+
 // GetApiUrl 获取api地址
 func (d *DouYinOpenApi) GetApiUrl(url string) string {
 	return fmt.Sprintf("%s%s", d.BaseApi, url)
@@ -54,15 +243,130 @@ func (d *DouYinOpenApi) GetApiUrl(url string) string {
 
 // PostJson 封装公共的请求方法
 func (d *DouYinOpenApi) PostJson(api string, params interface{}, response interface{}) (err error) {
-	body, err := util.PostJSON(api, params)
+	return d.PostJsonContext(context.Background(), api, params, response)
+}
+
+// PostJsonContext 封装公共的请求方法, 支持传入 context
+func (d *DouYinOpenApi) PostJsonContext(ctx context.Context, api string, params interface{}, response interface{}) (err error) {
+	return d.postJsonUrl(ctx, api, api, params, response)
+}
+
+// postJson 请求接口并解析返回值, 接口地址由接口描述决定
+func (d *DouYinOpenApi) postJson(ctx context.Context, endpoint string, params interface{}, response interface{}) (err error) {
+	return d.postJsonUrl(ctx, endpoint, d.GetEndpointUrl(endpoint), params, response)
+}
+
+// postJsonUrl 请求接口并解析返回值, http 状态码或平台错误码异常时返回 APIError
+func (d *DouYinOpenApi) postJsonUrl(ctx context.Context, endpoint, api string, params interface{}, response interface{}) (err error) {
+	return d.Execute(ctx, &Call{Endpoint: endpoint, URL: api, JSON: params}, response)
+}
+
+// Execute 执行一次接口调用并解析返回值, 可用于 sdk 尚未封装的 GET/表单/文件上传等接口
+// 按 call.Endpoint 使用对应的重试策略及 access_token 传递方式, response 为 *[]byte 时保存原始返回内容(如图片)
+// 返回 access_token 无效时作废缓存中的 token, 获取新的 token 后重放一次
+func (d *DouYinOpenApi) Execute(ctx context.Context, call *Call, response interface{}) (err error) {
+	authorized, token, err := d.authorize(ctx, call)
 	if err != nil {
 		return
 	}
-	err = json.Unmarshal(body, &response)
-	if err != nil {
+	err = d.execute(ctx, authorized, response)
+	if token == "" || !isAuthError(err) || !d.invalidateToken(ctx, d.callAccessToken(call), token) {
 		return
 	}
-	return
+	if authorized, _, err = d.authorize(ctx, call); err != nil {
+		return
+	}
+	return d.execute(ctx, authorized, response)
+}
+
+// execute 按接口的重试策略执行请求并解析返回值
+func (d *DouYinOpenApi) execute(ctx context.Context, call *Call, response interface{}) error {
+	return d.GetRetryPolicy(call.Endpoint).Do(ctx, call.Endpoint, func(ctx context.Context) error {
+		res, err := d.Client.Execute(ctx, call)
+		if err != nil {
+			return util.WrapError(call.Endpoint, err)
+		}
+		return parseResponse(call.Endpoint, res, response)
+	})
+}
+
+// authorize 按接口声明的方式注入当前的 access_token, 返回注入后的副本及使用的 token, 不修改调用方的 call
+func (d *DouYinOpenApi) authorize(ctx context.Context, call *Call) (*Call, string, error) {
+	scheme := call.Auth
+	if scheme == nil {
+		scheme = d.GetAuthScheme(call.Endpoint)
+	}
+	if scheme == nil {
+		return call, "", nil
+	}
+	token, err := accessToken.GetAccessTokenContext(ctx, d.callAccessToken(call))
+	if err != nil {
+		return nil, "", fmt.Errorf("AccessToken error: %w", err)
+	}
+	authorized := *call
+	if err = scheme.Inject(&authorized, token); err != nil {
+		return nil, "", &util.APIError{Endpoint: call.Endpoint, Err: err}
+	}
+	return &authorized, token, nil
+}
+
+// callAccessToken 接口调用使用的 token, 按 call.Family 或接口描述中的分组选择
+func (d *DouYinOpenApi) callAccessToken(call *Call) accessToken.AccessToken {
+	family := call.Family
+	if family == "" {
+		family = endpoints[call.Endpoint].family
+	}
+	return d.GetAccessTokenFor(family)
+}
+
+// invalidateToken 作废被平台拒绝的 token, 返回是否需要用新 token 重放请求
+// 同一个 token 只作废一次, 其他并发请求直接使用新的 token 重放; 距离上次作废不足 TokenInvalidateInterval 时不再作废也不重放
+func (d *DouYinOpenApi) invalidateToken(ctx context.Context, manager accessToken.AccessToken, token string) bool {
+	interval := d.Config.TokenInvalidateInterval
+	if interval < 0 {
+		return false
+	}
+	if interval == 0 {
+		interval = defaultTokenInvalidateInterval
+	}
+	d.guardLock.Lock()
+	guard, ok := d.tokenGuards[manager.GetCacheKey()]
+	if !ok {
+		guard = &tokenGuard{}
+		d.tokenGuards[manager.GetCacheKey()] = guard
+	}
+	d.guardLock.Unlock()
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	if guard.rejected == token {
+		return true
+	}
+	if !guard.at.IsZero() && time.Since(guard.at) < interval {
+		return false
+	}
+	if err := accessToken.Invalidate(ctx, manager, d.Config.Cache, token); err != nil {
+		return false
+	}
+	guard.rejected = token
+	guard.at = time.Now()
+	return true
+}
+
+// parseResponse 解析返回值到结构体并检查错误
+func parseResponse(endpoint string, res *util.Response, response interface{}) error {
+	if err := util.CheckResponse(endpoint, res); err != nil {
+		// 出错时也尽量解析返回值, 方便调用方查看原始字段
+		_ = json.Unmarshal(res.Body, response)
+		return err
+	}
+	if raw, ok := response.(*[]byte); ok {
+		*raw = res.Body
+		return nil
+	}
+	if err := json.Unmarshal(res.Body, response); err != nil {
+		return &util.APIError{Endpoint: endpoint, StatusCode: res.StatusCode, Err: err}
+	}
+	return nil
 }
 
 // Code2SessionParams 小程序登录 所需参数
@@ -88,19 +392,18 @@ type Code2SessionResponseData struct {
 }
 
 // Code2Session 小程序登录
-func (d *DouYinOpenApi) Code2Session(code, anonymousCode string) (code2SessionResponse Code2SessionResponse, err error) {
+func (d *DouYinOpenApi) Code2Session(code, anonymousCode string) (Code2SessionResponse, error) {
+	return d.Code2SessionContext(context.Background(), code, anonymousCode)
+}
+
+// Code2SessionContext 小程序登录, 支持传入 context
+func (d *DouYinOpenApi) Code2SessionContext(ctx context.Context, code, anonymousCode string) (code2SessionResponse Code2SessionResponse, err error) {
 	params := Code2SessionParams{
 		Appid:         d.Config.AppId,
 		Secret:        d.Config.AppSecret,
 		AnonymousCode: anonymousCode,
 		Code:          code,
 	}
-	err = d.PostJson(d.GetApiUrl(code2Session), params, &code2SessionResponse)
-	if err != nil {
-		return
-	}
-	if code2SessionResponse.ErrNo != 0 {
-		return code2SessionResponse, fmt.Errorf("小程序登录错误: %s %d", code2SessionResponse.ErrTips, code2SessionResponse.ErrNo)
-	}
+	err = d.postJson(ctx, EndpointCode2Session, params, &code2SessionResponse)
 	return
 }
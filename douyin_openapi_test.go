@@ -1,11 +1,23 @@
 package douyin_openapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	accessToken "github.com/38888/douyin-openapi/access-token"
+	"github.com/38888/douyin-openapi/breaker"
 	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/lock"
+	"github.com/38888/douyin-openapi/ratelimit"
+	"github.com/38888/douyin-openapi/util"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -93,8 +105,17 @@ func TestDouYinOpenApi_Code2Session(t *testing.T) {
 	t.Logf("got a value %+v", session)
 }
 
+// skipWithoutSalt 未配置 AppId/Salt 时跳过需要请求签名的担保支付测试, 签名会直接返回 ConfigError
+func skipWithoutSalt(t *testing.T) {
+	t.Helper()
+	if AppId == "" || Salt == "" {
+		t.Skip("AppId/Salt is not configured")
+	}
+}
+
 // 测试下单接口
 func TestDouYinOpenApi_CreateOrder(t *testing.T) {
+	skipWithoutSalt(t)
 	outOrderNo := GenerateSignOrderNo("")
 	params := CreateOrderParams{
 		OutOrderNo:      outOrderNo,
@@ -116,6 +137,7 @@ func TestDouYinOpenApi_CreateOrder(t *testing.T) {
 }
 
 func TestDouYinOpenApi_QueryOrder(t *testing.T) {
+	skipWithoutSalt(t)
 	gotQueryOrderResponse, err := OpenApi.QueryOrder("1934820001", "")
 	if err != nil {
 		t.Errorf("got a error %s", err.Error())
@@ -126,7 +148,12 @@ func TestDouYinOpenApi_QueryOrder(t *testing.T) {
 
 func TestDouYinOpenApi_PayCallback(t *testing.T) {
 	body := "{\n  \"timestamp\": \"1602507471\",\n  \"nonce\": \"797\",\n  \"msg\": \"{\\\"appid\\\":\\\"tt07e3715e98c9aac0\\\",\\\"cp_orderno\\\":\\\"out_order_no_1\\\",\\\"cp_extra\\\":\\\"\\\",\\\"way\\\":\\\"2\\\",\\\"payment_order_no\\\":\\\"2021070722001450071438803941\\\",\\\"total_amount\\\":9980,\\\"status\\\":\\\"SUCCESS\\\",\\\"seller_uid\\\":\\\"69631798443938962290\\\",\\\"extra\\\":\\\"null\\\",\\\"item_id\\\":\\\"\\\",\\\"order_id\\\":\\\"N71016888186626816\\\"}\",\n  \"msg_signature\": \"52fff5f7a4bf4a921c2daf83c75cf0e716432c73\",\n  \"type\": \"payment\"\n}"
-	gotPayCallbackResponse, err := OpenApi.PayCallback(body, false)
+	var payCallbackResponse PayCallbackResponse
+	if err := json.Unmarshal([]byte(body), &payCallbackResponse); err != nil {
+		t.Errorf("got a error %s", err.Error())
+		return
+	}
+	gotPayCallbackResponse, err := OpenApi.PayCallback(payCallbackResponse, false)
 	if err != nil {
 		t.Errorf("got a error %s", err.Error())
 		return
@@ -135,6 +162,7 @@ func TestDouYinOpenApi_PayCallback(t *testing.T) {
 }
 
 func TestDouYinOpenApi_CreateRefund(t *testing.T) {
+	skipWithoutSalt(t)
 	outRefundNo := GenerateSignOrderNo("") // 6887470001
 	params := CreateRefundParams{
 		OutOrderNo:   "1934820001",
@@ -187,3 +215,661 @@ func TestDouYinOpenApi_OrderV2Push(t *testing.T) {
 	res, err := OpenApi.OrderV2Push(normal)
 	fmt.Printf("res: %+v err: %+v", res, err)
 }
+
+// 测试 context 取消后不再发起请求
+func TestDouYinOpenApi_Code2SessionContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := OpenApi.Code2SessionContext(ctx, "1111", "")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("want context.Canceled, got %v", err)
+	}
+}
+
+// roundTripFunc 测试用的 RoundTripper
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// 测试自定义 Transport 会被所有接口使用
+func TestDouYinOpenApi_Transport(t *testing.T) {
+	var paths []string
+	openApi := NewDouYinOpenApi(DouYinOpenApiConfig{
+		AppId: "tt_test",
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			paths = append(paths, r.URL.Path)
+			body := `{"err_no":0,"data":{"access_token":"token","expires_in":7200,"openid":"openid"}}`
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: r}, nil
+		}),
+	})
+	session, err := openApi.Code2Session("code", "")
+	if err != nil || session.Data.Openid != "openid" {
+		t.Fatalf("Code2Session() = %+v, %v", session, err)
+	}
+	if _, err = openApi.Config.AccessToken.GetAccessToken(); err != nil {
+		t.Fatalf("GetAccessToken() error = %v", err)
+	}
+	if len(paths) != 2 {
+		t.Errorf("want 2 requests through transport, got %v", paths)
+	}
+}
+
+// newTestOpenApi 实例化一个通过 handler 返回结果的测试实例
+func newTestOpenApi(config DouYinOpenApiConfig, handler func(r *http.Request) (int, string)) *DouYinOpenApi {
+	config.AppId = "tt_test"
+	config.Salt = "salt"
+	config.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		status, body := handler(r)
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: r}, nil
+	})
+	return NewDouYinOpenApi(config)
+}
+
+// 测试平台错误码转换为 APIError
+func TestDouYinOpenApi_APIError(t *testing.T) {
+	openApi := newTestOpenApi(DouYinOpenApiConfig{EndpointRetryPolicies: map[string]*util.RetryPolicy{EndpointQueryOrder: nil}}, func(r *http.Request) (int, string) {
+		if strings.HasSuffix(r.URL.Path, queryOrder) {
+			return http.StatusServiceUnavailable, ""
+		}
+		return http.StatusOK, `{"err_no":28001003,"err_tips":"access_token 无效","log_id":"20230222141829"}`
+	})
+	_, err := openApi.CreateOrder(CreateOrderParams{OutOrderNo: "1"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("want APIError, got %v", err)
+	}
+	if apiErr.Endpoint != EndpointCreateOrder || apiErr.Code != 28001003 || apiErr.LogId != "20230222141829" {
+		t.Errorf("unexpected APIError %+v", apiErr)
+	}
+	if !IsAuthError(err) || IsRetryable(err) {
+		t.Errorf("want auth error and not retryable, got %v", err)
+	}
+
+	_, err = openApi.QueryOrder("1", "")
+	if !IsRetryable(err) || IsAuthError(err) {
+		t.Errorf("want retryable error, got %v", err)
+	}
+}
+
+// 测试查询接口默认重试, 非幂等接口不重试
+func TestDouYinOpenApi_Retry(t *testing.T) {
+	var calls int32
+	var retries []int
+	openApi := newTestOpenApi(DouYinOpenApiConfig{
+		RetryPolicy: &util.RetryPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   time.Millisecond,
+			OnRetry: func(endpoint string, attempt int, err error, delay time.Duration) {
+				retries = append(retries, attempt)
+			},
+		},
+	}, func(r *http.Request) (int, string) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return http.StatusBadGateway, ""
+		}
+		return http.StatusOK, `{"err_no":0,"out_order_no":"1"}`
+	})
+	res, err := openApi.QueryOrder("1", "")
+	if err != nil || res.OutOrderNo != "1" || len(retries) != 2 {
+		t.Fatalf("QueryOrder() = %+v, %v, retries %v", res, err, retries)
+	}
+
+	atomic.StoreInt32(&calls, -10)
+	_, err = openApi.QueryOrder("1", "")
+	apiErr, ok := util.AsAPIError(err)
+	if !ok || apiErr.Attempts != 3 {
+		t.Fatalf("want 3 attempts, got %v", err)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	_, err = openApi.Code2Session("code", "")
+	if apiErr, ok = util.AsAPIError(err); !ok || apiErr.Attempts != 1 || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("want no retry for code2Session, got %v", err)
+	}
+}
+
+// 测试 http.Client 超时后重试
+func TestDouYinOpenApi_RetryTimeout(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 读完请求内容后服务端才能感知客户端断开
+		_, _ = io.Copy(io.Discard, r.Body)
+		if atomic.AddInt32(&calls, 1) < 3 {
+			<-r.Context().Done()
+			return
+		}
+		_, _ = io.WriteString(w, `{"err_no":0,"out_order_no":"1"}`)
+	}))
+	defer server.Close()
+	environment := util.NewEnvironment("test", server.URL)
+	openApi := NewDouYinOpenApi(DouYinOpenApiConfig{
+		AppId:       "tt_test",
+		Salt:        "salt",
+		HttpClient:  &http.Client{Timeout: 50 * time.Millisecond},
+		Environment: &environment,
+		RetryPolicy: &util.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+	})
+	res, err := openApi.QueryOrder("1", "")
+	if err != nil || res.OutOrderNo != "1" || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("QueryOrder() = %+v, %v after %d calls", res, err, calls)
+	}
+}
+
+// 测试拦截器可以看到包括获取 access_token 在内的所有请求
+func TestDouYinOpenApi_Interceptor(t *testing.T) {
+	openApi := newTestOpenApi(DouYinOpenApiConfig{}, func(r *http.Request) (int, string) {
+		if strings.HasSuffix(r.URL.Path, securityCensorText) {
+			if r.Header.Get("X-Token") != "token" {
+				return http.StatusUnauthorized, `{"code":401,"message":"bad token"}`
+			}
+			return http.StatusOK, `{"log_id":"1","data":[{"code":0,"task_id":"task"}]}`
+		}
+		return http.StatusOK, `{"err_no":0,"data":{"access_token":"token","expires_in":7200}}`
+	})
+	var endpoints []string
+	openApi.Use(func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			res, err := next(ctx, req)
+			if err == nil {
+				endpoints = append(endpoints, fmt.Sprintf("%s %d", req.Endpoint, res.StatusCode))
+			}
+			return res, err
+		}
+	})
+	res, err := openApi.SecurityCensorText("text")
+	if err != nil || len(res.Data) != 1 {
+		t.Fatalf("SecurityCensorText() = %+v, %v", res, err)
+	}
+	want := []string{"accessToken 200", "securityCensorText 200"}
+	if fmt.Sprint(endpoints) != fmt.Sprint(want) {
+		t.Errorf("want %v, got %v", want, endpoints)
+	}
+}
+
+// 测试限流拦截器按 AppId 及接口名称限流
+func TestDouYinOpenApi_RateLimiter(t *testing.T) {
+	limiter := ratelimit.NewTokenBucketLimiter(ratelimit.Limit{})
+	limiter.SetAppLimit("tt_test", EndpointQueryOrder, ratelimit.Limit{QPS: 0.1, Burst: 1})
+	openApi := newTestOpenApi(DouYinOpenApiConfig{RateLimiter: limiter}, func(r *http.Request) (int, string) {
+		return http.StatusOK, `{"err_no":0}`
+	})
+	if _, err := openApi.QueryOrder("1", ""); err != nil {
+		t.Fatalf("QueryOrder() error = %v", err)
+	}
+	if _, err := openApi.QueryOrderContext(ratelimit.WithFailFast(context.Background()), "1", ""); !errors.Is(err, ratelimit.ErrLimited) {
+		t.Fatalf("want ErrLimited, got %v", err)
+	}
+	// 其他接口不受影响
+	if _, err := openApi.QueryRefundContext(ratelimit.WithFailFast(context.Background()), "1", ""); err != nil {
+		t.Fatalf("QueryRefund() error = %v", err)
+	}
+}
+
+// 测试熔断拦截器: 5xx 计为失败, 熔断打开后不再发起请求
+func TestDouYinOpenApi_CircuitBreaker(t *testing.T) {
+	var calls int32
+	cb := breaker.New(breaker.Config{MinRequests: 2})
+	openApi := newTestOpenApi(DouYinOpenApiConfig{
+		CircuitBreaker:        cb,
+		EndpointRetryPolicies: map[string]*util.RetryPolicy{EndpointQueryOrder: nil},
+	}, func(r *http.Request) (int, string) {
+		atomic.AddInt32(&calls, 1)
+		return http.StatusBadGateway, ""
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := openApi.QueryOrder("1", ""); err == nil || errors.Is(err, breaker.ErrCircuitOpen) {
+			t.Fatalf("want 502 error, got %v", err)
+		}
+	}
+	_, err := openApi.QueryOrder("1", "")
+	var openErr *breaker.OpenError
+	if !errors.Is(err, breaker.ErrCircuitOpen) || !errors.As(err, &openErr) || openErr.Endpoint != EndpointQueryOrder {
+		t.Fatalf("want ErrCircuitOpen, got %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("open circuit should not send requests, calls = %d", calls)
+	}
+}
+
+// 测试超时计为熔断失败, 调用方主动取消不计入
+func TestDouYinOpenApi_CircuitBreakerTimeout(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		atomic.AddInt32(&calls, 1)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	environment := util.NewEnvironment("test", server.URL)
+	cb := breaker.New(breaker.Config{MinRequests: 2})
+	openApi := NewDouYinOpenApi(DouYinOpenApiConfig{
+		AppId:                 "tt_test",
+		Salt:                  "salt",
+		HttpClient:            &http.Client{Timeout: 20 * time.Millisecond},
+		Environment:           &environment,
+		CircuitBreaker:        cb,
+		EndpointRetryPolicies: map[string]*util.RetryPolicy{EndpointQueryOrder: nil},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(5*time.Millisecond, cancel)
+	for i := 0; i < 2; i++ {
+		if _, err := openApi.QueryOrderContext(ctx, "1", ""); !errors.Is(err, context.Canceled) {
+			t.Fatalf("want context.Canceled, got %v", err)
+		}
+	}
+	if state := cb.State(EndpointQueryOrder); state != breaker.StateClosed {
+		t.Fatalf("caller cancellation should not open the circuit, got %s", state)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := openApi.QueryOrder("1", ""); err == nil || errors.Is(err, breaker.ErrCircuitOpen) {
+			t.Fatalf("want timeout error, got %v", err)
+		}
+	}
+	if _, err := openApi.QueryOrder("1", ""); !errors.Is(err, breaker.ErrCircuitOpen) {
+		t.Fatalf("want ErrCircuitOpen after timeouts, got %v", err)
+	}
+}
+
+// limiterFunc 函数形式的限流器
+type limiterFunc func(ctx context.Context, appId, endpoint string) error
+
+func (f limiterFunc) Wait(ctx context.Context, appId, endpoint string) error {
+	return f(ctx, appId, endpoint)
+}
+
+// 测试等待限流及平台限流不计入熔断统计
+func TestDouYinOpenApi_CircuitBreakerRateLimited(t *testing.T) {
+	var limited int32 = 1
+	cb := breaker.New(breaker.Config{MinRequests: 2, SlowCall: 10 * time.Millisecond})
+	openApi := newTestOpenApi(DouYinOpenApiConfig{
+		CircuitBreaker: cb,
+		RateLimiter: limiterFunc(func(ctx context.Context, appId, endpoint string) error {
+			if atomic.LoadInt32(&limited) == 1 {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		}),
+		EndpointRetryPolicies: map[string]*util.RetryPolicy{EndpointQueryOrder: nil},
+	}, func(r *http.Request) (int, string) {
+		return http.StatusTooManyRequests, ""
+	})
+	// 等待令牌超时
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := openApi.QueryOrderContext(ctx, "1", "")
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("want DeadlineExceeded, got %v", err)
+		}
+	}
+	if state := cb.State(EndpointQueryOrder); state != breaker.StateClosed {
+		t.Fatalf("limiter waits should not open the circuit, got %s", state)
+	}
+	// 平台返回 429
+	atomic.StoreInt32(&limited, 0)
+	for i := 0; i < 3; i++ {
+		if _, err := openApi.QueryOrder("1", ""); !util.IsRateLimited(err) {
+			t.Fatalf("want rate limited error, got %v", err)
+		}
+	}
+	if state := cb.State(EndpointQueryOrder); state != breaker.StateClosed {
+		t.Fatalf("429 should not open the circuit, got %s", state)
+	}
+}
+
+// recordingMetrics 记录收到的指标
+type recordingMetrics struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (m *recordingMetrics) record(format string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, fmt.Sprintf(format, args...))
+}
+
+func (m *recordingMetrics) ObserveRequest(endpoint string, statusCode int, _ time.Duration, err error) {
+	m.record("request %s %d %v", endpoint, statusCode, err != nil)
+}
+
+func (m *recordingMetrics) ObservePlatformError(endpoint string, code int) {
+	m.record("platform_error %s %d", endpoint, code)
+}
+
+func (m *recordingMetrics) ObserveTokenRefresh(appId string, _ time.Duration, err error) {
+	m.record("token_refresh %s %v", appId, err != nil)
+}
+
+func (m *recordingMetrics) ObserveCache(name string, hit bool) {
+	m.record("cache %s %v", name, hit)
+}
+
+func (m *recordingMetrics) ObserveRejected(endpoint, reason string) {
+	m.record("rejected %s %s", endpoint, reason)
+}
+
+// 测试接口请求/平台错误码/token 刷新及缓存命中都会记录监控指标
+func TestDouYinOpenApi_Metrics(t *testing.T) {
+	recorder := &recordingMetrics{}
+	openApi := newTestOpenApi(DouYinOpenApiConfig{Metrics: recorder}, func(r *http.Request) (int, string) {
+		if strings.HasSuffix(r.URL.Path, securityCensorImageV3) {
+			return http.StatusOK, `{"err_no":1,"err_msg":"bad image"}`
+		}
+		return http.StatusOK, `{"err_no":0,"data":{"access_token":"token","expires_in":7200}}`
+	})
+	_, _ = openApi.SecurityCensorImageV3(SecurityCensorImageV3Params{Image: "https://example.com/1.png"})
+	_, _ = openApi.Config.AccessToken.GetAccessToken()
+
+	want := []string{
+		"cache accessToken false",
+		"request accessToken 200 false",
+		"token_refresh tt_test false",
+		"request securityCensorImageV3 200 false",
+		"platform_error securityCensorImageV3 1",
+		"cache accessToken true",
+	}
+	if fmt.Sprint(recorder.records) != fmt.Sprint(want) {
+		t.Errorf("want %v, got %v", want, recorder.records)
+	}
+}
+
+// 测试被限流/熔断拒绝的请求单独记录, 不计入请求次数
+func TestDouYinOpenApi_MetricsRejected(t *testing.T) {
+	var limited int32 = 1
+	recorder := &recordingMetrics{}
+	openApi := newTestOpenApi(DouYinOpenApiConfig{
+		Metrics:        recorder,
+		CircuitBreaker: breaker.New(breaker.Config{MinRequests: 2}),
+		RateLimiter: limiterFunc(func(ctx context.Context, appId, endpoint string) error {
+			if atomic.CompareAndSwapInt32(&limited, 1, 0) {
+				return ratelimit.ErrLimited
+			}
+			return nil
+		}),
+		EndpointRetryPolicies: map[string]*util.RetryPolicy{EndpointQueryOrder: nil},
+	}, func(r *http.Request) (int, string) {
+		return http.StatusBadGateway, ""
+	})
+	for i := 0; i < 4; i++ {
+		_, _ = openApi.QueryOrder("1", "")
+	}
+
+	want := []string{
+		"rejected queryOrder ratelimit",
+		"request queryOrder 502 false",
+		"request queryOrder 502 false",
+		"rejected queryOrder circuit_open",
+	}
+	if fmt.Sprint(recorder.records) != fmt.Sprint(want) {
+		t.Errorf("want %v, got %v", want, recorder.records)
+	}
+}
+
+// 测试按接口分组覆盖域名, 获取 access_token 使用同一个环境
+func TestDouYinOpenApi_Environment(t *testing.T) {
+	environment := util.NewEnvironment("mock", "http://mock.local/")
+	var urls []string
+	openApi := newTestOpenApi(DouYinOpenApiConfig{
+		Environment: &environment,
+		BaseUrls:    map[Family]string{FamilyEcpay: "http://ecpay.local"},
+	}, func(r *http.Request) (int, string) {
+		urls = append(urls, r.URL.String())
+		return http.StatusOK, `{"err_no":0,"data":{"access_token":"token","expires_in":7200}}`
+	})
+	_, _ = openApi.QueryOrder("1", "")
+	_, _ = openApi.SecurityCensorImageV3(SecurityCensorImageV3Params{})
+	want := []string{
+		"http://ecpay.local" + queryOrder,
+		"http://mock.local/api/apps/v2/token",
+		"http://mock.local" + securityCensorImageV3,
+	}
+	if fmt.Sprint(urls) != fmt.Sprint(want) {
+		t.Errorf("want %v, got %v", want, urls)
+	}
+}
+
+// 测试 GET/查询参数/multipart 及原始返回内容
+func TestDouYinOpenApi_Execute(t *testing.T) {
+	openApi := NewDouYinOpenApi(DouYinOpenApiConfig{AppId: "tt_test", Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		body := `{"err_no":0,"data":{"ok":true}}`
+		switch r.URL.Path {
+		case "/qrcode":
+			if r.Method != http.MethodGet || r.URL.Query().Get("path") != "pages/index" || r.URL.Query().Get("a") != "1" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			}
+			header.Set("Content-Type", "image/png")
+			body = "\x89PNG"
+		case "/upload":
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Fatal(err)
+			}
+			file, fileHeader, err := r.FormFile("material")
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, _ := io.ReadAll(file)
+			if r.FormValue("type") != "image" || fileHeader.Filename != "a.png" || string(content) != "data" {
+				t.Errorf("unexpected multipart %v %s %s", r.MultipartForm.Value, fileHeader.Filename, content)
+			}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body)), Request: r}, nil
+	})})
+
+	var image []byte
+	err := openApi.Execute(context.Background(), &Call{
+		Endpoint: "qrcode",
+		Method:   http.MethodGet,
+		URL:      "https://example.com/qrcode?a=1",
+		Query:    url.Values{"path": {"pages/index"}},
+	}, &image)
+	if err != nil || string(image) != "\x89PNG" {
+		t.Fatalf("Execute() = %q, %v", image, err)
+	}
+
+	var res struct {
+		Data struct {
+			Ok bool `json:"ok"`
+		} `json:"data"`
+	}
+	err = openApi.Execute(context.Background(), &Call{
+		Endpoint:  "upload",
+		URL:       "https://example.com/upload",
+		Multipart: new(Multipart).AddField("type", "image").AddFile("material", "a.png", []byte("data")),
+	}, &res)
+	if err != nil || !res.Data.Ok {
+		t.Fatalf("Execute() = %+v, %v", res, err)
+	}
+}
+
+// 测试 AccessTokenLocker 配置到 DefaultAccessToken, 多个实例共享缓存时只获取一次 token
+func TestDouYinOpenApi_AccessTokenLocker(t *testing.T) {
+	var requests int32
+	shared, locker := cache.NewMemory(), lock.NewMemory()
+	handler := func(r *http.Request) (int, string) {
+		n := atomic.AddInt32(&requests, 1)
+		time.Sleep(50 * time.Millisecond)
+		return http.StatusOK, fmt.Sprintf(`{"err_no":0,"data":{"access_token":"token_%d","expires_in":7200}}`, n)
+	}
+	instances := []*DouYinOpenApi{
+		newTestOpenApi(DouYinOpenApiConfig{Cache: shared, AccessTokenLocker: locker}, handler),
+		newTestOpenApi(DouYinOpenApiConfig{Cache: shared, AccessTokenLocker: locker}, handler),
+	}
+	var wg sync.WaitGroup
+	for _, instance := range instances {
+		wg.Add(1)
+		go func(instance *DouYinOpenApi) {
+			defer wg.Done()
+			if token, err := instance.Config.AccessToken.GetAccessToken(); err != nil || token != "token_1" {
+				t.Errorf("GetAccessToken() = %s, %v", token, err)
+			}
+		}(instance)
+	}
+	wg.Wait()
+	if requests != 1 {
+		t.Errorf("want 1 token request, got %d", requests)
+	}
+}
+
+// 测试 access_token 被提前拒绝时作废缓存并重放一次, 新 token 仍被拒绝时不再反复刷新
+func TestDouYinOpenApi_InvalidateToken(t *testing.T) {
+	var tokens int32
+	var valid atomic.Value
+	valid.Store("token_2")
+	openApi := newTestOpenApi(DouYinOpenApiConfig{Cache: cache.NewMemory()}, func(r *http.Request) (int, string) {
+		if strings.HasSuffix(r.URL.Path, securityCensorText) {
+			if r.Header.Get("X-Token") != valid.Load().(string) {
+				return http.StatusOK, `{"err_no":28001003,"err_tips":"access_token 无效"}`
+			}
+			return http.StatusOK, `{"log_id":"1","data":[{"code":0,"task_id":"task"}]}`
+		}
+		time.Sleep(20 * time.Millisecond)
+		n := atomic.AddInt32(&tokens, 1)
+		return http.StatusOK, fmt.Sprintf(`{"err_no":0,"data":{"access_token":"token_%d","expires_in":7200}}`, n)
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = openApi.SecurityCensorText("text")
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("SecurityCensorText() error = %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&tokens); n != 2 {
+		t.Fatalf("want 2 token requests, got %d", n)
+	}
+
+	// 新的 token 也被拒绝时直接返回错误
+	valid.Store("")
+	if _, err := openApi.SecurityCensorText("text"); !IsAuthError(err) {
+		t.Fatalf("want auth error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&tokens); n != 2 {
+		t.Errorf("want no more token requests, got %d", n)
+	}
+}
+
+// 测试图片检测 v2 以 error=2 返回 token 校验失败时同样作废 token 并重放
+func TestDouYinOpenApi_InvalidateTokenImageV2(t *testing.T) {
+	var tokens int32
+	openApi := newTestOpenApi(DouYinOpenApiConfig{}, func(r *http.Request) (int, string) {
+		if r.URL.Path == securityCensorImageV2 {
+			var params SecurityCensorImageV2Params
+			_ = json.NewDecoder(r.Body).Decode(&params)
+			if params.AccessToken != "token_2" {
+				return http.StatusOK, `{"error":2,"message":"access_token 校验失败"}`
+			}
+			return http.StatusOK, `{"error":0,"predicts":[{"model_name":"porn","hit":false}]}`
+		}
+		return http.StatusOK, fmt.Sprintf(`{"err_no":0,"data":{"access_token":"token_%d","expires_in":7200}}`, atomic.AddInt32(&tokens, 1))
+	})
+
+	res, err := openApi.SecurityCensorImageV2(SecurityCensorImageV2Params{Image: "https://example.com/1.png"})
+	if err != nil || len(res.Predicts) != 1 {
+		t.Fatalf("SecurityCensorImageV2() = %+v, %v", res, err)
+	}
+	if n := atomic.LoadInt32(&tokens); n != 2 {
+		t.Errorf("want 2 token requests, got %d", n)
+	}
+	// 其他接口的 code=2 不是鉴权错误
+	if IsAuthError(&APIError{Endpoint: EndpointSecurityCensorImageV3, Code: 2}) {
+		t.Error("code 2 should only be an auth error for image v2")
+	}
+}
+
+// 测试配置 ClientKey/ClientSecret 后用户授权使用相同的请求执行器
+func TestDouYinOpenApi_UserTokens(t *testing.T) {
+	openApi := newTestOpenApi(DouYinOpenApiConfig{ClientKey: "client_key", ClientSecret: "client_secret"}, func(r *http.Request) (int, string) {
+		if r.URL.Path != "/oauth/access_token/" {
+			return http.StatusNotFound, ""
+		}
+		return http.StatusOK, `{"data":{"error_code":0,"access_token":"access_1","expires_in":1296000,"open_id":"open_id","refresh_token":"refresh_1","refresh_expires_in":2592000,"scope":"user_info"},"message":"success"}`
+	})
+	if _, err := openApi.UserTokens.ExchangeCode("code"); err != nil {
+		t.Fatalf("ExchangeCode() error = %v", err)
+	}
+	if userToken, err := openApi.UserTokens.GetAccessToken("open_id"); err != nil || userToken != "access_1" {
+		t.Fatalf("GetAccessToken() = %s, %v", userToken, err)
+	}
+}
+
+// 测试开放平台接口使用 client_token, 被拒绝时作废并重新获取
+func TestDouYinOpenApi_ClientToken(t *testing.T) {
+	var clientTokens, appTokens int32
+	openApi := newTestOpenApi(DouYinOpenApiConfig{ClientKey: "client_key", ClientSecret: "client_secret"}, func(r *http.Request) (int, string) {
+		switch r.URL.Path {
+		case "/oauth/client_token/":
+			n := atomic.AddInt32(&clientTokens, 1)
+			return http.StatusOK, fmt.Sprintf(`{"data":{"error_code":0,"access_token":"clt.%d","expires_in":7200},"message":"success"}`, n)
+		case "/data/external/item/base/":
+			if r.Header.Get("access-token") != "clt.2" {
+				return http.StatusOK, `{"data":{"error_code":2190008,"description":"access_token过期"},"extra":{"logid":"2"}}`
+			}
+			return http.StatusOK, `{"data":{"error_code":0,"result":{"play_count":1}},"extra":{"logid":"3"}}`
+		}
+		atomic.AddInt32(&appTokens, 1)
+		return http.StatusOK, `{"err_no":0,"data":{"access_token":"token","expires_in":7200}}`
+	})
+	if _, ok := openApi.GetAccessTokenFor(FamilyOpenPlatform).(*accessToken.ClientToken); !ok {
+		t.Fatalf("want ClientToken for open platform, got %T", openApi.GetAccessTokenFor(FamilyOpenPlatform))
+	}
+	if openApi.GetAccessTokenFor(FamilyMiniApp) != openApi.Config.AccessToken {
+		t.Fatal("want default AccessToken for mini app")
+	}
+
+	var res struct {
+		Data struct {
+			Result struct {
+				PlayCount int `json:"play_count"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	err := openApi.Execute(context.Background(), &Call{
+		Endpoint: "itemBase",
+		Family:   FamilyOpenPlatform,
+		URL:      openApi.Environment.Url(FamilyOpenPlatform, "/data/external/item/base/"),
+		Auth:     util.HeaderAuth("access-token"),
+	}, &res)
+	if err != nil || res.Data.Result.PlayCount != 1 {
+		t.Fatalf("Execute() = %+v, %v", res, err)
+	}
+	if clientTokens != 2 || appTokens != 0 {
+		t.Errorf("want 2 client_token and 0 app token requests, got %d and %d", clientTokens, appTokens)
+	}
+}
+
+// 测试按接口分组查询 token 有效期/立即刷新, 刷新回调配置到 DefaultAccessToken
+func TestDouYinOpenApi_TokenInfo(t *testing.T) {
+	var refreshed int32
+	openApi := newTestOpenApi(DouYinOpenApiConfig{
+		TokenRefreshHooks: accessToken.RefreshHooks{
+			OnRefresh: func(event accessToken.RefreshEvent) { atomic.AddInt32(&refreshed, 1) },
+		},
+	}, func(r *http.Request) (int, string) {
+		return http.StatusOK, fmt.Sprintf(`{"err_no":0,"data":{"access_token":"token_%d","expires_in":7200}}`, atomic.LoadInt32(&refreshed)+1)
+	})
+
+	info, err := openApi.GetAccessTokenInfo(FamilyMiniApp)
+	if err != nil || info.AccessToken != "token_1" || !info.Known() {
+		t.Fatalf("GetAccessTokenInfo() = %+v, %v", info, err)
+	}
+	if info, err = openApi.ForceRefreshAccessToken(FamilyMiniApp); err != nil || info.AccessToken != "token_2" {
+		t.Fatalf("ForceRefreshAccessToken() = %+v, %v", info, err)
+	}
+	if token, _ := openApi.Config.AccessToken.GetAccessToken(); token != "token_2" || refreshed != 2 {
+		t.Errorf("want cached token_2 after 2 refreshes, got %s after %d", token, refreshed)
+	}
+}
@@ -0,0 +1,308 @@
+package douyintest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Mode 录制回放模式
+type Mode int
+
+const (
+	ModeReplay Mode = iota // 回放: 从 fixture 文件返回结果, 遇到未录制的请求时报错
+	ModeRecord             // 录制: 请求真实接口并保存到 fixture 文件
+)
+
+// Redacted 脱敏后的占位值
+const Redacted = "REDACTED"
+
+// DefaultRedactFields 默认脱敏的 json 字段及 query 参数
+var DefaultRedactFields = []string{
+	"secret", "app_secret", "access_token", "sign", "salt", "token",
+	"session_key", "msg_signature", "refresh_token", "client_secret",
+}
+
+// DefaultRedactHeaders 默认脱敏的请求头
+var DefaultRedactHeaders = []string{"X-Token", "Access-Token", "Authorization", "Byte-Authorization"}
+
+// ErrUnmatched 回放模式下请求没有匹配的录制结果
+var ErrUnmatched = errors.New("douyintest: no recorded interaction matches request")
+
+// RecordedRequest 录制的请求
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse 录制的返回值
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Interaction 一次请求及其返回值
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// Matcher 判断录制的请求与实际请求是否匹配, 两者都已经脱敏
+type Matcher func(recorded, actual RecordedRequest) bool
+
+// DefaultMatcher 默认按请求方法/路径/query/json 内容匹配, 不比较域名及请求头
+func DefaultMatcher(recorded, actual RecordedRequest) bool {
+	return recorded.Method == actual.Method &&
+		recorded.Path == actual.Path &&
+		recorded.Query == actual.Query &&
+		jsonEqual(recorded.Body, actual.Body)
+}
+
+// Recorder 录制回放的 http.RoundTripper, 可以通过 DouYinOpenApiConfig.Transport 注入
+type Recorder struct {
+	Mode          Mode              // 录制或回放
+	Path          string            // fixture 文件路径
+	Transport     http.RoundTripper // 录制时实际发送请求的 Transport, 为空时使用 http.DefaultTransport
+	RedactFields  []string          // 需要脱敏的 json 字段及 query 参数
+	RedactHeaders []string          // 需要脱敏的请求头
+	Matcher       Matcher           // 回放时的匹配规则
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewRecorder 实例化录制回放器, 回放模式下会读取 fixture 文件
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		Mode:          mode,
+		Path:          path,
+		RedactFields:  DefaultRedactFields,
+		RedactHeaders: DefaultRedactHeaders,
+		Matcher:       DefaultMatcher,
+	}
+	if mode == ModeReplay {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(content, &r.interactions); err != nil {
+			return nil, fmt.Errorf("douyintest: parse fixture %s: %w", path, err)
+		}
+		r.used = make([]bool, len(r.interactions))
+	}
+	return r, nil
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	recorded := r.redactRequest(req, body)
+	if r.Mode == ModeRecord {
+		return r.record(req, recorded)
+	}
+	return r.replay(req, recorded)
+}
+
+// record 请求真实接口并记录
+func (r *Recorder) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, Interaction{
+		Request: recorded,
+		Response: RecordedResponse{
+			StatusCode: res.StatusCode,
+			Header:     res.Header.Clone(),
+			Body:       r.redactBody(body),
+		},
+	})
+	r.mu.Unlock()
+
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
+
+// replay 返回第一个未使用且匹配的录制结果
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	matcher := r.Matcher
+	if matcher == nil {
+		matcher = DefaultMatcher
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if r.used[i] || !matcher(interaction.Request, recorded) {
+			continue
+		}
+		r.used[i] = true
+		header := interaction.Response.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s %s", ErrUnmatched, recorded.Method, recorded.Path, recorded.Body)
+}
+
+// Save 录制模式下将录制结果写入 fixture 文件
+func (r *Recorder) Save() error {
+	if r.Mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	content, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.Path, content, 0o644)
+}
+
+// Interactions 已经录制或读取的请求
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// Unused 回放模式下没有被请求过的录制结果, 可用于断言所有预期的请求都已经发生
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Interaction
+	for i, interaction := range r.interactions {
+		if !r.used[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+// redactRequest 记录并脱敏请求
+func (r *Recorder) redactRequest(req *http.Request, body []byte) RecordedRequest {
+	header := http.Header{}
+	for _, name := range r.RedactHeaders {
+		if req.Header.Get(name) != "" {
+			header.Set(name, Redacted)
+		}
+	}
+	if len(header) == 0 {
+		header = nil
+	}
+	query := req.URL.Query()
+	for _, name := range r.RedactFields {
+		if query.Has(name) {
+			query.Set(name, Redacted)
+		}
+	}
+	return RecordedRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  query.Encode(),
+		Header: header,
+		Body:   r.redactBody(body),
+	}
+}
+
+// redactBody 脱敏 json 内容, 非 json 内容原样返回
+func (r *Recorder) redactBody(body []byte) string {
+	var content interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&content); err != nil {
+		return string(body)
+	}
+	fields := make(map[string]bool, len(r.RedactFields))
+	for _, name := range r.RedactFields {
+		fields[name] = true
+	}
+	redacted, err := json.Marshal(redactValue(content, fields))
+	if err != nil {
+		return string(body)
+	}
+	return string(redacted)
+}
+
+// redactValue 递归脱敏
+func redactValue(value interface{}, fields map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if fields[key] {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = redactValue(item, fields)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item, fields)
+		}
+	}
+	return value
+}
+
+// readRequestBody 读取请求内容并重置以便后续发送
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// jsonEqual 比较两段 json 内容是否相等, 非 json 时比较原文
+func jsonEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return bytes.Equal(ca, cb)
+}
+
+var _ http.RoundTripper = (*Recorder)(nil)
@@ -0,0 +1,89 @@
+package douyintest
+
+import (
+	"errors"
+	douyin "github.com/38888/douyin-openapi"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// roundTripFunc 测试用的 RoundTripper
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// fakeDouyin 模拟抖音接口的返回值
+var fakeDouyin = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+	body := `{"err_no":0,"err_tips":"","data":{"order_id":"N1","order_token":"order_token"}}`
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/create_refund"):
+		body = `{"err_no":0,"err_tips":"","refund_no":"R1"}`
+	case strings.HasSuffix(r.URL.Path, "/settle"):
+		body = `{"err_no":0,"err_tips":"","settle_no":"S1"}`
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(body)), Request: r}, nil
+})
+
+// runFlow 下单 -> 退款 -> 结算
+func runFlow(t *testing.T, transport http.RoundTripper) {
+	openApi := douyin.NewDouYinOpenApi(douyin.DouYinOpenApiConfig{
+		AppId:     "tt_test",
+		Salt:      "real_salt",
+		Transport: transport,
+	})
+	order, err := openApi.CreateOrder(douyin.CreateOrderParams{OutOrderNo: "O1", TotalAmount: 1, Subject: "s", Body: "b", ValidTime: 300})
+	if err != nil || order.Data.OrderId != "N1" {
+		t.Fatalf("CreateOrder() = %+v, %v", order, err)
+	}
+	refund, err := openApi.CreateRefund(douyin.CreateRefundParams{OutOrderNo: "O1", OutRefundNo: "R1", Reason: "r", RefundAmount: 1})
+	if err != nil || refund.RefundNo != "R1" {
+		t.Fatalf("CreateRefund() = %+v, %v", refund, err)
+	}
+	settle, err := openApi.Settle(douyin.SettleParams{OutOrderNo: "O1", OutSettleNo: "S1", SettleDesc: "d"})
+	if err != nil || settle.SettleNo != "S1" {
+		t.Fatalf("Settle() = %+v, %v", settle, err)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flow.json")
+
+	recorder, err := NewRecorder(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Transport = fakeDouyin
+	runFlow(t, recorder)
+	if err = recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(content), Redacted) || strings.Contains(string(content), "real_salt") {
+		t.Fatalf("unexpected fixture content: %s", content)
+	}
+	if len(recorder.Interactions()) != 3 {
+		t.Fatalf("want 3 interactions, got %d", len(recorder.Interactions()))
+	}
+
+	replay, err := NewRecorder(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFlow(t, replay)
+	if unused := replay.Unused(); len(unused) != 0 {
+		t.Errorf("want all interactions used, got %d unused", len(unused))
+	}
+
+	// 未录制的请求直接失败, 不重试
+	openApi := douyin.NewDouYinOpenApi(douyin.DouYinOpenApiConfig{AppId: "tt_test", Salt: "real_salt", Transport: replay})
+	_, err = openApi.QueryOrder("O2", "")
+	var apiErr *douyin.APIError
+	if !errors.Is(err, ErrUnmatched) || !errors.As(err, &apiErr) || apiErr.Attempts != 1 {
+		t.Errorf("want ErrUnmatched after 1 attempt, got %v", err)
+	}
+}
@@ -0,0 +1,753 @@
+package douyintest
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	douyin "github.com/38888/douyin-openapi"
+	"github.com/38888/douyin-openapi/sign"
+	"github.com/38888/douyin-openapi/util"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 模拟服务返回的错误码
+const (
+	ErrNoSystem      = -1       // 系统错误
+	ErrNoParam       = 40014    // 参数错误
+	ErrNoSecret      = 40017    // appid 或 secret 错误
+	ErrNoCode        = 40018    // code 无效
+	ErrNoSign        = 2008     // 签名错误
+	ErrNoNotFound    = 2009     // 单号不存在
+	ErrNoStatus      = 2010     // 当前状态不允许该操作
+	ErrNoAmount      = 2011     // 金额错误
+	ErrNoAccessToken = 28001003 // access_token 无效
+)
+
+// 订单/退款/结算状态
+const (
+	StatusProcessing = "PROCESSING"
+	StatusSuccess    = "SUCCESS"
+	StatusFail       = "FAIL"
+)
+
+// ServerConfig 模拟服务的配置, 需要与 DouYinOpenApiConfig 保持一致
+type ServerConfig struct {
+	AppId       string         // 小程序 app_id
+	AppSecret   string         // 小程序 secret
+	Salt        string         // 担保支付的 SALT, 用于校验请求签名
+	Token       string         // 担保支付的 Token, 用于回调签名
+	BannedWords []string       // 内容安全检测命中的词
+	TokenTTL    int            // access_token 的有效期(秒), 默认 7200
+	PublicKey   *rsa.PublicKey // 开发者公钥, 设置后担保支付接口校验 Byte-Authorization 请求头而不是 sign 字段
+}
+
+// Order 模拟服务中的订单
+type Order struct {
+	Params      douyin.CreateOrderParams
+	OrderId     string
+	Status      string
+	PaidAt      int64
+	Refunded    int64
+	SettleNo    string
+	RefundNos   []string
+	PaymentNo   string
+	ChannelType int
+}
+
+// Refund 模拟服务中的退款单
+type Refund struct {
+	Params     douyin.CreateRefundParams
+	RefundNo   string
+	Status     string
+	RefundedAt int64
+}
+
+// Settle 模拟服务中的结算单
+type Settle struct {
+	Params    douyin.SettleParams
+	SettleNo  string
+	Amount    int64
+	Status    string
+	SettledAt int64
+}
+
+// Server 进程内模拟的抖音 OpenAPI 服务, 实现 access_token/登录/担保支付/内容安全/订单推送接口
+// 请求签名按 Salt 校验, 支付/退款/结算完成时会向 notify_url 发送带签名的回调
+type Server struct {
+	*httptest.Server
+	Config ServerConfig
+
+	// CallbackClient 发送回调使用的 http 客户端
+	CallbackClient *http.Client
+
+	mu           sync.Mutex
+	seq          int
+	accessTokens map[string]time.Time
+	orders       map[string]*Order
+	refunds      map[string]*Refund
+	settles      map[string]*Settle
+	pushes       []douyin.OrderV2PushParams
+	openIds      map[string]string
+}
+
+// NewServer 启动一个模拟服务, 使用完成后需要调用 Close
+func NewServer(config ServerConfig) *Server {
+	if config.TokenTTL == 0 {
+		config.TokenTTL = 7200
+	}
+	s := &Server{
+		Config:         config,
+		CallbackClient: &http.Client{Timeout: 5 * time.Second},
+		accessTokens:   map[string]time.Time{},
+		orders:         map[string]*Order{},
+		refunds:        map[string]*Refund{},
+		settles:        map[string]*Settle{},
+		openIds:        map[string]string{},
+	}
+	s.Server = httptest.NewServer(s.Handler())
+	return s
+}
+
+// Environment 指向模拟服务的接口环境, 可用于 DouYinOpenApiConfig.Environment
+func (s *Server) Environment() *util.Environment {
+	environment := util.NewEnvironment("douyintest", s.URL)
+	return &environment
+}
+
+// Handler 模拟服务的路由
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	routes := map[string]func(body []byte, fields map[string]interface{}, r *http.Request) interface{}{
+		"/api/apps/v2/token":                          s.token,
+		"/api/apps/v2/jscode2session":                 s.code2Session,
+		"/api/apps/ecpay/v1/create_order":             s.createOrder,
+		"/api/apps/ecpay/v1/query_order":              s.queryOrder,
+		"/api/apps/ecpay/v1/create_refund":            s.createRefund,
+		"/api/apps/ecpay/v1/query_refund":             s.queryRefund,
+		"/api/apps/ecpay/v1/settle":                   s.settle,
+		"/api/apps/ecpay/v1/query_settle":             s.querySettle,
+		"/api/apps/ecpay/v1/unsettle_amount":          s.unsettleAmount,
+		"/api/apps/ecpay/v1/create_return":            s.createReturn,
+		"/api/apps/ecpay/v1/query_return":             s.queryReturn,
+		"/api/apps/ecpay/saas/query_merchant_balance": s.queryMerchantBalance,
+		"/api/apps/ecpay/saas/merchant_withdraw":      s.merchantWithdraw,
+		"/api/apps/ecpay/saas/query_withdraw_order":   s.queryWithdrawOrder,
+		"/api/v2/tags/text/antidirt":                  s.censorText,
+		"/api/apps/censor/image":                      s.censorImageV2,
+		"/api/apps/v1/censor/image/":                  s.censorImageV3,
+		"/api/apps/order/v2/push":                     s.orderPush,
+	}
+	for path, handler := range routes {
+		handler := handler
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{"err_no": ErrNoParam, "err_tips": "method not allowed"})
+				return
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, errNo(ErrNoParam, err.Error()))
+				return
+			}
+			var fields map[string]interface{}
+			if err = json.Unmarshal(body, &fields); err != nil {
+				writeJSON(w, http.StatusBadRequest, errNo(ErrNoParam, "invalid json"))
+				return
+			}
+			s.mu.Lock()
+			response := handler(body, fields, r)
+			logId := s.logId()
+			s.mu.Unlock()
+			w.Header().Set("X-Tt-Logid", logId)
+			writeJSON(w, http.StatusOK, response)
+		})
+	}
+	return mux
+}
+
+// token 获取 access_token
+func (s *Server) token(_ []byte, fields map[string]interface{}, _ *http.Request) interface{} {
+	if fields["appid"] != s.Config.AppId || fields["secret"] != s.Config.AppSecret {
+		return errNo(ErrNoSecret, "bad appid or secret")
+	}
+	if fields["grant_type"] != "client_credential" {
+		return errNo(ErrNoParam, "bad grant_type")
+	}
+	token := fmt.Sprintf("access_token_%d", s.next())
+	s.accessTokens[token] = time.Now().Add(time.Duration(s.Config.TokenTTL) * time.Second)
+	return map[string]interface{}{
+		"err_no":   0,
+		"err_tips": "success",
+		"data":     map[string]interface{}{"access_token": token, "expires_in": s.Config.TokenTTL},
+	}
+}
+
+// code2Session 小程序登录, 同一个 code 返回同一个 openid
+func (s *Server) code2Session(_ []byte, fields map[string]interface{}, _ *http.Request) interface{} {
+	if fields["appid"] != s.Config.AppId || fields["secret"] != s.Config.AppSecret {
+		return errNo(ErrNoSecret, "bad appid or secret")
+	}
+	code, _ := fields["code"].(string)
+	anonymousCode, _ := fields["anonymous_code"].(string)
+	if code == "" && anonymousCode == "" {
+		return errNo(ErrNoCode, "bad code")
+	}
+	data := map[string]interface{}{"session_key": fmt.Sprintf("session_key_%d", s.next())}
+	if code != "" {
+		data["openid"] = s.openId(code)
+		data["unionid"] = "union_" + s.openId(code)
+	}
+	if anonymousCode != "" {
+		data["anonymous_openid"] = s.openId("anonymous_" + anonymousCode)
+	}
+	return map[string]interface{}{"err_no": 0, "err_tips": "success", "data": data}
+}
+
+// createOrder 预下单, 相同 out_order_no 重复下单返回同一个订单
+func (s *Server) createOrder(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.CreateOrderParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	if params.OutOrderNo == "" || params.TotalAmount <= 0 || params.Subject == "" || params.Body == "" {
+		return errNo(ErrNoParam, "missing required params")
+	}
+	order, ok := s.orders[params.OutOrderNo]
+	if !ok {
+		order = &Order{Params: params, OrderId: fmt.Sprintf("N%d", s.next()), Status: StatusProcessing}
+		s.orders[params.OutOrderNo] = order
+	}
+	return map[string]interface{}{
+		"err_no":   0,
+		"err_tips": "",
+		"data":     map[string]interface{}{"order_id": order.OrderId, "order_token": "order_token_" + order.OrderId},
+	}
+}
+
+// queryOrder 订单查询
+func (s *Server) queryOrder(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.QueryOrderParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	order, ok := s.orders[params.OutOrderNo]
+	if !ok {
+		return errNo(ErrNoNotFound, "order not found")
+	}
+	paymentInfo := map[string]interface{}{
+		"total_fee":    order.Params.TotalAmount,
+		"order_status": order.Status,
+		"way":          order.ChannelType,
+		"channel_no":   order.PaymentNo,
+	}
+	if order.PaidAt > 0 {
+		paymentInfo["pay_time"] = time.Unix(order.PaidAt, 0).Format("2006-01-02 15:04:05")
+	}
+	return map[string]interface{}{
+		"err_no":       0,
+		"err_tips":     "",
+		"out_order_no": params.OutOrderNo,
+		"order_id":     order.OrderId,
+		"payment_info": paymentInfo,
+	}
+}
+
+// createRefund 发起退款, 订单需已支付且未结算, 退款在 CompleteRefund 后完成
+func (s *Server) createRefund(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.CreateRefundParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	if refund, ok := s.refunds[params.OutRefundNo]; ok {
+		return map[string]interface{}{"err_no": 0, "err_tips": "", "refund_no": refund.RefundNo}
+	}
+	order, ok := s.orders[params.OutOrderNo]
+	if !ok {
+		return errNo(ErrNoNotFound, "order not found")
+	}
+	if order.Status != StatusSuccess || order.SettleNo != "" {
+		return errNo(ErrNoStatus, "order is not refundable")
+	}
+	if params.RefundAmount <= 0 || order.Refunded+int64(params.RefundAmount) > order.Params.TotalAmount {
+		return errNo(ErrNoAmount, "refund amount exceeds the order amount")
+	}
+	order.Refunded += int64(params.RefundAmount)
+	refund := &Refund{Params: params, RefundNo: fmt.Sprintf("R%d", s.next()), Status: StatusProcessing}
+	s.refunds[params.OutRefundNo] = refund
+	order.RefundNos = append(order.RefundNos, params.OutRefundNo)
+	return map[string]interface{}{"err_no": 0, "err_tips": "", "refund_no": refund.RefundNo}
+}
+
+// queryRefund 退款结果查询
+func (s *Server) queryRefund(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.QueryRefundParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	refund, ok := s.refunds[params.OutRefundNo]
+	if !ok {
+		return errNo(ErrNoNotFound, "refund not found")
+	}
+	return map[string]interface{}{
+		"err_no":   0,
+		"err_tips": "",
+		"refundInfo": map[string]interface{}{
+			"refund_no":      refund.RefundNo,
+			"refund_amount":  refund.Params.RefundAmount,
+			"refund_status":  refund.Status,
+			"refunded_at":    refund.RefundedAt,
+			"is_all_settled": false,
+			"cp_extra":       refund.Params.CpExtra,
+		},
+	}
+}
+
+// settle 发起结算, 订单需已支付且没有处理中的退款, 结算在 CompleteSettle 后完成
+func (s *Server) settle(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.SettleParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	if settle, ok := s.settles[params.OutSettleNo]; ok {
+		return map[string]interface{}{"err_no": 0, "err_tips": "", "settle_no": settle.SettleNo}
+	}
+	order, ok := s.orders[params.OutOrderNo]
+	if !ok {
+		return errNo(ErrNoNotFound, "order not found")
+	}
+	if order.Status != StatusSuccess || order.SettleNo != "" {
+		return errNo(ErrNoStatus, "order is not settleable")
+	}
+	for _, outRefundNo := range order.RefundNos {
+		if s.refunds[outRefundNo].Status == StatusProcessing {
+			return errNo(ErrNoStatus, "order has processing refund")
+		}
+	}
+	settle := &Settle{
+		Params:   params,
+		SettleNo: fmt.Sprintf("S%d", s.next()),
+		Amount:   order.Params.TotalAmount - order.Refunded,
+		Status:   StatusProcessing,
+	}
+	s.settles[params.OutSettleNo] = settle
+	order.SettleNo = params.OutSettleNo
+	return map[string]interface{}{"err_no": 0, "err_tips": "", "settle_no": settle.SettleNo}
+}
+
+// querySettle 结算结果查询
+func (s *Server) querySettle(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.QuerySettleParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	settle, ok := s.settles[params.OutSettleNo]
+	if !ok {
+		return errNo(ErrNoNotFound, "settle not found")
+	}
+	return map[string]interface{}{
+		"err_no":   0,
+		"err_tips": "",
+		"settle_info": map[string]interface{}{
+			"settle_no":     settle.SettleNo,
+			"settle_amount": settle.Amount,
+			"settle_status": settle.Status,
+			"settled_at":    settle.SettledAt,
+			"cp_extra":      settle.Params.CpExtra,
+		},
+	}
+}
+
+// unsettleAmount 可分账余额查询
+func (s *Server) unsettleAmount(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.UnsettleAmountParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	order, ok := s.orders[params.OutOrderNo]
+	if !ok {
+		return errNo(ErrNoNotFound, "order not found")
+	}
+	var amount int64
+	if order.Status == StatusSuccess && order.SettleNo == "" {
+		amount = order.Params.TotalAmount - order.Refunded
+	}
+	return map[string]interface{}{
+		"err_no":   0,
+		"err_tips": "",
+		"data":     map[string]interface{}{"out_order_no": params.OutOrderNo, "unsettle_amount": amount},
+	}
+}
+
+// createReturn 退分账, 模拟服务直接返回成功
+func (s *Server) createReturn(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.CreateReturnParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	if _, ok := s.settles[params.OutSettleNo]; !ok {
+		return errNo(ErrNoNotFound, "settle not found")
+	}
+	return map[string]interface{}{
+		"err_no":   0,
+		"err_tips": "",
+		"return_info": map[string]interface{}{
+			"out_settle_no": params.OutSettleNo,
+			"out_return_no": params.OutReturnNo,
+			"return_amount": params.ReturnAmount,
+			"return_status": StatusSuccess,
+			"return_no":     "RT" + params.OutReturnNo,
+		},
+	}
+}
+
+// queryReturn 退分账结果查询
+func (s *Server) queryReturn(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.QueryReturnParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	return map[string]interface{}{
+		"err_no":      0,
+		"err_tips":    "",
+		"return_info": map[string]interface{}{"out_return_no": params.OutReturnNo, "return_status": StatusSuccess},
+	}
+}
+
+// queryMerchantBalance 商户余额查询, 余额为已结算金额之和
+func (s *Server) queryMerchantBalance(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.QueryMerchantBalanceParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	var balance int64
+	for _, settle := range s.settles {
+		if settle.Status == StatusSuccess {
+			balance += settle.Amount
+		}
+	}
+	return map[string]interface{}{
+		"err_no":       0,
+		"err_tips":     "",
+		"account_info": map[string]interface{}{"online_balance": balance, "withdrawable_balacne": balance},
+	}
+}
+
+// merchantWithdraw 商户提现, 模拟服务直接受理
+func (s *Server) merchantWithdraw(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.MerchantWithdrawParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	return map[string]interface{}{"err_no": 0, "err_tips": "", "order_id": "W" + params.OutOrderId}
+}
+
+// queryWithdrawOrder 提现结果查询
+func (s *Server) queryWithdrawOrder(body []byte, fields map[string]interface{}, r *http.Request) interface{} {
+	var params douyin.QueryWithdrawOrderParams
+	if res := s.checkEcpay(r, body, fields, &params); res != nil {
+		return res
+	}
+	return map[string]interface{}{"err_no": 0, "err_tips": "", "status": StatusSuccess}
+}
+
+// censorText 文本内容安全检测, token 在 X-Token 请求头中
+func (s *Server) censorText(body []byte, _ map[string]interface{}, r *http.Request) interface{} {
+	if !s.validToken(r.Header.Get("X-Token")) {
+		return map[string]interface{}{"code": 401, "message": "invalid access token", "log_id": s.logId()}
+	}
+	var params douyin.SecurityCensorTextParams
+	_ = json.Unmarshal(body, &params)
+	data := make([]map[string]interface{}, 0, len(params.Tasks))
+	for i, task := range params.Tasks {
+		data = append(data, map[string]interface{}{
+			"code":    0,
+			"task_id": fmt.Sprintf("task_%d", i),
+			"predicts": []map[string]interface{}{
+				{"prob": 1, "hit": s.banned(task.Value), "target": nil, "model_name": "short_content_antispam"},
+			},
+		})
+	}
+	return map[string]interface{}{"log_id": s.logId(), "data": data}
+}
+
+// censorImageV2 图片内容安全检测, token 在 body 的 access_token 字段中
+func (s *Server) censorImageV2(body []byte, _ map[string]interface{}, _ *http.Request) interface{} {
+	var params douyin.SecurityCensorImageV2Params
+	_ = json.Unmarshal(body, &params)
+	if !s.validToken(params.AccessToken) {
+		return map[string]interface{}{"error": 2, "message": "access_token 校验失败"}
+	}
+	return map[string]interface{}{"error": 0, "message": "", "predicts": s.imagePredicts(params.Image)}
+}
+
+// censorImageV3 图片内容安全检测, token 在 access-token 请求头中
+func (s *Server) censorImageV3(body []byte, _ map[string]interface{}, r *http.Request) interface{} {
+	if !s.validToken(r.Header.Get("access-token")) {
+		return errMsg(ErrNoAccessToken, "access token is invalid")
+	}
+	var params douyin.SecurityCensorImageV3Params
+	_ = json.Unmarshal(body, &params)
+	return map[string]interface{}{"err_no": 0, "err_msg": "", "log_id": s.logId(), "predicts": s.imagePredicts(params.Image)}
+}
+
+// orderPush 订单推送, token 在 body 的 access_token 字段中
+func (s *Server) orderPush(body []byte, _ map[string]interface{}, _ *http.Request) interface{} {
+	var params douyin.OrderV2PushParams
+	_ = json.Unmarshal(body, &params)
+	if !s.validToken(params.AccessToken) {
+		return map[string]interface{}{"err_code": ErrNoAccessToken, "err_msg": "access token is invalid", "body": ""}
+	}
+	if params.OpenId == "" || params.OrderDetail == "" {
+		return map[string]interface{}{"err_code": ErrNoParam, "err_msg": "missing required params", "body": ""}
+	}
+	s.pushes = append(s.pushes, params)
+	return map[string]interface{}{"err_code": 0, "err_msg": "", "body": ""}
+}
+
+// PayOrder 模拟用户完成支付, 订单置为成功并向 notify_url 发送支付回调
+func (s *Server) PayOrder(outOrderNo string) error {
+	s.mu.Lock()
+	order, ok := s.orders[outOrderNo]
+	if !ok || order.Status != StatusProcessing {
+		s.mu.Unlock()
+		return fmt.Errorf("douyintest: order %s is not payable", outOrderNo)
+	}
+	order.Status = StatusSuccess
+	order.PaidAt = time.Now().Unix()
+	order.ChannelType = 10
+	order.PaymentNo = fmt.Sprintf("P%d", s.next())
+	msg := map[string]interface{}{
+		"appid":            s.Config.AppId,
+		"cp_orderno":       outOrderNo,
+		"cp_extra":         order.Params.CpExtra,
+		"way":              strconv.Itoa(order.ChannelType),
+		"payment_order_no": order.PaymentNo,
+		"channel_no":       order.PaymentNo,
+		"total_amount":     order.Params.TotalAmount,
+		"status":           StatusSuccess,
+		"seller_uid":       "seller",
+		"paid_at":          order.PaidAt,
+		"order_id":         order.OrderId,
+	}
+	notifyUrl := order.Params.NotifyUrl
+	s.mu.Unlock()
+	return s.SendCallback(notifyUrl, "payment", msg)
+}
+
+// CompleteRefund 模拟退款完成, 退款单置为成功并向 notify_url 发送退款回调
+func (s *Server) CompleteRefund(outRefundNo string) error {
+	s.mu.Lock()
+	refund, ok := s.refunds[outRefundNo]
+	if !ok || refund.Status != StatusProcessing {
+		s.mu.Unlock()
+		return fmt.Errorf("douyintest: refund %s is not processing", outRefundNo)
+	}
+	refund.Status = StatusSuccess
+	refund.RefundedAt = time.Now().Unix()
+	msg := map[string]interface{}{
+		"appid":          s.Config.AppId,
+		"cp_refundno":    outRefundNo,
+		"cp_extra":       refund.Params.CpExtra,
+		"status":         StatusSuccess,
+		"refund_amount":  refund.Params.RefundAmount,
+		"is_all_settled": false,
+		"refunded_at":    refund.RefundedAt,
+		"message":        "",
+		"order_id":       s.orders[refund.Params.OutOrderNo].OrderId,
+		"refund_no":      refund.RefundNo,
+	}
+	notifyUrl := refund.Params.NotifyUrl
+	s.mu.Unlock()
+	return s.SendCallback(notifyUrl, "refund", msg)
+}
+
+// CompleteSettle 模拟结算完成, 结算单置为成功并向 notify_url 发送结算回调
+func (s *Server) CompleteSettle(outSettleNo string) error {
+	s.mu.Lock()
+	settle, ok := s.settles[outSettleNo]
+	if !ok || settle.Status != StatusProcessing {
+		s.mu.Unlock()
+		return fmt.Errorf("douyintest: settle %s is not processing", outSettleNo)
+	}
+	settle.Status = StatusSuccess
+	settle.SettledAt = time.Now().Unix()
+	msg := map[string]interface{}{
+		"app_id":         s.Config.AppId,
+		"cp_settle_no":   outSettleNo,
+		"cp_extra":       settle.Params.CpExtra,
+		"status":         StatusSuccess,
+		"settle_amount":  settle.Amount,
+		"settled_at":     settle.SettledAt,
+		"order_id":       s.orders[settle.Params.OutOrderNo].OrderId,
+		"settle_no":      settle.SettleNo,
+		"out_order_no":   settle.Params.OutOrderNo,
+		"is_auto_settle": false,
+	}
+	notifyUrl := settle.Params.NotifyUrl
+	s.mu.Unlock()
+	return s.SendCallback(notifyUrl, "settle", msg)
+}
+
+// SendCallback 按担保支付的格式向 notifyUrl 发送带签名的回调, notifyUrl 为空时不发送
+func (s *Server) SendCallback(notifyUrl, callbackType string, msg interface{}) error {
+	if notifyUrl == "" {
+		return nil
+	}
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := strconv.Itoa(s.nextLocked())
+	body, err := json.Marshal(map[string]string{
+		"timestamp":     timestamp,
+		"nonce":         nonce,
+		"msg":           string(msgBytes),
+		"msg_signature": CallbackSign(s.Config.Token, timestamp, nonce, string(msgBytes)),
+		"type":          callbackType,
+	})
+	if err != nil {
+		return err
+	}
+	res, err := s.CallbackClient.Post(notifyUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("douyintest: callback %s returned status %d", notifyUrl, res.StatusCode)
+	}
+	return nil
+}
+
+// CallbackSign 回调签名: token/timestamp/nonce/msg 排序后拼接取 sha1
+func CallbackSign(token, timestamp, nonce, msg string) string {
+	signature, _ := sign.SHA1Token{Token: token}.Sign(timestamp, nonce, msg)
+	return signature
+}
+
+// Order 获取订单
+func (s *Server) Order(outOrderNo string) (Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, ok := s.orders[outOrderNo]
+	if !ok {
+		return Order{}, false
+	}
+	return *order, true
+}
+
+// Pushes 收到的订单推送
+func (s *Server) Pushes() []douyin.OrderV2PushParams {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]douyin.OrderV2PushParams(nil), s.pushes...)
+}
+
+// RevokeAccessTokens 使已经发放的 access_token 全部失效, 用于模拟 token 被提前作废
+func (s *Server) RevokeAccessTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessTokens = map[string]time.Time{}
+}
+
+// checkEcpay 校验担保支付请求的 app_id 及签名并解析参数, 校验失败时返回错误响应
+func (s *Server) checkEcpay(r *http.Request, body []byte, fields map[string]interface{}, params interface{}) interface{} {
+	if fields["app_id"] != s.Config.AppId {
+		return errNo(ErrNoParam, "bad app_id")
+	}
+	if s.Config.PublicKey != nil {
+		// 配置了公钥时校验 Byte-Authorization 请求头, 请求内容中不带 sign
+		appId, err := sign.VerifyByteAuthorization(sign.RSASHA256{PublicKey: s.Config.PublicKey},
+			r.Header.Get(sign.ByteAuthorizationHeader), r.Method, r.URL.RequestURI(), string(body))
+		if err != nil || appId != s.Config.AppId {
+			return errNo(ErrNoSign, "sign error")
+		}
+	} else {
+		values, err := sign.EcpayValues(fields)
+		if err != nil {
+			return errNo(ErrNoParam, err.Error())
+		}
+		want, _ := sign.MD5Salt{Salt: s.Config.Salt}.Sign(values...)
+		if signature, _ := fields["sign"].(string); signature == "" || signature != want {
+			return errNo(ErrNoSign, "sign error")
+		}
+	}
+	if err := json.Unmarshal(body, params); err != nil {
+		return errNo(ErrNoParam, err.Error())
+	}
+	return nil
+}
+
+// validToken access_token 是否有效
+func (s *Server) validToken(token string) bool {
+	expired, ok := s.accessTokens[token]
+	return ok && time.Now().Before(expired)
+}
+
+// banned 内容是否命中违禁词
+func (s *Server) banned(content string) bool {
+	for _, word := range s.Config.BannedWords {
+		if word != "" && strings.Contains(content, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// imagePredicts 图片检测结果, 图片链接命中违禁词时判定为涉黄
+func (s *Server) imagePredicts(image string) []map[string]interface{} {
+	return []map[string]interface{}{{"model_name": "porn", "hit": s.banned(image)}}
+}
+
+// openId 根据 code 生成稳定的 openid
+func (s *Server) openId(code string) string {
+	if openId, ok := s.openIds[code]; ok {
+		return openId
+	}
+	openId := fmt.Sprintf("openid_%d", s.next())
+	s.openIds[code] = openId
+	return openId
+}
+
+// next 生成自增序号, 调用方需持有锁
+func (s *Server) next() int {
+	s.seq++
+	return s.seq
+}
+
+// nextLocked 加锁生成自增序号
+func (s *Server) nextLocked() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next()
+}
+
+// logId 生成 log_id, 调用方需持有锁
+func (s *Server) logId() string {
+	return fmt.Sprintf("%s%06d", time.Now().Format("20060102150405"), s.seq)
+}
+
+// errNo err_no/err_tips 格式的错误
+func errNo(code int, tips string) map[string]interface{} {
+	return map[string]interface{}{"err_no": code, "err_tips": tips}
+}
+
+// errMsg err_no/err_msg 格式的错误
+func errMsg(code int, msg string) map[string]interface{} {
+	return map[string]interface{}{"err_no": code, "err_msg": msg}
+}
+
+// writeJSON 输出 json
+func writeJSON(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
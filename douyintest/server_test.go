@@ -0,0 +1,224 @@
+package douyintest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	douyin "github.com/38888/douyin-openapi"
+	"github.com/38888/douyin-openapi/sign"
+	"github.com/38888/douyin-openapi/util"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	config := ServerConfig{AppId: "tt_test", AppSecret: "secret", Salt: "salt", Token: "token", BannedWords: []string{"违禁"}}
+	srv := NewServer(config)
+	defer srv.Close()
+
+	openApi := douyin.NewDouYinOpenApi(douyin.DouYinOpenApiConfig{
+		AppId:       config.AppId,
+		AppSecret:   config.AppSecret,
+		Salt:        config.Salt,
+		Token:       config.Token,
+		Environment: srv.Environment(),
+	})
+
+	// 接收回调并用 sdk 验签
+	var mu sync.Mutex
+	callbacks := map[string]int{}
+	notify := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var err error
+		switch r.URL.Path {
+		case "/pay":
+			var callback douyin.PayCallbackResponse
+			if err = json.Unmarshal(body, &callback); err == nil {
+				_, err = openApi.PayCallback(callback, true)
+			}
+		case "/refund":
+			_, err = openApi.RefundCallback(string(body), true)
+		case "/settle":
+			_, err = openApi.SettleCallback(string(body), true)
+		}
+		if err != nil {
+			t.Errorf("%s callback: %v", r.URL.Path, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		callbacks[r.URL.Path]++
+		mu.Unlock()
+	}))
+	defer notify.Close()
+
+	session, err := openApi.Code2Session("code", "")
+	if err != nil || session.Data.Openid == "" {
+		t.Fatalf("Code2Session() = %+v, %v", session, err)
+	}
+
+	order, err := openApi.CreateOrder(douyin.CreateOrderParams{OutOrderNo: "O1", TotalAmount: 100, Subject: "s", Body: "b", ValidTime: 300, NotifyUrl: notify.URL + "/pay"})
+	if err != nil || order.Data.OrderId == "" {
+		t.Fatalf("CreateOrder() = %+v, %v", order, err)
+	}
+	// 未支付的订单不能退款
+	if _, err = openApi.CreateRefund(douyin.CreateRefundParams{OutOrderNo: "O1", OutRefundNo: "R1", Reason: "r", RefundAmount: 10}); err == nil {
+		t.Fatal("CreateRefund() on unpaid order should fail")
+	}
+	if err = srv.PayOrder("O1"); err != nil {
+		t.Fatal(err)
+	}
+	query, err := openApi.QueryOrder("O1", "")
+	if err != nil || query.PaymentInfo.OrderStatus != StatusSuccess {
+		t.Fatalf("QueryOrder() = %+v, %v", query, err)
+	}
+
+	if _, err = openApi.CreateRefund(douyin.CreateRefundParams{OutOrderNo: "O1", OutRefundNo: "R1", Reason: "r", RefundAmount: 30, NotifyUrl: notify.URL + "/refund"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = openApi.CreateRefund(douyin.CreateRefundParams{OutOrderNo: "O1", OutRefundNo: "R2", Reason: "r", RefundAmount: 80}); err == nil {
+		t.Fatal("CreateRefund() over the order amount should fail")
+	}
+	// 退款处理中不能结算
+	if _, err = openApi.Settle(douyin.SettleParams{OutOrderNo: "O1", OutSettleNo: "S1", SettleDesc: "d"}); err == nil {
+		t.Fatal("Settle() with processing refund should fail")
+	}
+	if err = srv.CompleteRefund("R1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = openApi.Settle(douyin.SettleParams{OutOrderNo: "O1", OutSettleNo: "S1", SettleDesc: "d", NotifyUrl: notify.URL + "/settle"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.CompleteSettle("S1"); err != nil {
+		t.Fatal(err)
+	}
+	settle, err := openApi.QuerySettle("S1", "")
+	if err != nil || settle.SettleInfo.SettleStatus != StatusSuccess || settle.SettleInfo.SettleAmount != 70 {
+		t.Fatalf("QuerySettle() = %+v, %v", settle, err)
+	}
+	if callbacks["/pay"] != 1 || callbacks["/refund"] != 1 || callbacks["/settle"] != 1 {
+		t.Fatalf("callbacks = %v", callbacks)
+	}
+
+	// 签名错误
+	wrongSalt := douyin.NewDouYinOpenApi(douyin.DouYinOpenApiConfig{AppId: config.AppId, Salt: "wrong", Environment: srv.Environment()})
+	_, err = wrongSalt.QueryOrder("O1", "")
+	var apiErr *douyin.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != ErrNoSign {
+		t.Fatalf("QueryOrder() with wrong salt = %v", err)
+	}
+
+	// 内容安全检测
+	censor, err := openApi.SecurityCensorText("含有违禁内容")
+	if err != nil || len(censor.Data) != 1 || !censor.Data[0].Predicts[0].Hit {
+		t.Fatalf("SecurityCensorText() = %+v, %v", censor, err)
+	}
+	imageV2, err := openApi.SecurityCensorImageV2(douyin.SecurityCensorImageV2Params{Image: "https://example.com/a.png"})
+	if err != nil || len(imageV2.Predicts) != 1 || imageV2.Predicts[0].Hit {
+		t.Fatalf("SecurityCensorImageV2() = %+v, %v", imageV2, err)
+	}
+	imageV3, err := openApi.SecurityCensorImageV3(douyin.SecurityCensorImageV3Params{Image: "https://example.com/违禁.png"})
+	if err != nil || len(imageV3.Predicts) != 1 || !imageV3.Predicts[0].Hit {
+		t.Fatalf("SecurityCensorImageV3() = %+v, %v", imageV3, err)
+	}
+
+	// 订单推送自动填充 access_token
+	if _, err = openApi.OrderV2Push(douyin.OrderV2PushParams{AppName: "douyin", OpenId: session.Data.Openid, OrderDetail: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	if pushes := srv.Pushes(); len(pushes) != 1 || pushes[0].AccessToken == "" {
+		t.Fatalf("Pushes() = %+v", pushes)
+	}
+
+	// access_token 被撤销后自动获取新的 token 并重放
+	srv.RevokeAccessTokens()
+	if _, err = openApi.SecurityCensorText("text"); err != nil {
+		t.Fatalf("SecurityCensorText() after revoke = %v", err)
+	}
+}
+
+// 测试 RSA 签名通过 Byte-Authorization 请求头传递
+func TestServer_ByteAuthorization(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServerConfig{AppId: "tt_test", AppSecret: "secret", PublicKey: &key.PublicKey}
+	srv := NewServer(config)
+	defer srv.Close()
+
+	newOpenApi := func(key *rsa.PrivateKey) *douyin.DouYinOpenApi {
+		signer := sign.RSASHA256{PrivateKey: key, KeyVersion: "1"}
+		openApi := douyin.NewDouYinOpenApi(douyin.DouYinOpenApiConfig{
+			AppId:       config.AppId,
+			AppSecret:   config.AppSecret,
+			Environment: srv.Environment(),
+			Signers: map[string]sign.Signer{
+				douyin.EndpointCreateOrder: signer,
+				douyin.EndpointQueryOrder:  signer,
+			},
+		})
+		openApi.Use(func(next douyin.Handler) douyin.Handler {
+			return func(ctx context.Context, req *douyin.Request) (*douyin.Response, error) {
+				if strings.Contains(string(req.Body), `"sign"`) {
+					t.Errorf("%s body should not contain sign: %s", req.Endpoint, req.Body)
+				}
+				return next(ctx, req)
+			}
+		})
+		return openApi
+	}
+
+	openApi := newOpenApi(key)
+	order, err := openApi.CreateOrder(douyin.CreateOrderParams{OutOrderNo: "O1", TotalAmount: 100, Subject: "s", Body: "b", ValidTime: 300})
+	if err != nil || order.Data.OrderId == "" {
+		t.Fatalf("CreateOrder() = %+v, %v", order, err)
+	}
+	if query, err := openApi.QueryOrder("O1", ""); err != nil || query.OrderId != order.Data.OrderId {
+		t.Fatalf("QueryOrder() = %+v, %v", query, err)
+	}
+
+	// 使用其他私钥签名时验签失败
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newOpenApi(other).QueryOrder("O1", "")
+	if apiErr, ok := util.AsAPIError(err); !ok || apiErr.Code != ErrNoSign {
+		t.Fatalf("QueryOrder() with wrong key error = %v, want err_no %d", err, ErrNoSign)
+	}
+}
+
+// 测试并发请求, 需要配合 -race 运行
+func TestServer_Concurrent(t *testing.T) {
+	config := ServerConfig{AppId: "tt_test", AppSecret: "secret"}
+	srv := NewServer(config)
+	defer srv.Close()
+
+	handler := srv.Handler()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				body := fmt.Sprintf(`{"appid":"tt_test","secret":"secret","code":"code_%d_%d"}`, i, j)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/apps/v2/jscode2session", strings.NewReader(body)))
+				if w.Code != http.StatusOK || w.Header().Get("X-Tt-Logid") == "" {
+					t.Errorf("status = %d, log_id = %q", w.Code, w.Header().Get("X-Tt-Logid"))
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
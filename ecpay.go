@@ -1,10 +1,11 @@
 package douyin_openapi
 
 import (
-	"crypto/md5"
+	"context"
 	"crypto/sha1"
 	"encoding/json"
 	"fmt"
+	"github.com/38888/douyin-openapi/sign"
 	"sort"
 	"strings"
 )
@@ -61,45 +62,49 @@ type CreateOrderResponseData struct {
 }
 
 // CreateOrder 预下单
-func (d *DouYinOpenApi) CreateOrder(params CreateOrderParams) (createOrderResponse CreateOrderResponse, err error) {
+func (d *DouYinOpenApi) CreateOrder(params CreateOrderParams) (CreateOrderResponse, error) {
+	return d.CreateOrderContext(context.Background(), params)
+}
+
+// CreateOrderContext 预下单, 支持传入 context
+func (d *DouYinOpenApi) CreateOrderContext(ctx context.Context, params CreateOrderParams) (createOrderResponse CreateOrderResponse, err error) {
 	params.AppId = d.Config.AppId
-	params.Sign = d.GenerateSign(params)
-	err = d.PostJson(d.GetApiUrl(createOrder), params, &createOrderResponse)
-	if err != nil {
+	if params.Sign, err = d.signParams(EndpointCreateOrder, params); err != nil {
 		return
 	}
-	if createOrderResponse.ErrNo != 0 {
-		return createOrderResponse, fmt.Errorf("%s %d", createOrderResponse.ErrTips, createOrderResponse.ErrNo)
-	}
+	err = d.postJson(ctx, EndpointCreateOrder, params, &createOrderResponse)
 	return
 }
 
-// GenerateSign 生成请求签名
+// GenerateSign 生成请求签名, 使用 Salt 按担保支付的规则签名
 func (d *DouYinOpenApi) GenerateSign(params interface{}) string {
-	var paramsMap map[string]interface{}
-	var paramsArr []string
-	j, _ := json.Marshal(&params)
-	err := json.Unmarshal(j, &paramsMap)
+	values, err := sign.EcpayValues(params)
 	if err != nil {
 		return ""
 	}
-	for k, v := range paramsMap {
-		if k == "other_settle_params" || k == "app_id" || k == "thirdparty_id" || k == "sign" || k == "salt" || k == "token" {
-			continue
-		}
-		value := strings.TrimSpace(fmt.Sprintf("%v", v))
-		if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") && len(value) > 1 {
-			value = value[1 : len(value)-1]
-		}
-		value = strings.TrimSpace(value)
-		if value == "" || value == "null" {
-			continue
-		}
-		paramsArr = append(paramsArr, value)
+	signature, _ := sign.MD5Salt{Salt: d.Config.Salt}.Sign(values...)
+	return signature
+}
+
+// signParams 按接口的签名方式生成请求签名
+func (d *DouYinOpenApi) signParams(endpoint string, params interface{}) (string, error) {
+	signer := d.GetSigner(endpoint)
+	if signer == nil {
+		return "", nil
 	}
-	paramsArr = append(paramsArr, d.Config.Salt)
-	sort.Strings(paramsArr)
-	return fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(paramsArr, "&"))))
+	// 签名通过请求头传递, 由 requestSignInterceptor 在发送前设置
+	if _, ok := signer.(sign.RequestSigner); ok {
+		return "", nil
+	}
+	// 默认的签名方式依赖 Salt, 未配置时签名必然错误
+	if _, ok := d.Config.Signers[endpoint]; !ok && d.Config.Salt == "" {
+		return "", &ConfigError{AppId: d.Config.AppId, Problems: []ConfigProblem{{Feature: FeatureEcpay, Field: "Salt", Message: "is required"}}}
+	}
+	values, err := sign.EcpayValues(params)
+	if err != nil {
+		return "", err
+	}
+	return signer.Sign(values...)
 }
 
 // QueryOrderParams 订单查询接口参数
@@ -137,20 +142,21 @@ type CpsInfo struct {
 }
 
 // QueryOrder 支付结果查询
-func (d *DouYinOpenApi) QueryOrder(outOrderNo, thirdpartyId string) (queryOrderResponse QueryOrderResponse, err error) {
+func (d *DouYinOpenApi) QueryOrder(outOrderNo, thirdpartyId string) (QueryOrderResponse, error) {
+	return d.QueryOrderContext(context.Background(), outOrderNo, thirdpartyId)
+}
+
+// QueryOrderContext 支付结果查询, 支持传入 context
+func (d *DouYinOpenApi) QueryOrderContext(ctx context.Context, outOrderNo, thirdpartyId string) (queryOrderResponse QueryOrderResponse, err error) {
 	queryParams := QueryOrderParams{
 		AppId:        d.Config.AppId,
 		OutOrderNo:   outOrderNo,
 		ThirdpartyId: thirdpartyId,
 	}
-	queryParams.Sign = d.GenerateSign(queryParams)
-	err = d.PostJson(d.GetApiUrl(queryOrder), queryParams, &queryOrderResponse)
-	if err != nil {
+	if queryParams.Sign, err = d.signParams(EndpointQueryOrder, queryParams); err != nil {
 		return
 	}
-	if queryOrderResponse.ErrNo != 0 {
-		return queryOrderResponse, fmt.Errorf("%s %d", queryOrderResponse.ErrTips, queryOrderResponse.ErrNo)
-	}
+	err = d.postJson(ctx, EndpointQueryOrder, queryParams, &queryOrderResponse)
 	return
 }
 
@@ -192,16 +198,29 @@ func (d *DouYinOpenApi) CheckResponseSign(oldSign string, strArr []string) error
 	return nil
 }
 
+// verifyCallback 按回调的验签方式校验签名, parts 依次为 timestamp, nonce, msg
+func (d *DouYinOpenApi) verifyCallback(endpoint, signature string, parts ...string) error {
+	verifier := d.GetVerifier(endpoint)
+	if verifier == nil {
+		return fmt.Errorf("回调验签失败 %s 未配置验签方式", endpoint)
+	}
+	// 默认的验签方式依赖 Token, 未配置时任何签名都无法通过
+	_, hasVerifier := d.Config.Verifiers[endpoint]
+	_, hasSigner := d.Config.Signers[endpoint]
+	if !hasVerifier && !hasSigner && d.Config.Token == "" {
+		return fmt.Errorf("回调验签失败 %w", &ConfigError{AppId: d.Config.AppId, Problems: []ConfigProblem{{Feature: FeatureCallback, Field: "Token", Message: "is required"}}})
+	}
+	if err := verifier.Verify(signature, parts...); err != nil {
+		return fmt.Errorf("回调验签失败 %w", err)
+	}
+	return nil
+}
+
 // PayCallback 支付结果回调
 func (d *DouYinOpenApi) PayCallback(body PayCallbackResponse, checkSign bool) (PayCallbackResponseData PayCallbackResponseData, err error) {
 	// 判断是否需要校验签名
 	if checkSign {
-		sortedString := make([]string, 0)
-		sortedString = append(sortedString, d.Config.Token)
-		sortedString = append(sortedString, body.Timestamp)
-		sortedString = append(sortedString, body.Nonce)
-		sortedString = append(sortedString, body.Msg)
-		err = d.CheckResponseSign(body.MsgSignature, sortedString)
+		err = d.verifyCallback(EndpointPayCallback, body.MsgSignature, body.Timestamp, body.Nonce, body.Msg)
 		if err != nil {
 			return
 		}
@@ -236,16 +255,17 @@ type CreateRefundResponse struct {
 }
 
 // CreateRefund 发起退款
-func (d *DouYinOpenApi) CreateRefund(params CreateRefundParams) (createRefundResponse CreateRefundResponse, err error) {
+func (d *DouYinOpenApi) CreateRefund(params CreateRefundParams) (CreateRefundResponse, error) {
+	return d.CreateRefundContext(context.Background(), params)
+}
+
+// CreateRefundContext 发起退款, 支持传入 context
+func (d *DouYinOpenApi) CreateRefundContext(ctx context.Context, params CreateRefundParams) (createRefundResponse CreateRefundResponse, err error) {
 	params.AppId = d.Config.AppId
-	params.Sign = d.GenerateSign(params)
-	err = d.PostJson(d.GetApiUrl(createRefund), params, &createRefundResponse)
-	if err != nil {
+	if params.Sign, err = d.signParams(EndpointCreateRefund, params); err != nil {
 		return
 	}
-	if createRefundResponse.ErrNo != 0 {
-		return createRefundResponse, fmt.Errorf("CreateRefund error %s %d", createRefundResponse.ErrTips, createRefundResponse.ErrNo)
-	}
+	err = d.postJson(ctx, EndpointCreateRefund, params, &createRefundResponse)
 	return
 }
 
@@ -272,20 +292,21 @@ type QueryRefundParamsResponse struct {
 }
 
 // QueryRefund 退款结果查询
-func (d *DouYinOpenApi) QueryRefund(outRefundNo, thirdpartyId string) (queryRefundParamsResponse QueryRefundParamsResponse, err error) {
+func (d *DouYinOpenApi) QueryRefund(outRefundNo, thirdpartyId string) (QueryRefundParamsResponse, error) {
+	return d.QueryRefundContext(context.Background(), outRefundNo, thirdpartyId)
+}
+
+// QueryRefundContext 退款结果查询, 支持传入 context
+func (d *DouYinOpenApi) QueryRefundContext(ctx context.Context, outRefundNo, thirdpartyId string) (queryRefundParamsResponse QueryRefundParamsResponse, err error) {
 	params := QueryRefundParams{
 		OutRefundNo:  outRefundNo,
 		AppId:        d.Config.AppId,
 		ThirdpartyId: thirdpartyId,
 	}
-	params.Sign = d.GenerateSign(params)
-	err = d.PostJson(d.GetApiUrl(queryRefund), params, &queryRefundParamsResponse)
-	if err != nil {
+	if params.Sign, err = d.signParams(EndpointQueryRefund, params); err != nil {
 		return
 	}
-	if queryRefundParamsResponse.ErrNo != 0 {
-		return queryRefundParamsResponse, fmt.Errorf("QueryRefund error %s %d", queryRefundParamsResponse.ErrTips, queryRefundParamsResponse.ErrNo)
-	}
+	err = d.postJson(ctx, EndpointQueryRefund, params, &queryRefundParamsResponse)
 	return
 }
 
@@ -320,12 +341,7 @@ func (d *DouYinOpenApi) RefundCallback(body string, checkSign bool) (refundCallb
 	}
 	// 判断是否需要校验签名
 	if checkSign {
-		sortedString := make([]string, 0)
-		sortedString = append(sortedString, d.Config.Token)
-		sortedString = append(sortedString, refundCallbackResponse.Timestamp)
-		sortedString = append(sortedString, refundCallbackResponse.Nonce)
-		sortedString = append(sortedString, refundCallbackResponse.Msg)
-		err = d.CheckResponseSign(refundCallbackResponse.MsgSignature, sortedString)
+		err = d.verifyCallback(EndpointRefundCallback, refundCallbackResponse.MsgSignature, refundCallbackResponse.Timestamp, refundCallbackResponse.Nonce, refundCallbackResponse.Msg)
 		if err != nil {
 			return
 		}
@@ -368,19 +384,19 @@ type SettleResponse struct {
 }
 
 // Settle 发起结算及分账
-func (d *DouYinOpenApi) Settle(settleParams SettleParams, settleParamsItem ...SettleParamsItem) (settleResponse SettleResponse, err error) {
+func (d *DouYinOpenApi) Settle(settleParams SettleParams, settleParamsItem ...SettleParamsItem) (SettleResponse, error) {
+	return d.SettleContext(context.Background(), settleParams, settleParamsItem...)
+}
+
+// SettleContext 发起结算及分账, 支持传入 context
+func (d *DouYinOpenApi) SettleContext(ctx context.Context, settleParams SettleParams, settleParamsItem ...SettleParamsItem) (settleResponse SettleResponse, err error) {
 	settleParams.AppId = d.Config.AppId
 	settleItem, _ := json.Marshal(settleParamsItem)
 	settleParams.SettleParams = string(settleItem)
-	settleParams.Sign = d.GenerateSign(settleParams)
-	err = d.PostJson(d.GetApiUrl(settle), settleParams, &settleResponse)
-	if err != nil {
-		return
-	}
-	if settleResponse.ErrNo != 0 {
-		err = fmt.Errorf("settle error %s %d", settleResponse.ErrTips, settleResponse.ErrNo)
+	if settleParams.Sign, err = d.signParams(EndpointSettle, settleParams); err != nil {
 		return
 	}
+	err = d.postJson(ctx, EndpointSettle, settleParams, &settleResponse)
 	return
 }
 
@@ -410,21 +426,21 @@ type QuerySettleResponse struct {
 }
 
 // QuerySettle 结算结果查询 querySettle
-func (d *DouYinOpenApi) QuerySettle(outSettleNo, thirdpartyId string) (querySettleResponse QuerySettleResponse, err error) {
+func (d *DouYinOpenApi) QuerySettle(outSettleNo, thirdpartyId string) (QuerySettleResponse, error) {
+	return d.QuerySettleContext(context.Background(), outSettleNo, thirdpartyId)
+}
+
+// QuerySettleContext 结算结果查询 querySettle, 支持传入 context
+func (d *DouYinOpenApi) QuerySettleContext(ctx context.Context, outSettleNo, thirdpartyId string) (querySettleResponse QuerySettleResponse, err error) {
 	params := QuerySettleParams{
 		AppId:        d.Config.AppId,
 		OutSettleNo:  outSettleNo,
 		ThirdpartyId: thirdpartyId,
 	}
-	params.Sign = d.GenerateSign(params)
-	err = d.PostJson(d.GetApiUrl(querySettle), params, &querySettleResponse)
-	if err != nil {
-		return
-	}
-	if querySettleResponse.ErrNo != 0 {
-		err = fmt.Errorf("QuerySettle error %s %d", querySettleResponse.ErrTips, querySettleResponse.ErrNo)
+	if params.Sign, err = d.signParams(EndpointQuerySettle, params); err != nil {
 		return
 	}
+	err = d.postJson(ctx, EndpointQuerySettle, params, &querySettleResponse)
 	return
 }
 
@@ -463,12 +479,7 @@ func (d *DouYinOpenApi) SettleCallback(body string, checkSign bool) (settleCallb
 	}
 	// 判断是否需要校验签名
 	if checkSign {
-		sortedString := make([]string, 0)
-		sortedString = append(sortedString, d.Config.Token)
-		sortedString = append(sortedString, settleCallbackResponse.Timestamp)
-		sortedString = append(sortedString, settleCallbackResponse.Nonce)
-		sortedString = append(sortedString, settleCallbackResponse.Msg)
-		err = d.CheckResponseSign(settleCallbackResponse.MsgSignature, sortedString)
+		err = d.verifyCallback(EndpointSettleCallback, settleCallbackResponse.MsgSignature, settleCallbackResponse.Timestamp, settleCallbackResponse.Nonce, settleCallbackResponse.Msg)
 		if err != nil {
 			return
 		}
@@ -515,22 +526,22 @@ type UnsettleAmountResponse struct {
 }
 
 // UnsettleAmount 可分账余额查询 unsettleAmount
-func (d *DouYinOpenApi) UnsettleAmount(outOrderNo, thirdpartyId, outItemOrderNo string) (unsettleAmountResponse UnsettleAmountResponse, err error) {
+func (d *DouYinOpenApi) UnsettleAmount(outOrderNo, thirdpartyId, outItemOrderNo string) (UnsettleAmountResponse, error) {
+	return d.UnsettleAmountContext(context.Background(), outOrderNo, thirdpartyId, outItemOrderNo)
+}
+
+// UnsettleAmountContext 可分账余额查询 unsettleAmount, 支持传入 context
+func (d *DouYinOpenApi) UnsettleAmountContext(ctx context.Context, outOrderNo, thirdpartyId, outItemOrderNo string) (unsettleAmountResponse UnsettleAmountResponse, err error) {
 	params := UnsettleAmountParams{
 		OutOrderNo:     outOrderNo,
 		AppId:          d.Config.AppId,
 		ThirdpartyId:   thirdpartyId,
 		OutItemOrderNo: outItemOrderNo,
 	}
-	params.Sign = d.GenerateSign(params)
-	err = d.PostJson(d.GetApiUrl(unsettleAmount), params, &unsettleAmountResponse)
-	if err != nil {
-		return
-	}
-	if unsettleAmountResponse.ErrNo != 0 {
-		err = fmt.Errorf("UnsettleAmount error %s %d", unsettleAmountResponse.ErrTips, unsettleAmountResponse.ErrNo)
+	if params.Sign, err = d.signParams(EndpointUnsettleAmount, params); err != nil {
 		return
 	}
+	err = d.postJson(ctx, EndpointUnsettleAmount, params, &unsettleAmountResponse)
 	return
 }
 
@@ -568,17 +579,17 @@ type CreateReturnResponse struct {
 }
 
 // CreateReturn 退分账 createReturn
-func (d *DouYinOpenApi) CreateReturn(params CreateReturnParams) (createReturnResponse CreateReturnResponse, err error) {
+func (d *DouYinOpenApi) CreateReturn(params CreateReturnParams) (CreateReturnResponse, error) {
+	return d.CreateReturnContext(context.Background(), params)
+}
+
+// CreateReturnContext 退分账 createReturn, 支持传入 context
+func (d *DouYinOpenApi) CreateReturnContext(ctx context.Context, params CreateReturnParams) (createReturnResponse CreateReturnResponse, err error) {
 	params.AppId = d.Config.AppId
-	params.Sign = d.GenerateSign(params)
-	err = d.PostJson(d.GetApiUrl(createReturn), params, &createReturnResponse)
-	if err != nil {
-		return
-	}
-	if createReturnResponse.ErrNo != 0 {
-		err = fmt.Errorf("CreateReturn error %s %d", createReturnResponse.ErrTips, createReturnResponse.ErrNo)
+	if params.Sign, err = d.signParams(EndpointCreateReturn, params); err != nil {
 		return
 	}
+	err = d.postJson(ctx, EndpointCreateReturn, params, &createReturnResponse)
 	return
 }
 
@@ -612,22 +623,22 @@ type QueryReturnResponse struct {
 }
 
 // QueryReturn 退分账结果查询 queryReturn
-func (d *DouYinOpenApi) QueryReturn(returnNo, outReturnNo, thirdpartyId string) (queryReturnResponse QueryReturnResponse, err error) {
+func (d *DouYinOpenApi) QueryReturn(returnNo, outReturnNo, thirdpartyId string) (QueryReturnResponse, error) {
+	return d.QueryReturnContext(context.Background(), returnNo, outReturnNo, thirdpartyId)
+}
+
+// QueryReturnContext 退分账结果查询 queryReturn, 支持传入 context
+func (d *DouYinOpenApi) QueryReturnContext(ctx context.Context, returnNo, outReturnNo, thirdpartyId string) (queryReturnResponse QueryReturnResponse, err error) {
 	params := QueryReturnParams{
 		AppId:        d.Config.AppId,
 		ReturnNo:     returnNo,
 		OutReturnNo:  outReturnNo,
 		ThirdpartyId: thirdpartyId,
 	}
-	params.Sign = d.GenerateSign(params)
-	err = d.PostJson(d.GetApiUrl(queryReturn), params, &queryReturnResponse)
-	if err != nil {
-		return
-	}
-	if queryReturnResponse.ErrNo != 0 {
-		err = fmt.Errorf("queryReturnResponse error %s %d", queryReturnResponse.ErrTips, queryReturnResponse.ErrNo)
+	if params.Sign, err = d.signParams(EndpointQueryReturn, params); err != nil {
 		return
 	}
+	err = d.postJson(ctx, EndpointQueryReturn, params, &queryReturnResponse)
 	return
 }
 
@@ -659,17 +670,17 @@ type QueryMerchantBalanceResponse struct {
 }
 
 // QueryMerchantBalance 可提现余额查询
-func (d *DouYinOpenApi) QueryMerchantBalance(params QueryMerchantBalanceParams) (queryMerchantBalanceResponse QueryMerchantBalanceResponse, err error) {
+func (d *DouYinOpenApi) QueryMerchantBalance(params QueryMerchantBalanceParams) (QueryMerchantBalanceResponse, error) {
+	return d.QueryMerchantBalanceContext(context.Background(), params)
+}
+
+// QueryMerchantBalanceContext 可提现余额查询, 支持传入 context
+func (d *DouYinOpenApi) QueryMerchantBalanceContext(ctx context.Context, params QueryMerchantBalanceParams) (queryMerchantBalanceResponse QueryMerchantBalanceResponse, err error) {
 	params.AppId = d.Config.AppId
-	params.Sign = d.GenerateSign(params)
-	err = d.PostJson(d.GetApiUrl(queryMerchantBalance), params, &queryMerchantBalanceResponse)
-	if err != nil {
-		return
-	}
-	if queryMerchantBalanceResponse.ErrNo != 0 {
-		err = fmt.Errorf("queryMerchantBalanceResponse error %s %d", queryMerchantBalanceResponse.ErrTips, queryMerchantBalanceResponse.ErrNo)
+	if params.Sign, err = d.signParams(EndpointQueryMerchantBalance, params); err != nil {
 		return
 	}
+	err = d.postJson(ctx, EndpointQueryMerchantBalance, params, &queryMerchantBalanceResponse)
 	return
 }
 
@@ -695,17 +706,17 @@ type MerchantWithdrawResponse struct {
 }
 
 // MerchantWithdraw 提现
-func (d *DouYinOpenApi) MerchantWithdraw(params MerchantWithdrawParams) (merchantWithdrawResponse MerchantWithdrawResponse, err error) {
+func (d *DouYinOpenApi) MerchantWithdraw(params MerchantWithdrawParams) (MerchantWithdrawResponse, error) {
+	return d.MerchantWithdrawContext(context.Background(), params)
+}
+
+// MerchantWithdrawContext 提现, 支持传入 context
+func (d *DouYinOpenApi) MerchantWithdrawContext(ctx context.Context, params MerchantWithdrawParams) (merchantWithdrawResponse MerchantWithdrawResponse, err error) {
 	params.AppId = d.Config.AppId
-	params.Sign = d.GenerateSign(params)
-	err = d.PostJson(d.GetApiUrl(merchantWithdraw), params, &merchantWithdrawResponse)
-	if err != nil {
-		return
-	}
-	if merchantWithdrawResponse.ErrNo != 0 {
-		err = fmt.Errorf("merchantWithdrawResponse error %s %d", merchantWithdrawResponse.ErrTips, merchantWithdrawResponse.ErrNo)
+	if params.Sign, err = d.signParams(EndpointMerchantWithdraw, params); err != nil {
 		return
 	}
+	err = d.postJson(ctx, EndpointMerchantWithdraw, params, &merchantWithdrawResponse)
 	return
 }
 
@@ -727,17 +738,17 @@ type QueryWithdrawOrderResponse struct {
 }
 
 // QueryWithdrawOrder 提现结果查询
-func (d *DouYinOpenApi) QueryWithdrawOrder(params QueryWithdrawOrderParams) (queryWithdrawOrderResponse QueryWithdrawOrderResponse, err error) {
+func (d *DouYinOpenApi) QueryWithdrawOrder(params QueryWithdrawOrderParams) (QueryWithdrawOrderResponse, error) {
+	return d.QueryWithdrawOrderContext(context.Background(), params)
+}
+
+// QueryWithdrawOrderContext 提现结果查询, 支持传入 context
+func (d *DouYinOpenApi) QueryWithdrawOrderContext(ctx context.Context, params QueryWithdrawOrderParams) (queryWithdrawOrderResponse QueryWithdrawOrderResponse, err error) {
 	params.AppId = d.Config.AppId
-	params.Sign = d.GenerateSign(params)
-	err = d.PostJson(d.GetApiUrl(queryWithdrawOrder), params, &queryWithdrawOrderResponse)
-	if err != nil {
-		return
-	}
-	if queryWithdrawOrderResponse.ErrNo != 0 {
-		err = fmt.Errorf("queryWithdrawOrderResponse error %s %d", queryWithdrawOrderResponse.ErrTips, queryWithdrawOrderResponse.ErrNo)
+	if params.Sign, err = d.signParams(EndpointQueryWithdrawOrder, params); err != nil {
 		return
 	}
+	err = d.postJson(ctx, EndpointQueryWithdrawOrder, params, &queryWithdrawOrderResponse)
 	return
 }
 
@@ -769,12 +780,7 @@ func (d *DouYinOpenApi) MerchantWithdrawCallback(body string, checkSign bool) (m
 	}
 	// 判断是否需要校验签名
 	if checkSign {
-		sortedString := make([]string, 0)
-		sortedString = append(sortedString, d.Config.Token)
-		sortedString = append(sortedString, merchantWithdrawCallbackResponse.Timestamp)
-		sortedString = append(sortedString, merchantWithdrawCallbackResponse.Nonce)
-		sortedString = append(sortedString, merchantWithdrawCallbackResponse.Msg)
-		err = d.CheckResponseSign(merchantWithdrawCallbackResponse.MsgSignature, sortedString)
+		err = d.verifyCallback(EndpointMerchantWithdrawCallback, merchantWithdrawCallbackResponse.MsgSignature, merchantWithdrawCallbackResponse.Timestamp, merchantWithdrawCallbackResponse.Nonce, merchantWithdrawCallbackResponse.Msg)
 		if err != nil {
 			return
 		}
@@ -0,0 +1,163 @@
+package douyin_openapi
+
+import (
+	accessToken "github.com/38888/douyin-openapi/access-token"
+	"github.com/38888/douyin-openapi/sign"
+	"github.com/38888/douyin-openapi/util"
+)
+
+// 接口名称, 用于在错误/重试/限流/监控等场景中区分接口
+const (
+	EndpointAccessToken           = accessToken.Endpoint    // 获取 access_token
+	EndpointCode2Session          = "code2Session"          // 小程序登录
+	EndpointCreateOrder           = "createOrder"           // 预下单
+	EndpointQueryOrder            = "queryOrder"            // 订单查询
+	EndpointCreateRefund          = "createRefund"          // 退款
+	EndpointQueryRefund           = "queryRefund"           // 退款结果查询
+	EndpointSettle                = "settle"                // 结算
+	EndpointQuerySettle           = "querySettle"           // 结算结果查询
+	EndpointUnsettleAmount        = "unsettleAmount"        // 可结算金额查询
+	EndpointCreateReturn          = "createReturn"          // 退分账
+	EndpointQueryReturn           = "queryReturn"           // 退分账结果查询
+	EndpointQueryMerchantBalance  = "queryMerchantBalance"  // 商户余额查询
+	EndpointMerchantWithdraw      = "merchantWithdraw"      // 商户提现
+	EndpointQueryWithdrawOrder    = "queryWithdrawOrder"    // 提现结果查询
+	EndpointSecurityCensorText    = "securityCensorText"    // 文本内容安全检测
+	EndpointSecurityCensorImageV2 = "securityCensorImageV2" // 图片内容安全检测
+	EndpointSecurityCensorImageV3 = "securityCensorImageV3" // 图片内容安全检测 v3
+	EndpointOrderV2Push           = "orderV2Push"           // 订单推送
+
+	EndpointClientToken           = accessToken.EndpointClientToken           // 获取开放平台 client_token
+	EndpointUserAccessToken       = accessToken.EndpointUserAccessToken       // 通过授权码获取用户 access_token
+	EndpointUserRefreshToken      = accessToken.EndpointUserRefreshToken      // 刷新用户 access_token
+	EndpointUserRenewRefreshToken = accessToken.EndpointUserRenewRefreshToken // 续期用户 refresh_token
+
+	EndpointPayCallback              = "payCallback"              // 支付结果回调
+	EndpointRefundCallback           = "refundCallback"           // 退款结果回调
+	EndpointSettleCallback           = "settleCallback"           // 结算结果回调
+	EndpointMerchantWithdrawCallback = "merchantWithdrawCallback" // 提现结果回调
+)
+
+type (
+	// Environment 接口环境, 维护每个接口分组对应的域名
+	Environment = util.Environment
+	// Family 接口分组
+	Family = util.Family
+)
+
+// 接口分组
+const (
+	FamilyMiniApp      = util.FamilyMiniApp      // 小程序接口
+	FamilyEcpay        = util.FamilyEcpay        // 担保支付接口
+	FamilyCensor       = util.FamilyCensor       // 内容安全接口
+	FamilyOpenPlatform = util.FamilyOpenPlatform // 抖音开放平台接口
+	FamilyThirdParty   = util.FamilyThirdParty   // 小程序第三方平台接口
+)
+
+// endpoint 接口描述
+type endpoint struct {
+	path      string          // 接口路径
+	family    util.Family     // 接口分组, 决定使用的域名
+	retry     bool            // 是否默认开启重试: 只读的查询接口及以开发者单号幂等的担保支付接口
+	auth      util.AuthScheme // access_token 的传递方式, 为空时不需要 token
+	sign      signScheme      // 默认的签名方式
+	authCodes map[int]bool    // 接口特有的鉴权失败错误码, 与 util.AuthErrorCodes 一起判断, 如图片检测 v2 的 error=2
+}
+
+// signScheme 接口默认的签名方式, 可以通过 Signers/Verifiers 按接口覆盖
+type signScheme int
+
+const (
+	signNone      signScheme = iota // 不签名
+	signMD5Salt                     // 担保支付请求签名, 使用 Salt
+	signSHA1Token                   // 担保支付回调签名, 使用 Token
+)
+
+// endpoints 所有接口的描述
+var endpoints = map[string]endpoint{
+	EndpointAccessToken:           {family: util.FamilyMiniApp, retry: true},
+	EndpointCode2Session:          {path: code2Session, family: util.FamilyMiniApp},
+	EndpointCreateOrder:           {path: createOrder, family: util.FamilyEcpay, retry: true, sign: signMD5Salt}, // out_order_no 幂等
+	EndpointQueryOrder:            {path: queryOrder, family: util.FamilyEcpay, retry: true, sign: signMD5Salt},
+	EndpointCreateRefund:          {path: createRefund, family: util.FamilyEcpay, retry: true, sign: signMD5Salt}, // out_refund_no 幂等
+	EndpointQueryRefund:           {path: queryRefund, family: util.FamilyEcpay, retry: true, sign: signMD5Salt},
+	EndpointSettle:                {path: settle, family: util.FamilyEcpay, retry: true, sign: signMD5Salt}, // out_settle_no 幂等
+	EndpointQuerySettle:           {path: querySettle, family: util.FamilyEcpay, retry: true, sign: signMD5Salt},
+	EndpointUnsettleAmount:        {path: unsettleAmount, family: util.FamilyEcpay, retry: true, sign: signMD5Salt},
+	EndpointCreateReturn:          {path: createReturn, family: util.FamilyEcpay, retry: true, sign: signMD5Salt}, // out_return_no 幂等
+	EndpointQueryReturn:           {path: queryReturn, family: util.FamilyEcpay, retry: true, sign: signMD5Salt},
+	EndpointQueryMerchantBalance:  {path: queryMerchantBalance, family: util.FamilyEcpay, retry: true, sign: signMD5Salt},
+	EndpointMerchantWithdraw:      {path: merchantWithdraw, family: util.FamilyEcpay, sign: signMD5Salt},
+	EndpointQueryWithdrawOrder:    {path: queryWithdrawOrder, family: util.FamilyEcpay, retry: true, sign: signMD5Salt},
+	EndpointSecurityCensorText:    {path: securityCensorText, family: util.FamilyCensor, auth: util.HeaderAuth("X-Token")},
+	EndpointSecurityCensorImageV2: {path: securityCensorImageV2, family: util.FamilyCensor, auth: util.BodyAuth("access_token"), authCodes: map[int]bool{2: true}},
+	EndpointSecurityCensorImageV3: {path: securityCensorImageV3, family: util.FamilyCensor, auth: util.HeaderAuth("access-token")},
+	EndpointOrderV2Push:           {path: orderV2Push, family: util.FamilyMiniApp, auth: util.BodyAuth("access_token")},
+
+	EndpointClientToken:           {family: util.FamilyOpenPlatform, retry: true},
+	EndpointUserAccessToken:       {family: util.FamilyOpenPlatform},
+	EndpointUserRefreshToken:      {family: util.FamilyOpenPlatform, retry: true},
+	EndpointUserRenewRefreshToken: {family: util.FamilyOpenPlatform},
+
+	EndpointPayCallback:              {family: util.FamilyEcpay, sign: signSHA1Token},
+	EndpointRefundCallback:           {family: util.FamilyEcpay, sign: signSHA1Token},
+	EndpointSettleCallback:           {family: util.FamilyEcpay, sign: signSHA1Token},
+	EndpointMerchantWithdrawCallback: {family: util.FamilyEcpay, sign: signSHA1Token},
+}
+
+// GetEndpointUrl 获取接口的完整地址, 域名由接口分组及当前环境决定
+func (d *DouYinOpenApi) GetEndpointUrl(name string) string {
+	e := endpoints[name]
+	return d.Environment.Url(e.family, e.path)
+}
+
+// GetAuthScheme 获取接口传递 access_token 的方式, 返回 nil 表示不需要 token
+func (d *DouYinOpenApi) GetAuthScheme(endpoint string) util.AuthScheme {
+	return endpoints[endpoint].auth
+}
+
+// GetSigner 获取接口的请求签名方式, 返回 nil 表示不需要签名
+// 优先使用 Signers 中的配置, 担保支付接口默认使用 Salt 的 md5 签名
+func (d *DouYinOpenApi) GetSigner(endpoint string) sign.Signer {
+	if signer, ok := d.Config.Signers[endpoint]; ok {
+		return signer
+	}
+	switch endpoints[endpoint].sign {
+	case signMD5Salt:
+		return sign.MD5Salt{Salt: d.Config.Salt}
+	case signSHA1Token:
+		return sign.SHA1Token{Token: d.Config.Token}
+	}
+	return nil
+}
+
+// GetVerifier 获取接口或回调的验签方式, 返回 nil 表示未配置
+// 优先使用 Verifiers 中的配置, 其次使用实现了 Verifier 的签名方式, 担保支付回调默认使用 Token 的 sha1 验签
+func (d *DouYinOpenApi) GetVerifier(endpoint string) sign.Verifier {
+	if verifier, ok := d.Config.Verifiers[endpoint]; ok {
+		return verifier
+	}
+	verifier, _ := d.GetSigner(endpoint).(sign.Verifier)
+	return verifier
+}
+
+// GetRetryPolicy 获取接口的重试策略, 返回 nil 表示不重试
+// 优先使用 EndpointRetryPolicies 中的配置, 其次对默认开启重试的接口使用 RetryPolicy
+func (d *DouYinOpenApi) GetRetryPolicy(endpoint string) *util.RetryPolicy {
+	if policy, ok := d.Config.EndpointRetryPolicies[endpoint]; ok {
+		return policy
+	}
+	if !endpoints[endpoint].retry {
+		return nil
+	}
+	if d.Config.RetryPolicy != nil {
+		return d.Config.RetryPolicy
+	}
+	return util.DefaultRetryPolicy()
+}
+
+// isAuthError 错误是否为鉴权错误, 除通用的错误码外还按 APIError.Endpoint 判断接口特有的错误码
+func isAuthError(err error) bool {
+	apiErr, ok := util.AsAPIError(err)
+	return ok && (apiErr.IsAuthError() || endpoints[apiErr.Endpoint].authCodes[apiErr.Code])
+}
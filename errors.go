@@ -0,0 +1,21 @@
+package douyin_openapi
+
+import "github.com/38888/douyin-openapi/util"
+
+// APIError 抖音接口返回的错误, 可通过 errors.As 获取 err_no/err_tips/log_id 等信息
+type APIError = util.APIError
+
+// IsRetryable 错误是否可以重试
+func IsRetryable(err error) bool {
+	return util.IsRetryable(err)
+}
+
+// IsAuthError 错误是否为鉴权错误, 如 access_token 无效, 包括接口特有的错误码
+func IsAuthError(err error) bool {
+	return isAuthError(err)
+}
+
+// IsRateLimited 错误是否为限流错误
+func IsRateLimited(err error) bool {
+	return util.IsRateLimited(err)
+}
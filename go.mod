@@ -1,8 +1,3 @@
 module github.com/38888/douyin-openapi
 
 go 1.18
-
-require (
-	github.com/go-resty/resty/v2 v2.14.0 // indirect
-	golang.org/x/net v0.27.0 // indirect
-)
@@ -0,0 +1,141 @@
+package douyin_openapi
+
+import (
+	"context"
+	"errors"
+	"github.com/38888/douyin-openapi/breaker"
+	"github.com/38888/douyin-openapi/metrics"
+	"github.com/38888/douyin-openapi/ratelimit"
+	"github.com/38888/douyin-openapi/sign"
+	"github.com/38888/douyin-openapi/util"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type (
+	// Interceptor 请求拦截器, 可以看到接口名称/请求内容/返回内容/状态码/耗时
+	Interceptor = util.Interceptor
+	// Handler 拦截器中执行下一步请求的方法
+	Handler = util.Handler
+	// Request 拦截器中的请求
+	Request = util.Request
+	// Response 拦截器中的返回值
+	Response = util.Response
+)
+
+// Use 添加拦截器, 所有接口(包括获取 access_token)的请求都会经过拦截器, 需要在发起请求前调用
+func (d *DouYinOpenApi) Use(interceptors ...Interceptor) {
+	d.Client.Use(interceptors...)
+}
+
+// rateLimitInterceptor 按 AppId 及接口名称限流的拦截器, 被拒绝的请求记录到 m
+func rateLimitInterceptor(appId string, limiter ratelimit.Limiter, m metrics.Metrics) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			if err := limiter.Wait(ctx, appId, req.Endpoint); err != nil {
+				reason := metrics.RejectRateLimit
+				if !errors.Is(err, ratelimit.ErrLimited) {
+					reason = metrics.RejectCanceled
+				}
+				observeRejected(m, req.Endpoint, reason)
+				return nil, err
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// circuitBreakerInterceptor 按接口熔断的拦截器, 超时/网络错误/5xx/平台系统错误计为失败
+// 调用方主动取消及平台限流(429 或限流错误码)不是接口故障, 不计为失败; 限流等待在外层, 不计入耗时
+// 熔断打开时拒绝的请求记录到 m
+func circuitBreakerInterceptor(cb breaker.CircuitBreaker, m metrics.Metrics) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			done, err := cb.Allow(req.Endpoint)
+			if err != nil {
+				observeRejected(m, req.Endpoint, metrics.RejectCircuitOpen)
+				return nil, err
+			}
+			start := time.Now()
+			res, err := next(ctx, req)
+			done(breakerFailure(ctx, req.Endpoint, res, err), time.Since(start))
+			return res, err
+		}
+	}
+}
+
+// breakerFailure 判断一次请求是否计为熔断失败, 不复用重试的判断, 超时等不重试的错误也需要计入
+func breakerFailure(ctx context.Context, endpoint string, res *Response, err error) error {
+	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil
+		}
+		// 超时(包括调用方 context 的截止时间)及其他网络错误
+		return util.WrapError(endpoint, err)
+	}
+	apiErr, ok := util.AsAPIError(util.CheckResponse(endpoint, res))
+	if !ok || apiErr.IsRateLimited() {
+		return nil
+	}
+	if apiErr.StatusCode >= http.StatusInternalServerError || util.RetryableErrorCodes[apiErr.Code] {
+		return apiErr
+	}
+	return nil
+}
+
+// requestSignInterceptor 对配置了 sign.RequestSigner 的接口签名并设置请求头, 放在最内层使每次重试都重新签名
+func requestSignInterceptor(appId string, signers map[string]sign.Signer) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			signer, ok := signers[req.Endpoint].(sign.RequestSigner)
+			if !ok {
+				return next(ctx, req)
+			}
+			u, err := url.Parse(req.URL)
+			if err != nil {
+				return nil, err
+			}
+			name, value, err := signer.SignRequest(appId, req.Method, u.RequestURI(), string(req.Body))
+			if err != nil {
+				return nil, err
+			}
+			// 复制请求头, 不修改调用方传入的 Header
+			signed := *req
+			signed.Header = req.Header.Clone()
+			if signed.Header == nil {
+				signed.Header = http.Header{}
+			}
+			signed.Header.Set(name, value)
+			return next(ctx, &signed)
+		}
+	}
+}
+
+// metricsInterceptor 记录接口请求次数/耗时及平台错误码的拦截器
+// 放在限流/熔断内层, 只记录实际发出的请求, 耗时不包含等待令牌的时间
+func metricsInterceptor(m metrics.Metrics) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			start := time.Now()
+			res, err := next(ctx, req)
+			duration := time.Since(start)
+			if err != nil {
+				m.ObserveRequest(req.Endpoint, 0, duration, err)
+				return res, err
+			}
+			m.ObserveRequest(req.Endpoint, res.StatusCode, duration, nil)
+			if apiErr, ok := util.AsAPIError(util.CheckResponse(req.Endpoint, res)); ok && apiErr.Code != 0 {
+				m.ObservePlatformError(req.Endpoint, apiErr.Code)
+			}
+			return res, err
+		}
+	}
+}
+
+// observeRejected 记录未发出的请求, m 未实现 metrics.RejectMetrics 时不记录
+func observeRejected(m metrics.Metrics, endpoint, reason string) {
+	if rm, ok := m.(metrics.RejectMetrics); ok {
+		rm.ObserveRejected(endpoint, reason)
+	}
+}
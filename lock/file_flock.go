@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// TryLock 尝试获取锁, 锁文件不存在时创建; ttl 不生效, 持有者进程退出时由操作系统释放
+func (f *File) TryLock(ctx context.Context, key string, ttl time.Duration) (func() error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(f.path(key), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// flock 锁在打开的文件上, 同一进程内多次打开同一个文件也互斥
+	if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	var once sync.Once
+	return func() (err error) {
+		once.Do(func() {
+			err = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		})
+		return
+	}, nil
+}
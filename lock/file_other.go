@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TryLock 当前平台不支持 flock, 返回错误
+func (f *File) TryLock(ctx context.Context, key string, ttl time.Duration) (func() error, error) {
+	return nil, errors.New("lock: File is not supported on this platform")
+}
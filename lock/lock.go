@@ -0,0 +1,125 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrLocked 锁已被其他持有者持有, 可以用 errors.Is 判断
+var ErrLocked = errors.New("lock: already locked")
+
+// Locker 锁接口, 多个实例共享缓存时用于保证同一时间只有一个实例刷新 token
+// 实现此接口可以接入 redis/etcd 等分布式锁
+type Locker interface {
+	// TryLock 尝试获取 key 对应的锁, 不等待; ttl 为锁的最长持有时间, 防止持有者异常退出后锁无法释放
+	// 获取成功时返回 unlock 用于释放锁, 锁已被持有时返回 ErrLocked
+	TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func() error, err error)
+}
+
+// newOwner 生成随机的持有者标识, 释放锁时只删除自己持有的锁
+func newOwner() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// memoryLock 内存锁的持有者及过期时间
+type memoryLock struct {
+	owner   string
+	expires time.Time
+}
+
+// Memory 进程内的锁, 用于单实例部署或测试
+type Memory struct {
+	mu    sync.Mutex
+	locks map[string]memoryLock
+}
+
+// NewMemory 实例化一个进程内的锁
+func NewMemory() *Memory {
+	return &Memory{locks: map[string]memoryLock{}}
+}
+
+// TryLock 尝试获取锁
+func (m *Memory) TryLock(ctx context.Context, key string, ttl time.Duration) (func() error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if held, ok := m.locks[key]; ok && now.Before(held.expires) {
+		return nil, ErrLocked
+	}
+	owner := newOwner()
+	m.locks[key] = memoryLock{owner: owner, expires: now.Add(ttl)}
+	return func() error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if held, ok := m.locks[key]; ok && held.owner == owner {
+			delete(m.locks, key)
+		}
+		return nil
+	}, nil
+}
+
+// File 基于 flock 的文件锁, 用于同一台机器上的多个进程共享文件缓存的场景
+// 锁由操作系统维护, 持有者进程退出时自动释放, 因此不使用 ttl; 锁文件不会被删除, 以免不同进程锁住不同的文件
+// 只支持提供 flock 的平台(linux/darwin/bsd), 其他平台 TryLock 返回错误
+type File struct {
+	Dir string // 锁文件所在的目录, 为空时使用系统临时目录
+}
+
+// NewFile 实例化一个文件锁
+func NewFile(dir string) *File {
+	return &File{Dir: dir}
+}
+
+// path 锁文件路径
+func (f *File) path(key string) string {
+	dir := f.Dir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, url.QueryEscape(key)+".lock")
+}
+
+// Redis redis 风格的分布式锁, 通过回调接入任意 redis 客户端
+//
+//	SetNX:            SET key value NX PX ttl, 设置成功返回 true
+//	CompareAndDelete: 值等于 value 时删除 key, 通常使用 lua 脚本
+//	                  if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end
+type Redis struct {
+	Prefix           string                                                                        // key 前缀
+	SetNX            func(ctx context.Context, key, value string, ttl time.Duration) (bool, error) // 不存在时设置 key
+	CompareAndDelete func(ctx context.Context, key, value string) error                            // 值匹配时删除 key
+}
+
+// TryLock 尝试获取锁
+func (r *Redis) TryLock(ctx context.Context, key string, ttl time.Duration) (func() error, error) {
+	if r.SetNX == nil || r.CompareAndDelete == nil {
+		return nil, errors.New("lock: redis SetNX and CompareAndDelete are required")
+	}
+	key = r.Prefix + key
+	owner := newOwner()
+	ok, err := r.SetNX(ctx, key, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLocked
+	}
+	return func() error {
+		return r.CompareAndDelete(context.Background(), key, owner)
+	}, nil
+}
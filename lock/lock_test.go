@@ -0,0 +1,124 @@
+package lock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试进程内的锁: 互斥/过期/只释放自己持有的锁
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	unlock, err := m.TryLock(ctx, "key", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.TryLock(ctx, "key", time.Hour); !errors.Is(err, ErrLocked) {
+		t.Fatalf("want ErrLocked, got %v", err)
+	}
+	_ = unlock()
+	expired, err := m.TryLock(ctx, "key", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 过期的锁可以被其他持有者获取, 原持有者释放时不影响新的持有者
+	if _, err = m.TryLock(ctx, "key", time.Hour); err != nil {
+		t.Fatalf("want expired lock taken over, got %v", err)
+	}
+	_ = expired()
+	if _, err = m.TryLock(ctx, "key", time.Hour); !errors.Is(err, ErrLocked) {
+		t.Fatalf("want ErrLocked after stale unlock, got %v", err)
+	}
+}
+
+// 测试文件锁在并发获取时同一时间只有一个持有者
+func TestFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("flock is not supported")
+	}
+	dir := t.TempDir()
+	ctx := context.Background()
+	var holders, acquired int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				unlock, err := NewFile(dir).TryLock(ctx, "key", time.Second)
+				if errors.Is(err, ErrLocked) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				atomic.AddInt32(&acquired, 1)
+				if n := atomic.AddInt32(&holders, 1); n > 1 {
+					t.Errorf("want one holder at a time, got %d", n)
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&holders, -1)
+				if err = unlock(); err != nil {
+					t.Error(err)
+				}
+				_ = unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if acquired == 0 {
+		t.Error("want the lock acquired at least once")
+	}
+}
+
+// 测试文件锁跨进程互斥, 持有者进程退出后锁自动释放
+func TestFile_CrossProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("flock is not supported")
+	}
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFileHelperProcess$")
+	cmd.Env = append(os.Environ(), "LOCK_HELPER_DIR="+dir)
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "locked\n" {
+		t.Fatalf("helper process: %q, %v", line, err)
+	}
+	if _, err := NewFile(dir).TryLock(context.Background(), "key", time.Second); !errors.Is(err, ErrLocked) {
+		t.Fatalf("want ErrLocked while helper holds the lock, got %v", err)
+	}
+	// 关闭 stdin 后子进程不释放锁直接退出, 模拟持有者异常退出
+	_ = stdin.Close()
+	_ = cmd.Wait()
+	unlock, err := NewFile(dir).TryLock(context.Background(), "key", time.Second)
+	if err != nil {
+		t.Fatalf("want lock released after helper exits, got %v", err)
+	}
+	_ = unlock()
+}
+
+// TestFileHelperProcess 供 TestFile_CrossProcess 启动的子进程, 持有锁直到 stdin 关闭
+func TestFileHelperProcess(t *testing.T) {
+	dir := os.Getenv("LOCK_HELPER_DIR")
+	if dir == "" {
+		return
+	}
+	if _, err := NewFile(dir).TryLock(context.Background(), "key", time.Second); err != nil {
+		os.Exit(2)
+	}
+	_, _ = os.Stdout.WriteString("locked\n")
+	_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+	os.Exit(0)
+}
@@ -0,0 +1,294 @@
+package douyin_openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/38888/douyin-openapi/cache"
+	"github.com/38888/douyin-openapi/util"
+	"strings"
+	"sync"
+)
+
+// ErrAppNotFound 未注册的小程序
+var ErrAppNotFound = errors.New("douyin_openapi: app not registered")
+
+// Manager 多小程序管理, 按 AppId(及 thirdparty_id) 懒加载 DouYinOpenApi 实例
+// 所有实例共享 Base 中的缓存/http 连接池/拦截器/限流/监控等组件, 各自使用自己的 AppSecret/Salt/Token/AccessToken
+type Manager struct {
+	Base    DouYinOpenApiConfig // 公共配置, 小程序配置中为空的字段使用公共配置
+	mu      sync.RWMutex
+	configs map[string]DouYinOpenApiConfig
+	clients map[string]*DouYinOpenApi
+}
+
+// NewManager 实例化多小程序管理, base 中未设置缓存及 http 客户端时创建共享的实例
+func NewManager(base DouYinOpenApiConfig) *Manager {
+	if base.Cache == nil {
+		base.Cache = cache.NewMemory()
+	}
+	if base.HttpClient == nil {
+		if base.Transport != nil {
+			base.HttpClient = util.NewClientWithTransport(base.Transport).HttpClient
+		} else {
+			base.HttpClient = util.NewDefaultHttpClient()
+		}
+	}
+	return &Manager{
+		Base:    base,
+		configs: map[string]DouYinOpenApiConfig{},
+		clients: map[string]*DouYinOpenApi{},
+	}
+}
+
+// managerKey 生成 AppId+thirdparty_id 的 key
+func managerKey(appId, thirdpartyId string) string {
+	if thirdpartyId == "" {
+		return appId
+	}
+	return appId + "/" + thirdpartyId
+}
+
+// Register 注册一个小程序, 重复注册时覆盖之前的配置, 已创建的实例会被关闭并在下次获取时重新创建
+func (m *Manager) Register(config DouYinOpenApiConfig) {
+	m.RegisterThirdparty("", config)
+}
+
+// RegisterThirdparty 注册服务商代开发的小程序, 按 AppId+thirdparty_id 区分配置
+func (m *Manager) RegisterThirdparty(thirdpartyId string, config DouYinOpenApiConfig) {
+	key := managerKey(config.AppId, thirdpartyId)
+	m.mu.Lock()
+	m.configs[key] = config
+	evicted := m.evict(key)
+	m.mu.Unlock()
+	closeEvicted(evicted)
+}
+
+// RegisterAppConfigs 批量注册小程序, 设置了 thirdparty_id 的按服务商代开发注册
+func (m *Manager) RegisterAppConfigs(apps ...AppConfig) {
+	for _, app := range apps {
+		m.RegisterThirdparty(app.ThirdpartyId, app.Config())
+	}
+}
+
+// Remove 移除一个小程序, 已创建的实例会被关闭
+func (m *Manager) Remove(appId, thirdpartyId string) {
+	key := managerKey(appId, thirdpartyId)
+	m.mu.Lock()
+	delete(m.configs, key)
+	evicted := m.evict(key)
+	m.mu.Unlock()
+	closeEvicted(evicted)
+}
+
+// evict 移除已创建的实例并返回, 调用方需持有锁, 并在锁外关闭返回的实例
+func (m *Manager) evict(key string) *DouYinOpenApi {
+	client, ok := m.clients[key]
+	if !ok {
+		return nil
+	}
+	delete(m.clients, key)
+	return client
+}
+
+// closeEvicted 关闭被替换或移除的实例, 停止其后台刷新 token 的协程
+// 调用方可能仍持有该实例, 关闭后实例仍可以发起请求, 只是不再后台刷新
+func closeEvicted(client *DouYinOpenApi) {
+	if client != nil {
+		_ = client.Close()
+	}
+}
+
+// AppIds 已注册的小程序
+func (m *Manager) AppIds() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	appIds := make([]string, 0, len(m.configs))
+	seen := map[string]bool{}
+	for _, config := range m.configs {
+		if !seen[config.AppId] {
+			seen[config.AppId] = true
+			appIds = append(appIds, config.AppId)
+		}
+	}
+	return appIds
+}
+
+// Get 获取小程序的实例, 第一次获取时创建
+func (m *Manager) Get(appId string) (*DouYinOpenApi, error) {
+	return m.GetThirdparty(appId, "")
+}
+
+// GetThirdparty 获取服务商代开发小程序的实例, 未按 thirdparty_id 注册时使用 AppId 的配置
+func (m *Manager) GetThirdparty(appId, thirdpartyId string) (*DouYinOpenApi, error) {
+	key := managerKey(appId, thirdpartyId)
+	m.mu.RLock()
+	client, ok := m.clients[key]
+	if !ok && thirdpartyId != "" {
+		if _, registered := m.configs[key]; !registered {
+			key = appId
+			client, ok = m.clients[key]
+		}
+	}
+	m.mu.RUnlock()
+	if ok {
+		return client, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if client, ok = m.clients[key]; ok {
+		return client, nil
+	}
+	config, ok := m.configs[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, managerKey(appId, thirdpartyId))
+	}
+	client = NewDouYinOpenApi(m.merge(config))
+	m.clients[key] = client
+	return client, nil
+}
+
+// Close 关闭所有已创建的实例, 某个实例关闭失败时继续关闭其他实例并返回所有错误
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	clients := m.clients
+	m.clients = map[string]*DouYinOpenApi{}
+	m.mu.Unlock()
+	var errs []error
+	for _, client := range clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// multiError 多个错误, 可以用 errors.Is/errors.As 判断其中的任意一个
+type multiError []error
+
+// Error 实现 error
+func (e multiError) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is 支持 errors.Is
+func (e multiError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As 支持 errors.As
+func (e multiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinErrors 合并多个错误, 没有错误时返回 nil, 只有一个时原样返回
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return multiError(errs)
+}
+
+// callbackApp 回调 msg 中标识小程序的字段
+type callbackApp struct {
+	Appid        string `json:"appid"`
+	AppId        string `json:"app_id"`
+	ThirdpartyId string `json:"thirdparty_id"`
+}
+
+// GetByCallback 根据回调内容中的 appid/app_id 及 thirdparty_id 获取对应的实例
+// body 为担保支付回调的原始请求内容, 返回的实例可以直接用于验签及解析回调
+func (m *Manager) GetByCallback(body []byte) (*DouYinOpenApi, error) {
+	var callback struct {
+		Msg string `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &callback); err != nil {
+		return nil, err
+	}
+	var app callbackApp
+	if err := json.Unmarshal([]byte(callback.Msg), &app); err != nil {
+		return nil, err
+	}
+	appId := app.Appid
+	if appId == "" {
+		appId = app.AppId
+	}
+	if appId == "" {
+		return nil, fmt.Errorf("%w: appid not found in callback", ErrAppNotFound)
+	}
+	return m.GetThirdparty(appId, app.ThirdpartyId)
+}
+
+// merge 合并公共配置与小程序配置, 小程序配置中为空的字段使用公共配置, 拦截器按先公共后小程序的顺序执行
+func (m *Manager) merge(config DouYinOpenApiConfig) DouYinOpenApiConfig {
+	base := m.Base
+	if config.Cache == nil {
+		config.Cache = base.Cache
+	}
+	if config.HttpClient == nil && config.Transport == nil {
+		config.HttpClient = base.HttpClient
+	}
+	config.IsSandbox = config.IsSandbox || base.IsSandbox
+	if config.RetryPolicy == nil {
+		config.RetryPolicy = base.RetryPolicy
+	}
+	if config.EndpointRetryPolicies == nil {
+		config.EndpointRetryPolicies = base.EndpointRetryPolicies
+	}
+	config.Interceptors = append(append([]Interceptor(nil), base.Interceptors...), config.Interceptors...)
+	if config.RateLimiter == nil {
+		config.RateLimiter = base.RateLimiter
+	}
+	if config.Metrics == nil {
+		config.Metrics = base.Metrics
+	}
+	if config.CircuitBreaker == nil {
+		config.CircuitBreaker = base.CircuitBreaker
+	}
+	if config.Signers == nil {
+		config.Signers = base.Signers
+	}
+	if config.Verifiers == nil {
+		config.Verifiers = base.Verifiers
+	}
+	if config.Environment == nil {
+		config.Environment = base.Environment
+	}
+	if config.BaseUrls == nil {
+		config.BaseUrls = base.BaseUrls
+	}
+	if config.AccessTokenRefresher == nil {
+		config.AccessTokenRefresher = base.AccessTokenRefresher
+	}
+	if config.AccessTokenLocker == nil {
+		config.AccessTokenLocker = base.AccessTokenLocker
+	}
+	if config.TokenInvalidateInterval == 0 {
+		config.TokenInvalidateInterval = base.TokenInvalidateInterval
+	}
+	if config.TokenRefreshHooks.OnRefresh == nil {
+		config.TokenRefreshHooks.OnRefresh = base.TokenRefreshHooks.OnRefresh
+	}
+	if config.TokenRefreshHooks.OnRefreshError == nil {
+		config.TokenRefreshHooks.OnRefreshError = base.TokenRefreshHooks.OnRefreshError
+	}
+	return config
+}
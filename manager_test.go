@@ -0,0 +1,122 @@
+package douyin_openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	accessToken "github.com/38888/douyin-openapi/access-token"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试多小程序管理: 懒加载/共享缓存及连接池/按回调 appid 路由
+func TestManager(t *testing.T) {
+	var requests int32
+	manager := NewManager(DouYinOpenApiConfig{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"err_no":0}`)), Request: r}, nil
+	})})
+	manager.Register(DouYinOpenApiConfig{AppId: "tt_a", Salt: "salt_a", Token: "token_a"})
+	manager.Register(DouYinOpenApiConfig{AppId: "tt_b", Salt: "salt_b", Token: "token_b"})
+	manager.RegisterThirdparty("tp_1", DouYinOpenApiConfig{AppId: "tt_b", Salt: "salt_tp", Token: "token_tp"})
+
+	a, err := manager.Get("tt_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := manager.Get("tt_a"); again != a {
+		t.Fatal("Get() should return the same instance")
+	}
+	b, _ := manager.Get("tt_b")
+	if a.Config.Cache != b.Config.Cache || a.Client.HttpClient != b.Client.HttpClient || a.Client == b.Client {
+		t.Fatal("instances should share cache and http client but not the executor")
+	}
+	if tp, _ := manager.GetThirdparty("tt_b", "tp_1"); tp.Config.Salt != "salt_tp" {
+		t.Fatalf("GetThirdparty() salt = %s", tp.Config.Salt)
+	}
+	if other, _ := manager.GetThirdparty("tt_b", "tp_2"); other != b {
+		t.Fatal("unregistered thirdparty_id should fall back to the app")
+	}
+	if _, err = manager.Get("tt_c"); !errors.Is(err, ErrAppNotFound) {
+		t.Fatalf("want ErrAppNotFound, got %v", err)
+	}
+	if _, err = b.QueryOrder("1", ""); err != nil || atomic.LoadInt32(&requests) != 1 {
+		t.Fatalf("QueryOrder() error = %v, requests = %d", err, requests)
+	}
+
+	// 回调路由到对应的小程序并使用其 Token 验签
+	msg := `{"appid":"tt_b","cp_orderno":"1","status":"SUCCESS"}`
+	signature, _ := b.GetSigner(EndpointPayCallback).Sign("1677648000", "nonce", msg)
+	body, _ := json.Marshal(map[string]string{"timestamp": "1677648000", "nonce": "nonce", "msg": msg, "msg_signature": signature, "type": "payment"})
+	client, err := manager.GetByCallback(body)
+	if err != nil || client != b {
+		t.Fatalf("GetByCallback() = %v, %v", client, err)
+	}
+	var callback PayCallbackResponse
+	_ = json.Unmarshal(body, &callback)
+	if data, err := client.PayCallback(callback, true); err != nil || data.CpOrderNo != "1" {
+		t.Fatalf("PayCallback() = %+v, %v", data, err)
+	}
+	if _, err = a.PayCallback(callback, true); err == nil {
+		t.Fatal("PayCallback() with another app's token should fail")
+	}
+}
+
+// 测试重新注册或移除小程序时关闭已创建的实例, 停止后台刷新
+func TestManager_CloseEvicted(t *testing.T) {
+	started := make(chan struct{}, 4)
+	stopped := make(chan struct{}, 4)
+	manager := NewManager(DouYinOpenApiConfig{
+		AccessTokenRefresher: &accessToken.RefresherConfig{},
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			// 后台刷新的请求一直等到刷新协程被停止
+			started <- struct{}{}
+			<-r.Context().Done()
+			stopped <- struct{}{}
+			return nil, r.Context().Err()
+		}),
+	})
+	defer manager.Close()
+	waitFor := func(ch chan struct{}, what string) {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+
+	manager.Register(DouYinOpenApiConfig{AppId: "tt_a", AppSecret: "secret"})
+	if _, err := manager.Get("tt_a"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(started, "refresher start")
+	manager.Register(DouYinOpenApiConfig{AppId: "tt_a", AppSecret: "secret_new"})
+	waitFor(stopped, "replaced instance to stop")
+
+	if _, err := manager.Get("tt_a"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(started, "refresher start")
+	manager.Remove("tt_a", "")
+	waitFor(stopped, "removed instance to stop")
+}
+
+// 测试合并多个错误
+func TestJoinErrors(t *testing.T) {
+	if joinErrors(nil) != nil {
+		t.Fatal("want nil")
+	}
+	first := errors.New("first")
+	if err := joinErrors([]error{first}); err != first {
+		t.Fatalf("want the only error, got %v", err)
+	}
+	err := joinErrors([]error{first, fmt.Errorf("wrap: %w", ErrAppNotFound)})
+	if !errors.Is(err, first) || !errors.Is(err, ErrAppNotFound) || err.Error() != "first; wrap: "+ErrAppNotFound.Error() {
+		t.Fatalf("joinErrors() = %v", err)
+	}
+}
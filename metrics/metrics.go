@@ -0,0 +1,30 @@
+package metrics
+
+import "time"
+
+// Metrics 监控指标收集接口, 可以对接 prometheus/statsd 等监控系统
+type Metrics interface {
+	// ObserveRequest 记录一次接口请求, statusCode 为 0 表示网络错误等未收到响应
+	ObserveRequest(endpoint string, statusCode int, duration time.Duration, err error)
+	// ObservePlatformError 记录一次平台错误码 err_no/err_code 等
+	ObservePlatformError(endpoint string, code int)
+	// ObserveTokenRefresh 记录一次 access_token 刷新
+	ObserveTokenRefresh(appId string, duration time.Duration, err error)
+	// ObserveCache 记录一次缓存读取是否命中
+	ObserveCache(name string, hit bool)
+}
+
+// 未发出请求的原因
+const (
+	RejectRateLimit   = "ratelimit"    // 被限流器拒绝
+	RejectCircuitOpen = "circuit_open" // 熔断打开
+	RejectCanceled    = "canceled"     // 等待限流时调用方的 context 已取消或超时
+)
+
+// RejectMetrics 支持记录未发出请求的 Metrics, 可选实现
+// 被限流/熔断拒绝的请求没有发给平台, 不调用 ObserveRequest, 以免混入请求次数及耗时
+type RejectMetrics interface {
+	Metrics
+	// ObserveRejected 记录一次未发出的请求, reason 为 RejectRateLimit/RejectCircuitOpen/RejectCanceled
+	ObserveRejected(endpoint, reason string)
+}
@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets 请求耗时直方图默认的分桶(秒)
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Prometheus 只依赖标准库的 Metrics 实现, 通过 http.Handler 输出 prometheus 文本格式
+type Prometheus struct {
+	namespace string
+	buckets   []float64
+
+	mu         sync.Mutex
+	counters   map[string]*family
+	histograms map[string]*histogramFamily
+}
+
+// family 同名的一组计数器
+type family struct {
+	help   string
+	values map[string]float64 // key 为格式化后的 label
+}
+
+// histogramFamily 同名的一组直方图
+type histogramFamily struct {
+	help   string
+	values map[string]*histogram
+}
+
+// histogram 直方图
+type histogram struct {
+	counts []uint64 // 每个分桶的累计数量
+	count  uint64
+	sum    float64
+}
+
+// NewPrometheus 实例化, namespace 为指标名前缀, 为空时使用 douyin_openapi
+func NewPrometheus(namespace string) *Prometheus {
+	if namespace == "" {
+		namespace = "douyin_openapi"
+	}
+	return &Prometheus{
+		namespace:  namespace,
+		buckets:    DefaultBuckets,
+		counters:   map[string]*family{},
+		histograms: map[string]*histogramFamily{},
+	}
+}
+
+// ObserveRequest 记录接口请求次数及耗时
+func (p *Prometheus) ObserveRequest(endpoint string, statusCode int, duration time.Duration, err error) {
+	status := strconv.Itoa(statusCode)
+	if statusCode == 0 {
+		status = "error"
+	}
+	p.inc("requests_total", "Total number of requests to douyin openapi.", labels("endpoint", endpoint, "status", status))
+	p.observe("request_duration_seconds", "Latency of requests to douyin openapi.", labels("endpoint", endpoint), duration.Seconds())
+}
+
+// ObserveRejected 记录被限流/熔断拒绝而未发出的请求
+func (p *Prometheus) ObserveRejected(endpoint, reason string) {
+	p.inc("requests_rejected_total", "Total number of requests rejected before being sent to douyin openapi.", labels("endpoint", endpoint, "reason", reason))
+}
+
+// ObservePlatformError 记录平台错误码
+func (p *Prometheus) ObservePlatformError(endpoint string, code int) {
+	p.inc("platform_errors_total", "Total number of platform error codes returned by douyin openapi.", labels("endpoint", endpoint, "code", strconv.Itoa(code)))
+}
+
+// ObserveTokenRefresh 记录 access_token 刷新
+func (p *Prometheus) ObserveTokenRefresh(appId string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	p.inc("token_refresh_total", "Total number of access_token refreshes.", labels("app_id", appId, "result", result))
+	p.observe("token_refresh_duration_seconds", "Latency of access_token refreshes.", labels("app_id", appId), duration.Seconds())
+}
+
+// ObserveCache 记录缓存命中情况
+func (p *Prometheus) ObserveCache(name string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	p.inc("cache_requests_total", "Total number of cache lookups.", labels("cache", name, "result", result))
+}
+
+// inc 计数器加一
+func (p *Prometheus) inc(name, help, labels string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, ok := p.counters[name]
+	if !ok {
+		f = &family{help: help, values: map[string]float64{}}
+		p.counters[name] = f
+	}
+	f.values[labels]++
+}
+
+// observe 直方图记录一个值
+func (p *Prometheus) observe(name, help, labels string, value float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, ok := p.histograms[name]
+	if !ok {
+		f = &histogramFamily{help: help, values: map[string]*histogram{}}
+		p.histograms[name] = f
+	}
+	h, ok := f.values[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(p.buckets))}
+		f.values[labels] = h
+	}
+	for i, bound := range p.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// ServeHTTP 输出 prometheus 文本格式的指标
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = p.Export(w)
+}
+
+// Export 将指标以 prometheus 文本格式写入 w
+func (p *Prometheus) Export(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var b strings.Builder
+	for _, name := range sortedKeys(p.counters) {
+		f := p.counters[name]
+		fullName := p.namespace + "_" + name
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", fullName, f.help, fullName)
+		for _, labels := range sortedKeys(f.values) {
+			fmt.Fprintf(&b, "%s{%s} %s\n", fullName, labels, formatFloat(f.values[labels]))
+		}
+	}
+	for _, name := range sortedKeys(p.histograms) {
+		f := p.histograms[name]
+		fullName := p.namespace + "_" + name
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s histogram\n", fullName, f.help, fullName)
+		for _, labels := range sortedKeys(f.values) {
+			h := f.values[labels]
+			for i, bound := range p.buckets {
+				fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d\n", fullName, labels, formatFloat(bound), h.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", fullName, labels, h.count)
+			fmt.Fprintf(&b, "%s_sum{%s} %s\n", fullName, labels, formatFloat(h.sum))
+			fmt.Fprintf(&b, "%s_count{%s} %d\n", fullName, labels, h.count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labels 格式化 label, 参数为 name, value 交替
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", pairs[i], escapeLabel(pairs[i+1])))
+	}
+	return strings.Join(parts, ",")
+}
+
+// labelReplacer 转义 label 中的特殊字符
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel 转义 label 的值
+func escapeLabel(value string) string {
+	return labelReplacer.Replace(value)
+}
+
+// formatFloat 格式化数值
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sortedKeys 排序后的 key, 保证输出稳定
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试 prometheus 文本输出: 计数器/直方图/label 转义
+func TestPrometheus(t *testing.T) {
+	p := NewPrometheus("")
+	p.ObserveRequest("queryOrder", 200, 30*time.Millisecond, nil)
+	p.ObserveRequest("queryOrder", 0, time.Second, errors.New("timeout"))
+	p.ObservePlatformError("queryOrder", 2009)
+	p.ObserveRejected("queryOrder", RejectCircuitOpen)
+	p.ObserveTokenRefresh("tt_test", 100*time.Millisecond, nil)
+	p.ObserveTokenRefresh("tt_test", 100*time.Millisecond, errors.New("bad secret"))
+	p.ObserveCache(`access"Token`, true)
+	p.ObserveCache(`access"Token`, false)
+
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("Content-Type = %s", contentType)
+	}
+	body := recorder.Body.String()
+	for _, want := range []string{
+		"# TYPE douyin_openapi_requests_total counter",
+		`douyin_openapi_requests_total{endpoint="queryOrder",status="200"} 1`,
+		`douyin_openapi_requests_total{endpoint="queryOrder",status="error"} 1`,
+		`douyin_openapi_platform_errors_total{endpoint="queryOrder",code="2009"} 1`,
+		`douyin_openapi_requests_rejected_total{endpoint="queryOrder",reason="circuit_open"} 1`,
+		`douyin_openapi_token_refresh_total{app_id="tt_test",result="success"} 1`,
+		`douyin_openapi_token_refresh_total{app_id="tt_test",result="error"} 1`,
+		`douyin_openapi_cache_requests_total{cache="access\"Token",result="hit"} 1`,
+		"# TYPE douyin_openapi_request_duration_seconds histogram",
+		`douyin_openapi_request_duration_seconds_bucket{endpoint="queryOrder",le="+Inf"} 2`,
+		`douyin_openapi_request_duration_seconds_sum{endpoint="queryOrder"} 1.03`,
+		`douyin_openapi_request_duration_seconds_count{endpoint="queryOrder"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -1,6 +1,6 @@
 package douyin_openapi
 
-import "fmt"
+import "context"
 
 const (
 	orderV2Push = "/api/apps/order/v2/push" // 订单推送
@@ -9,7 +9,7 @@ const (
 // OrderV2PushParams 订单推送
 type OrderV2PushParams struct {
 	ClientKey   string `json:"client_key,omitempty"`   // 否 第三方在抖音开放平台申请的 ClientKey 注意：POI 订单必传 awx1334dlkfjdf
-	AccessToken string `json:"access_token,omitempty"` // 是 服务端 API 调用标识，通过 getAccessToken 获取
+	AccessToken string `json:"access_token,omitempty"` // 是 服务端 API 调用标识，由 sdk 按当前的 token 自动填充
 	ExtShopId   string `json:"ext_shop_id,omitempty"`  // 否 POI 店铺同步时使用的开发者侧店铺 ID，购买店铺 ID，长度 < 256 byte 注意：POI 订单必传 ext_112233
 	AppName     string `json:"app_name,omitempty"`     // 是 做订单展示的字节系 app 名称，目前为固定值“douyin” douyin
 	OpenId      string `json:"open_id,omitempty"`      // 是 小程序用户的 open_id，通过 code2Session 获取 d33432323423
@@ -60,16 +60,14 @@ type OrderV2PushResponse struct {
 }
 
 // OrderV2Push 订单推送
-func (d *DouYinOpenApi) OrderV2Push(normal OrderV2PushParams) (orderV2PushResponse OrderV2PushResponse, err error) {
+func (d *DouYinOpenApi) OrderV2Push(normal OrderV2PushParams) (OrderV2PushResponse, error) {
+	return d.OrderV2PushContext(context.Background(), normal)
+}
+
+// OrderV2PushContext 订单推送, 支持传入 context
+func (d *DouYinOpenApi) OrderV2PushContext(ctx context.Context, normal OrderV2PushParams) (orderV2PushResponse OrderV2PushResponse, err error) {
 	// normal.AppId = d.Config.AppId
 	// normal.Sign = d.GenerateSign(params)
-	err = d.PostJson(d.GetApiUrl(orderV2Push), normal, &orderV2PushResponse)
-	if err != nil {
-		return
-	}
-	if orderV2PushResponse.ErrCode != 0 {
-		err = fmt.Errorf("OrderV2Push error %s %s", orderV2PushResponse.ErrMsg, orderV2PushResponse.Body)
-		return
-	}
+	err = d.postJson(ctx, EndpointOrderV2Push, normal, &orderV2PushResponse)
 	return
 }
@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLimited 超过限流且无法在 context 截止前获得令牌
+var ErrLimited = errors.New("ratelimit: rate limit exceeded")
+
+// Limiter 限流器接口, 实现此接口可以接入 redis 等分布式限流
+type Limiter interface {
+	// Wait 等待直到 appId 下的 endpoint 接口可以发起请求
+	// ctx 被取消或无法在截止时间前获得令牌时返回错误
+	Wait(ctx context.Context, appId, endpoint string) error
+}
+
+// Limit 限流配置
+type Limit struct {
+	QPS   float64 // 每秒产生的令牌数, 小于等于 0 时不限流
+	Burst int     // 桶的容量, 允许的突发请求数, 小于 1 时按 1 处理
+}
+
+type failFastKey struct{}
+
+// WithFailFast 返回一个标记为快速失败的 context, 令牌不足时直接返回 ErrLimited 而不等待
+func WithFailFast(ctx context.Context) context.Context {
+	return context.WithValue(ctx, failFastKey{}, true)
+}
+
+// isFailFast 是否快速失败
+func isFailFast(ctx context.Context) bool {
+	failFast, _ := ctx.Value(failFastKey{}).(bool)
+	return failFast
+}
+
+// bucket 令牌桶
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+// reserve 预占一个令牌, 返回需要等待的时间
+func (b *bucket) reserve(now time.Time) time.Duration {
+	burst := float64(b.limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.QPS
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.limit.QPS * float64(time.Second))
+}
+
+// TokenBucketLimiter 基于令牌桶的本地限流器, 可以按接口或按 AppId+接口 配置
+type TokenBucketLimiter struct {
+	mu           sync.Mutex
+	defaultLimit Limit
+	limits       map[string]Limit
+	buckets      map[string]*bucket
+}
+
+// NewTokenBucketLimiter 实例化一个令牌桶限流器, defaultLimit 为未单独配置的接口使用的限流
+func NewTokenBucketLimiter(defaultLimit Limit) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		defaultLimit: defaultLimit,
+		limits:       map[string]Limit{},
+		buckets:      map[string]*bucket{},
+	}
+}
+
+// SetLimit 设置某个接口的限流, 对所有 AppId 生效
+func (l *TokenBucketLimiter) SetLimit(endpoint string, limit Limit) {
+	l.setLimit(endpoint, limit)
+}
+
+// SetAppLimit 设置某个 AppId 下某个接口的限流, 优先级高于 SetLimit
+func (l *TokenBucketLimiter) SetAppLimit(appId, endpoint string, limit Limit) {
+	l.setLimit(key(appId, endpoint), limit)
+}
+
+// setLimit 设置限流并重置已有的令牌桶
+func (l *TokenBucketLimiter) setLimit(name string, limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[name] = limit
+	l.buckets = map[string]*bucket{}
+}
+
+// getLimit 获取限流配置
+func (l *TokenBucketLimiter) getLimit(appId, endpoint string) Limit {
+	if limit, ok := l.limits[key(appId, endpoint)]; ok {
+		return limit
+	}
+	if limit, ok := l.limits[endpoint]; ok {
+		return limit
+	}
+	return l.defaultLimit
+}
+
+// Wait 等待令牌, ctx 的截止时间早于获得令牌的时间或标记了 WithFailFast 时直接返回 ErrLimited
+func (l *TokenBucketLimiter) Wait(ctx context.Context, appId, endpoint string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name := key(appId, endpoint)
+	now := time.Now()
+
+	l.mu.Lock()
+	b, ok := l.buckets[name]
+	if !ok {
+		limit := l.getLimit(appId, endpoint)
+		if limit.QPS <= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		l.buckets[name] = b
+	}
+	delay := b.reserve(now)
+	if delay > 0 {
+		deadline, hasDeadline := ctx.Deadline()
+		if isFailFast(ctx) || (hasDeadline && deadline.Before(now.Add(delay))) {
+			b.tokens++
+			l.mu.Unlock()
+			return ErrLimited
+		}
+	}
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// 归还预占的令牌
+		l.mu.Lock()
+		b.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// key 生成 AppId+接口 的限流 key
+func key(appId, endpoint string) string {
+	return appId + ":" + endpoint
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 测试令牌桶: 突发/快速失败/截止时间/按 AppId 覆盖
+func TestTokenBucketLimiter(t *testing.T) {
+	limiter := NewTokenBucketLimiter(Limit{})
+	limiter.SetLimit("queryOrder", Limit{QPS: 0.1, Burst: 2})
+	limiter.SetAppLimit("tt_vip", "queryOrder", Limit{QPS: 0.1, Burst: 3})
+	ctx := context.Background()
+	failFast := WithFailFast(ctx)
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.Wait(failFast, "tt_test", "queryOrder"); err != nil {
+			t.Fatalf("burst request %d: %v", i, err)
+		}
+	}
+	if err := limiter.Wait(failFast, "tt_test", "queryOrder"); !errors.Is(err, ErrLimited) {
+		t.Fatalf("want ErrLimited, got %v", err)
+	}
+	// 截止时间早于获得令牌的时间时不等待
+	deadline, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := limiter.Wait(deadline, "tt_test", "queryOrder"); !errors.Is(err, ErrLimited) || time.Since(start) > 100*time.Millisecond {
+		t.Fatalf("want immediate ErrLimited, got %v after %v", err, time.Since(start))
+	}
+	// AppId 单独配置的限流及未配置的接口
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(failFast, "tt_vip", "queryOrder"); err != nil {
+			t.Fatalf("vip burst request %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if err := limiter.Wait(failFast, "tt_test", "queryRefund"); err != nil {
+			t.Fatalf("unlimited endpoint: %v", err)
+		}
+	}
+}
+
+// 测试令牌不足时等待, context 取消后归还预占的令牌
+func TestTokenBucketLimiter_Wait(t *testing.T) {
+	limiter := NewTokenBucketLimiter(Limit{QPS: 50, Burst: 1})
+	ctx := context.Background()
+	if err := limiter.Wait(ctx, "tt_test", "queryOrder"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := limiter.Wait(ctx, "tt_test", "queryOrder"); err != nil || time.Since(start) < 10*time.Millisecond {
+		t.Fatalf("want to wait for a token, got %v after %v", err, time.Since(start))
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	if err := limiter.Wait(cancelled, "tt_test", "queryOrder"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+	// 被取消的请求归还了令牌, 下一个令牌只需要等待一个周期
+	time.Sleep(25 * time.Millisecond)
+	if err := limiter.Wait(WithFailFast(ctx), "tt_test", "queryOrder"); err != nil {
+		t.Fatalf("want token returned after cancel, got %v", err)
+	}
+}
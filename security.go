@@ -1,8 +1,7 @@
 package douyin_openapi
 
 import (
-	"fmt"
-	"github.com/go-resty/resty/v2"
+	"context"
 )
 
 //内容安全
@@ -44,29 +43,17 @@ type SecurityCensorTextResponsePredict struct {
 }
 
 // SecurityCensorText 检测一段文本是否包含违法违规内容。
-func (d *DouYinOpenApi) SecurityCensorText(str string) (response SecurityCensorTextResponse, err error) {
+func (d *DouYinOpenApi) SecurityCensorText(str string) (SecurityCensorTextResponse, error) {
+	return d.SecurityCensorTextContext(context.Background(), str)
+}
+
+// SecurityCensorTextContext 检测一段文本是否包含违法违规内容, 支持传入 context
+func (d *DouYinOpenApi) SecurityCensorTextContext(ctx context.Context, str string) (response SecurityCensorTextResponse, err error) {
 	//请求 Headers X-Token
-	url := d.GetApiUrl(securityCensorText)
-	token, err := d.Config.AccessToken.GetAccessToken()
-	if err != nil {
-		err = fmt.Errorf("AccessToken error %s", err)
-		return
-	}
-	res, err := resty.New().R().
-		SetBody(SecurityCensorTextParams{
-			Tasks: []Content{{Value: str}},
-		}).
-		SetHeader("X-Token", token).
-		SetResult(&response).
-		SetError(&response).
-		Post(url)
-	if err != nil {
-		return
-	}
-	if response.Code != 0 || res.StatusCode() != 200 {
-		err = fmt.Errorf("SecurityText error %s", response.Message)
-		return
+	params := SecurityCensorTextParams{
+		Tasks: []Content{{Value: str}},
 	}
+	err = d.Execute(ctx, &Call{Endpoint: EndpointSecurityCensorText, URL: d.GetEndpointUrl(EndpointSecurityCensorText), JSON: params}, &response)
 	return
 }
 
@@ -96,9 +83,9 @@ type SecurityCensorImagePredict struct {
 }
 type SecurityCensorImageV2Params struct {
 	AppId       string `json:"app_id"`
-	AccessToken string `json:"access_token"`
-	Image       string `json:"image"`      //图片链接
-	ImageData   string `json:"image_data"` //图片数据的 base64 格式，有 image 字段时，此字段无效
+	AccessToken string `json:"access_token"` // 由 sdk 自动填充
+	Image       string `json:"image"`        //图片链接
+	ImageData   string `json:"image_data"`   //图片数据的 base64 格式，有 image 字段时，此字段无效
 }
 type SecurityCensorImageV2Response struct {
 	//0 成功
@@ -112,27 +99,14 @@ type SecurityCensorImageV2Response struct {
 }
 
 // SecurityCensorImageV2 检测图片是否包含违法违规内容。
-func (d *DouYinOpenApi) SecurityCensorImageV2(params SecurityCensorImageV2Params) (response SecurityCensorImageV2Response, err error) {
-	url := d.GetApiUrl(securityCensorImageV2)
-	token, err := d.Config.AccessToken.GetAccessToken()
-	if err != nil {
-		err = fmt.Errorf("AccessToken error %s", err)
-		return
-	}
+func (d *DouYinOpenApi) SecurityCensorImageV2(params SecurityCensorImageV2Params) (SecurityCensorImageV2Response, error) {
+	return d.SecurityCensorImageV2Context(context.Background(), params)
+}
+
+// SecurityCensorImageV2Context 检测图片是否包含违法违规内容, 支持传入 context
+func (d *DouYinOpenApi) SecurityCensorImageV2Context(ctx context.Context, params SecurityCensorImageV2Params) (response SecurityCensorImageV2Response, err error) {
 	params.AppId = d.Config.AppId
-	params.AccessToken = token
-	res, err := resty.New().R().
-		SetBody(params).
-		SetResult(&response).
-		SetError(&response).
-		Post(url)
-	if err != nil {
-		return
-	}
-	if response.Error != 0 || res.StatusCode() != 200 {
-		err = fmt.Errorf("SecurityCensorImageV3 error %s %d", response.Message, response.Error)
-		return
-	}
+	err = d.Execute(ctx, &Call{Endpoint: EndpointSecurityCensorImageV2, URL: d.GetEndpointUrl(EndpointSecurityCensorImageV2), JSON: params}, &response)
 	return
 }
 
@@ -149,28 +123,13 @@ type SecurityCensorImageV3Response struct {
 }
 
 // SecurityCensorImageV3 检测图片是否包含违法违规内容。
-func (d *DouYinOpenApi) SecurityCensorImageV3(params SecurityCensorImageV3Params) (censorImageV3Response SecurityCensorImageV3Response, err error) {
-	url := d.GetApiUrl(securityCensorImageV3)
+func (d *DouYinOpenApi) SecurityCensorImageV3(params SecurityCensorImageV3Params) (SecurityCensorImageV3Response, error) {
+	return d.SecurityCensorImageV3Context(context.Background(), params)
+}
 
+// SecurityCensorImageV3Context 检测图片是否包含违法违规内容, 支持传入 context
+func (d *DouYinOpenApi) SecurityCensorImageV3Context(ctx context.Context, params SecurityCensorImageV3Params) (censorImageV3Response SecurityCensorImageV3Response, err error) {
 	params.AppId = d.Config.AppId
-
-	token, err := d.Config.AccessToken.GetAccessToken()
-	if err != nil {
-		err = fmt.Errorf("AccessToken error %s", err)
-		return
-	}
-	res, err := resty.New().R().
-		SetBody(params).
-		SetHeader("access-token", token).
-		SetResult(&censorImageV3Response).
-		SetError(&censorImageV3Response).
-		Post(url)
-	if err != nil {
-		return
-	}
-	if censorImageV3Response.ErrNo != 0 || res.StatusCode() != 200 {
-		err = fmt.Errorf("SecurityCensorImageV3 error %s %d", censorImageV3Response.ErrMsg, censorImageV3Response.ErrNo)
-		return
-	}
+	err = d.Execute(ctx, &Call{Endpoint: EndpointSecurityCensorImageV3, URL: d.GetEndpointUrl(EndpointSecurityCensorImageV3), JSON: params}, &censorImageV3Response)
 	return
 }
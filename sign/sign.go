@@ -0,0 +1,291 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSignature 签名校验失败, 可以用 errors.Is 判断
+var ErrSignature = errors.New("sign: signature mismatch")
+
+// Signer 签名器, parts 为参与签名的字段, 含义由具体的签名方式决定
+type Signer interface {
+	Sign(parts ...string) (string, error)
+}
+
+// Verifier 验签器, parts 与对应 Signer 的含义一致
+type Verifier interface {
+	Verify(signature string, parts ...string) error
+}
+
+// RequestSigner 对整个 http 请求签名并通过请求头传递签名的签名器, 如新交易系统的 Byte-Authorization
+// 配置到 Signers 后请求内容中不再带 sign 字段, 由客户端在发送请求前设置返回的请求头
+type RequestSigner interface {
+	SignRequest(appId, method, uri, body string) (header, value string, err error)
+}
+
+// verify 比较签名是否一致
+func verify(signer Signer, signature string, parts ...string) error {
+	expected, err := signer.Sign(parts...)
+	if err != nil {
+		return err
+	}
+	// 不在错误中带上正确的签名, 回调错误通常会被记录或返回给请求方
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+		return ErrSignature
+	}
+	return nil
+}
+
+// MD5Salt 担保支付请求签名: 参数值加上 SALT 排序后以 & 拼接取 md5
+// parts 为参与签名的参数值, 通常由 EcpayValues 从请求参数中提取
+type MD5Salt struct {
+	Salt string // 担保支付的 SALT
+}
+
+// Sign 生成签名
+func (s MD5Salt) Sign(parts ...string) (string, error) {
+	values := append(append(make([]string, 0, len(parts)+1), parts...), s.Salt)
+	sort.Strings(values)
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(values, "&")))), nil
+}
+
+// Verify 校验签名
+func (s MD5Salt) Verify(signature string, parts ...string) error {
+	return verify(s, signature, parts...)
+}
+
+// ecpaySkipFields 不参与担保支付签名的字段
+var ecpaySkipFields = map[string]bool{
+	"other_settle_params": true,
+	"app_id":              true,
+	"thirdparty_id":       true,
+	"sign":                true,
+	"salt":                true,
+	"token":               true,
+}
+
+// EcpayValues 按担保支付的规则提取参与签名的参数值: 去掉 app_id/thirdparty_id/sign 等字段及空值
+// params 可以是结构体或 map, 按 json 序列化后的字段处理
+func EcpayValues(params interface{}) ([]string, error) {
+	var paramsMap map[string]interface{}
+	j, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(j, &paramsMap); err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(paramsMap))
+	for k, v := range paramsMap {
+		if ecpaySkipFields[k] {
+			continue
+		}
+		value := strings.TrimSpace(fmt.Sprintf("%v", v))
+		if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") && len(value) > 1 {
+			value = value[1 : len(value)-1]
+		}
+		value = strings.TrimSpace(value)
+		if value == "" || value == "null" {
+			continue
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// SHA1Token 担保支付回调签名: Token 与 timestamp/nonce/msg 排序后拼接取 sha1
+// parts 依次为 timestamp, nonce, msg
+type SHA1Token struct {
+	Token string // 担保支付的 Token
+}
+
+// Sign 生成签名
+func (s SHA1Token) Sign(parts ...string) (string, error) {
+	values := append(append(make([]string, 0, len(parts)+1), parts...), s.Token)
+	sort.Strings(values)
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(values, "")))), nil
+}
+
+// Verify 校验签名
+func (s SHA1Token) Verify(signature string, parts ...string) error {
+	return verify(s, signature, parts...)
+}
+
+// SHA1SessionKey 开放数据校验签名: rawData 拼接 session_key 取 sha1
+// parts 为 rawData
+type SHA1SessionKey struct {
+	SessionKey string // 用户的 session_key
+}
+
+// Sign 生成签名
+func (s SHA1SessionKey) Sign(parts ...string) (string, error) {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(parts, "")+s.SessionKey))), nil
+}
+
+// Verify 校验签名
+func (s SHA1SessionKey) Verify(signature string, parts ...string) error {
+	return verify(s, signature, parts...)
+}
+
+// RSASHA256 新交易系统/Byte-Authorization 签名: 各字段以换行拼接(末尾带换行)后 SHA256withRSA 签名并 base64
+// 请求签名时 parts 依次为 method, uri(含查询参数), timestamp, nonce, body
+// 平台回调验签时 parts 依次为 timestamp, nonce, body
+type RSASHA256 struct {
+	PrivateKey *rsa.PrivateKey // 开发者私钥, 用于签名
+	PublicKey  *rsa.PublicKey  // 平台公钥, 用于验签
+	KeyVersion string          // 公钥版本, 请求签名时写入 Byte-Authorization
+	Rand       io.Reader       // 随机数来源, 用于生成请求签名的 nonce, 为空时使用 crypto/rand
+}
+
+// rsaPayload 拼接签名内容
+func rsaPayload(parts []string) []byte {
+	var b strings.Builder
+	for _, part := range parts {
+		b.WriteString(part)
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// Sign 生成签名
+func (s RSASHA256) Sign(parts ...string) (string, error) {
+	if s.PrivateKey == nil {
+		return "", errors.New("sign: rsa private key is empty")
+	}
+	random := s.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+	hashed := sha256.Sum256(rsaPayload(parts))
+	signature, err := rsa.SignPKCS1v15(random, s.PrivateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// Verify 校验签名, 未设置 PublicKey 时使用私钥对应的公钥
+func (s RSASHA256) Verify(signature string, parts ...string) error {
+	publicKey := s.PublicKey
+	if publicKey == nil && s.PrivateKey != nil {
+		publicKey = &s.PrivateKey.PublicKey
+	}
+	if publicKey == nil {
+		return errors.New("sign: rsa public key is empty")
+	}
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrSignature, err)
+	}
+	hashed := sha256.Sum256(rsaPayload(parts))
+	if err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], raw); err != nil {
+		return fmt.Errorf("%w: %s", ErrSignature, err)
+	}
+	return nil
+}
+
+// SignRequest 生成请求的 Byte-Authorization 请求头, uri 为不含域名的路径及查询参数
+func (s RSASHA256) SignRequest(appId, method, uri, body string) (header, value string, err error) {
+	random := s.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+	nonce := make([]byte, 16)
+	if _, err = io.ReadFull(random, nonce); err != nil {
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	value, err = ByteAuthorization(s, appId, s.KeyVersion, method, uri, timestamp, hex.EncodeToString(nonce), body)
+	return ByteAuthorizationHeader, value, err
+}
+
+// ByteAuthorizationHeader 新交易系统请求签名的请求头
+const ByteAuthorizationHeader = "Byte-Authorization"
+
+// ByteAuthorization 生成新交易系统请求的 Byte-Authorization 请求头
+func ByteAuthorization(signer Signer, appId, keyVersion, method, uri, timestamp, nonce, body string) (string, error) {
+	signature, err := signer.Sign(method, uri, timestamp, nonce, body)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`SHA256-RSA2048 appid="%s",nonce_str="%s",timestamp="%s",key_version="%s",signature="%s"`,
+		appId, nonce, timestamp, keyVersion, signature), nil
+}
+
+// VerifyByteAuthorization 校验请求的 Byte-Authorization 请求头, 成功时返回其中的 appid
+func VerifyByteAuthorization(verifier Verifier, authorization, method, uri, body string) (appId string, err error) {
+	const scheme = "SHA256-RSA2048 "
+	if !strings.HasPrefix(authorization, scheme) {
+		return "", ErrSignature
+	}
+	fields := map[string]string{}
+	for _, pair := range strings.Split(strings.TrimPrefix(authorization, scheme), ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return "", ErrSignature
+		}
+		fields[key] = strings.Trim(value, `"`)
+	}
+	if err = verifier.Verify(fields["signature"], method, uri, fields["timestamp"], fields["nonce_str"], body); err != nil {
+		return
+	}
+	return fields["appid"], nil
+}
+
+// ParsePrivateKey 解析 PEM 格式的 RSA 私钥, 支持 PKCS#1 及 PKCS#8
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("sign: invalid pem private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("sign: private key is not rsa")
+	}
+	return rsaKey, nil
+}
+
+// ParsePublicKey 解析 PEM 格式的 RSA 公钥, 支持 PKIX 及 PKCS#1
+func ParsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("sign: invalid pem public key")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("sign: public key is not rsa")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,78 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// AuthScheme access_token 的传递方式, 由接口描述声明, 请求前自动注入当前的 token
+type AuthScheme interface {
+	Inject(call *Call, token string) error // 将 token 注入到请求中
+}
+
+// HeaderAuth 通过请求头传递 token, 值为请求头名称, 如 X-Token/access-token
+type HeaderAuth string
+
+// Inject 设置请求头
+func (h HeaderAuth) Inject(call *Call, token string) error {
+	header := http.Header{}
+	for key, values := range call.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	header.Set(string(h), token)
+	call.Header = header
+	return nil
+}
+
+// QueryAuth 通过查询参数传递 token, 值为参数名称
+type QueryAuth string
+
+// Inject 设置查询参数
+func (q QueryAuth) Inject(call *Call, token string) error {
+	query := url.Values{}
+	for key, values := range call.Query {
+		query[key] = append([]string(nil), values...)
+	}
+	query.Set(string(q), token)
+	call.Query = query
+	return nil
+}
+
+// BodyAuth 通过请求内容中的字段传递 token, 值为字段名称, 如 access_token
+// 支持 json/表单/multipart 请求内容, json 请求内容会被转换为 map 后设置该字段
+type BodyAuth string
+
+// Inject 设置请求内容中的字段
+func (b BodyAuth) Inject(call *Call, token string) error {
+	field := string(b)
+	switch {
+	case call.JSON != nil:
+		fields, err := JsonStructToMap(call.JSON)
+		if err != nil {
+			return err
+		}
+		if fields == nil {
+			return fmt.Errorf("%s: request body is not a json object", call.Endpoint)
+		}
+		fields[field] = token
+		call.JSON = fields
+	case call.Form != nil:
+		form := url.Values{}
+		for key, values := range call.Form {
+			form[key] = append([]string(nil), values...)
+		}
+		form.Set(field, token)
+		call.Form = form
+	case call.Multipart != nil:
+		multipart := &Multipart{Fields: map[string]string{}, Files: call.Multipart.Files}
+		for key, value := range call.Multipart.Fields {
+			multipart.Fields[key] = value
+		}
+		multipart.Fields[field] = token
+		call.Multipart = multipart
+	default:
+		call.JSON = map[string]interface{}{field: token}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultTimeout             = 15 * time.Second // 默认的请求超时时间
+	DefaultDialTimeout         = 5 * time.Second  // 默认的建连超时时间
+	DefaultIdleConnTimeout     = 90 * time.Second // 空闲连接保持时间
+	DefaultMaxIdleConnsPerHost = 32               // 每个 host 保持的空闲连接数
+)
+
+// defaultHttpClient 默认的 http 客户端, 带超时及连接池
+var defaultHttpClient = NewDefaultHttpClient()
+
+// NewDefaultHttpClient 实例化一个带默认超时及 keep-alive 连接池的 http 客户端
+func NewDefaultHttpClient() *http.Client {
+	return &http.Client{
+		Timeout:   DefaultTimeout,
+		Transport: NewDefaultTransport(),
+	}
+}
+
+// NewDefaultTransport 实例化一个默认的 Transport
+func NewDefaultTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   DefaultDialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       DefaultIdleConnTimeout,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// Client 统一的 http 请求执行器, 所有接口共用一个以便复用连接池
+type Client struct {
+	HttpClient   *http.Client  // 实际发送请求的客户端, 为空时使用默认客户端
+	Interceptors []Interceptor // 拦截器, 按添加顺序由外到内执行
+}
+
+// NewClient 通过 *http.Client 实例化请求执行器, httpClient 为空时使用默认客户端
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = defaultHttpClient
+	}
+	return &Client{HttpClient: httpClient}
+}
+
+// NewClientWithTransport 通过 RoundTripper 实例化请求执行器, 使用默认的超时时间
+func NewClientWithTransport(transport http.RoundTripper) *Client {
+	if transport == nil {
+		return NewClient(nil)
+	}
+	return NewClient(&http.Client{
+		Timeout:   DefaultTimeout,
+		Transport: transport,
+	})
+}
+
+// GetHttpClient 获取实际发送请求的客户端
+func (c *Client) GetHttpClient() *http.Client {
+	if c == nil || c.HttpClient == nil {
+		return defaultHttpClient
+	}
+	return c.HttpClient
+}
+
+// Request 一次接口请求
+type Request struct {
+	Endpoint string      // 接口名称
+	Method   string      // 请求方法
+	URL      string      // 请求地址
+	Header   http.Header // 请求头
+	Body     []byte      // 请求内容
+}
+
+// Response http 请求的返回值
+type Response struct {
+	StatusCode int           // http 状态码
+	Header     http.Header   // 返回的 header
+	Body       []byte        // 返回的内容
+	Duration   time.Duration // 请求耗时
+}
+
+// Handler 执行一次请求
+type Handler func(ctx context.Context, req *Request) (*Response, error)
+
+// Interceptor 请求拦截器, 可以在请求前后加入日志/链路追踪/监控/测试断言等逻辑
+//
+//	func(next util.Handler) util.Handler {
+//		return func(ctx context.Context, req *util.Request) (*util.Response, error) {
+//			res, err := next(ctx, req)
+//			log.Println(req.Endpoint, res, err)
+//			return res, err
+//		}
+//	}
+type Interceptor func(next Handler) Handler
+
+// Use 添加拦截器, 需要在发起请求前调用
+func (c *Client) Use(interceptors ...Interceptor) {
+	c.Interceptors = append(c.Interceptors, interceptors...)
+}
+
+// Do 经过拦截器执行请求, 非 200 状态码不视为错误
+func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
+	handler := c.send
+	if c != nil {
+		for i := len(c.Interceptors) - 1; i >= 0; i-- {
+			handler = c.Interceptors[i](handler)
+		}
+	}
+	return handler(ctx, req)
+}
+
+// PostForm post form 数据请求
+func (c *Client) PostForm(ctx context.Context, uri string, obj url.Values) ([]byte, error) {
+	return readBody(c.Execute(ctx, &Call{URL: uri, Form: obj}))
+}
+
+// PostJSON post json 数据请求
+func (c *Client) PostJSON(ctx context.Context, uri string, obj interface{}) ([]byte, error) {
+	return readBody(c.PostJSONResponse(ctx, "", uri, obj, nil))
+}
+
+// PostJSONResponse post json 数据请求, 返回完整的响应, 非 200 状态码不视为错误
+func (c *Client) PostJSONResponse(ctx context.Context, endpoint, uri string, obj interface{}, header http.Header) (*Response, error) {
+	return c.Execute(ctx, &Call{Endpoint: endpoint, URL: uri, Header: header, JSON: obj})
+}
+
+// send 发送请求并读取返回内容
+func (c *Client) send(ctx context.Context, req *Request) (*Response, error) {
+	request, err := http.NewRequestWithContext(ctx, req.Method, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range req.Header {
+		request.Header[key] = values
+	}
+	start := time.Now()
+	response, err := c.GetHttpClient().Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		Body:       body,
+		Duration:   time.Since(start),
+	}, nil
+}
+
+// readBody 读取返回内容, 非 200 状态码返回错误
+func readBody(response *Response, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http get error : statusCode=%v", response.StatusCode)
+	}
+	return response.Body, nil
+}
@@ -0,0 +1,95 @@
+package util
+
+import "strings"
+
+// Family 接口分组, 不同分组的接口可以使用不同的域名
+type Family string
+
+const (
+	FamilyMiniApp      Family = "mini_app"      // 小程序接口, 如登录/access_token/订单推送
+	FamilyEcpay        Family = "ecpay"         // 担保支付接口
+	FamilyCensor       Family = "censor"        // 内容安全接口
+	FamilyOpenPlatform Family = "open_platform" // 抖音开放平台 open.douyin.com 接口
+	FamilyThirdParty   Family = "third_party"   // 小程序第三方平台 open.microapp.bytedance.com 接口
+)
+
+// Environment 接口环境, 维护每个接口分组对应的域名
+type Environment struct {
+	Name     string            // 环境名称
+	BaseUrls map[Family]string // 接口分组对应的域名
+}
+
+// ProductionEnvironment 正式环境
+func ProductionEnvironment() Environment {
+	return Environment{
+		Name: "production",
+		BaseUrls: map[Family]string{
+			FamilyMiniApp:      "https://developer.toutiao.com",
+			FamilyEcpay:        "https://developer.toutiao.com",
+			FamilyCensor:       "https://developer.toutiao.com",
+			FamilyOpenPlatform: "https://open.douyin.com",
+			FamilyThirdParty:   "https://open.microapp.bytedance.com",
+		},
+	}
+}
+
+// SandboxEnvironment 沙盒环境
+func SandboxEnvironment() Environment {
+	return Environment{
+		Name: "sandbox",
+		BaseUrls: map[Family]string{
+			FamilyMiniApp:      "https://open-sandbox.douyin.com",
+			FamilyEcpay:        "https://open-sandbox.douyin.com",
+			FamilyCensor:       "https://open-sandbox.douyin.com",
+			FamilyOpenPlatform: "https://open-sandbox.douyin.com",
+			FamilyThirdParty:   "https://open.microapp.bytedance.com",
+		},
+	}
+}
+
+// GetEnvironment 根据是否沙盒获取环境
+func GetEnvironment(isSandbox bool) Environment {
+	if isSandbox {
+		return SandboxEnvironment()
+	}
+	return ProductionEnvironment()
+}
+
+// NewEnvironment 实例化一个所有接口分组都使用同一个域名的环境, 如本地 mock 或代理
+func NewEnvironment(name, baseUrl string) Environment {
+	return Environment{
+		Name: name,
+		BaseUrls: map[Family]string{
+			FamilyMiniApp:      baseUrl,
+			FamilyEcpay:        baseUrl,
+			FamilyCensor:       baseUrl,
+			FamilyOpenPlatform: baseUrl,
+			FamilyThirdParty:   baseUrl,
+		},
+	}
+}
+
+// With 返回覆盖了部分接口分组域名的新环境, 不修改原环境
+func (e Environment) With(baseUrls map[Family]string) Environment {
+	merged := make(map[Family]string, len(e.BaseUrls)+len(baseUrls))
+	for family, baseUrl := range e.BaseUrls {
+		merged[family] = baseUrl
+	}
+	for family, baseUrl := range baseUrls {
+		merged[family] = baseUrl
+	}
+	return Environment{Name: e.Name, BaseUrls: merged}
+}
+
+// BaseUrl 获取接口分组对应的域名, 未配置时使用小程序接口的域名
+func (e Environment) BaseUrl(family Family) string {
+	if baseUrl, ok := e.BaseUrls[family]; ok {
+		return strings.TrimRight(baseUrl, "/")
+	}
+	return strings.TrimRight(e.BaseUrls[FamilyMiniApp], "/")
+}
+
+// Url 拼接接口地址
+func (e Environment) Url(family Family, path string) string {
+	return e.BaseUrl(family) + path
+}
@@ -0,0 +1,203 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// 平台错误码分类, 可以在初始化阶段按需补充
+var (
+	// AuthErrorCodes 鉴权失败的错误码, 如 access_token 无效/过期
+	AuthErrorCodes = map[int]bool{
+		28001003: true, // access_token 无效
+		28001008: true, // access_token 已过期
+		401:      true, // 内容安全接口 access_token 无效
+		2190002:  true, // 开放平台 access_token/client_token 无效
+		2190008:  true, // 开放平台 access_token/client_token 已过期
+	}
+	// RateLimitErrorCodes 请求过于频繁的错误码
+	RateLimitErrorCodes = map[int]bool{
+		28001014: true, // 请求频率超限
+	}
+	// RetryableErrorCodes 可以重试的错误码, 如平台内部错误
+	RetryableErrorCodes = map[int]bool{
+		-1: true, // 系统错误
+	}
+)
+
+// logIdHeader 抖音返回 log_id 的响应头
+const logIdHeader = "X-Tt-Logid"
+
+// APIError 抖音接口返回的错误, 包括网络错误/http 状态码错误/平台错误码
+type APIError struct {
+	Endpoint   string // 接口名称
+	StatusCode int    // http 状态码, 网络错误时为 0
+	Code       int    // 平台错误码 err_no/err_code/errno/error/code
+	Message    string // 平台错误信息 err_tips/err_msg/message
+	LogId      string // 请求的 log_id, 向抖音反馈问题时需要提供
+	Attempts   int    // 尝试的次数, 开启重试时大于 1
+	Err        error  // 底层错误, 如网络错误或解析错误
+}
+
+// Error 实现 error 接口
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s error", e.Endpoint)
+	if e.StatusCode != 0 && e.StatusCode != http.StatusOK {
+		fmt.Fprintf(&b, " status=%d", e.StatusCode)
+	}
+	if e.Code != 0 || e.Message != "" {
+		fmt.Fprintf(&b, " code=%d message=%s", e.Code, e.Message)
+	}
+	if e.LogId != "" {
+		fmt.Fprintf(&b, " log_id=%s", e.LogId)
+	}
+	if e.Attempts > 1 {
+		fmt.Fprintf(&b, " attempts=%d", e.Attempts)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, ": %s", e.Err)
+	}
+	return b.String()
+}
+
+// Unwrap 返回底层错误
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// IsAuthError 是否为鉴权错误
+func (e *APIError) IsAuthError() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden || AuthErrorCodes[e.Code]
+}
+
+// IsRateLimited 是否为限流错误
+func (e *APIError) IsRateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests || RateLimitErrorCodes[e.Code]
+}
+
+// IsRetryable 是否可以重试: 网络超时(包括 http.Client.Timeout)/连接被拒绝或重置/响应被截断, 5xx, 限流, 平台内部错误
+// 证书错误/不支持的协议等其他传输错误重试也不会成功, 不重试
+// 调用方的 context 已取消或超时时不应再重试, 由 RetryPolicy.Do 检查 ctx.Err() 判断, 这里只看错误本身
+func (e *APIError) IsRetryable() bool {
+	if e.Err != nil {
+		return isTemporaryNetError(e.Err)
+	}
+	return e.StatusCode >= http.StatusInternalServerError || e.IsRateLimited() || RetryableErrorCodes[e.Code]
+}
+
+// isTemporaryNetError 是否为重试可能成功的网络错误
+// *url.Error 也实现了 net.Error, 不能只按类型判断
+func isTemporaryNetError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// AsAPIError 从错误链中取出 APIError
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+// IsRetryable 错误是否可以重试
+func IsRetryable(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.IsRetryable()
+}
+
+// IsAuthError 错误是否为鉴权错误
+func IsAuthError(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.IsAuthError()
+}
+
+// IsRateLimited 错误是否为限流错误
+func IsRateLimited(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.IsRateLimited()
+}
+
+// WrapError 将网络等底层错误包装为 APIError, 已经是 APIError 时原样返回
+func WrapError(endpoint string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := AsAPIError(err); ok {
+		return err
+	}
+	return &APIError{Endpoint: endpoint, Err: err}
+}
+
+// CheckResponse 检查返回值, http 状态码非 200 或平台错误码非 0 时返回 APIError
+// 状态码为 200 的非 json 返回值(如图片)不做检查
+func CheckResponse(endpoint string, response *Response) error {
+	if response.StatusCode == http.StatusOK && !response.IsJSON() {
+		return nil
+	}
+	apiErr := &APIError{
+		Endpoint:   endpoint,
+		StatusCode: response.StatusCode,
+		LogId:      response.Header.Get(logIdHeader),
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(response.Body, &fields); err == nil {
+		apiErr.Code = firstInt(fields, "err_no", "err_code", "errno", "error", "code")
+		apiErr.Message = firstString(fields, "err_tips", "err_msg", "message", "errmsg")
+		if logId := firstString(fields, "log_id", "logid"); logId != "" {
+			apiErr.LogId = logId
+		}
+		// open.douyin.com 接口的错误码在 data.error_code/data.description 中, log_id 在 extra.logid 中
+		var data, extra map[string]json.RawMessage
+		if apiErr.Code == 0 && json.Unmarshal(fields["data"], &data) == nil {
+			if apiErr.Code = firstInt(data, "error_code"); apiErr.Code != 0 {
+				apiErr.Message = firstString(data, "description")
+			}
+		}
+		if json.Unmarshal(fields["extra"], &extra) == nil {
+			if logId := firstString(extra, "logid"); logId != "" {
+				apiErr.LogId = logId
+			}
+		}
+	} else if response.StatusCode == http.StatusOK {
+		apiErr.Err = err
+		return apiErr
+	}
+	if response.StatusCode != http.StatusOK || apiErr.Code != 0 {
+		return apiErr
+	}
+	return nil
+}
+
+// firstInt 按顺序取第一个存在的数字字段
+func firstInt(fields map[string]json.RawMessage, keys ...string) int {
+	for _, key := range keys {
+		var val int
+		if raw, ok := fields[key]; ok && json.Unmarshal(raw, &val) == nil {
+			return val
+		}
+	}
+	return 0
+}
+
+// firstString 按顺序取第一个非空的字符串字段
+func firstString(fields map[string]json.RawMessage, keys ...string) string {
+	for _, key := range keys {
+		var val string
+		if raw, ok := fields[key]; ok && json.Unmarshal(raw, &val) == nil && val != "" {
+			return val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package util
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError 超时的网络错误
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// urlError 模拟 http.Client 返回的错误, *url.Error 本身实现了 net.Error
+func urlError(err error) error {
+	return &url.Error{Op: "Post", URL: "https://developer.toutiao.com", Err: err}
+}
+
+// 测试只有重试可能成功的网络错误才重试
+func TestAPIError_IsRetryable(t *testing.T) {
+	dialErr := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)}
+	}
+	tests := []struct {
+		name string
+		err  *APIError
+		want bool
+	}{
+		{"timeout", &APIError{Err: urlError(timeoutError{})}, true},
+		{"connection refused", &APIError{Err: urlError(dialErr(syscall.ECONNREFUSED))}, true},
+		{"connection reset", &APIError{Err: urlError(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)})}, true},
+		{"unexpected eof", &APIError{Err: urlError(io.ErrUnexpectedEOF)}, true},
+		{"certificate", &APIError{Err: urlError(x509.UnknownAuthorityError{})}, false},
+		{"unsupported scheme", &APIError{Err: urlError(errors.New(`unsupported protocol scheme "ftp"`))}, false},
+		{"context canceled", &APIError{Err: urlError(context.Canceled)}, false},
+		{"server error", &APIError{StatusCode: http.StatusBadGateway}, true},
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"bad request", &APIError{StatusCode: http.StatusBadRequest}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.err.IsRetryable(); got != tt.want {
+			t.Errorf("%s: IsRetryable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// 测试不可恢复的传输错误只请求一次
+func TestRetryPolicy_NonTemporaryTransportError(t *testing.T) {
+	attempts := 0
+	client := NewClientWithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, x509.UnknownAuthorityError{}
+	}))
+	err := DefaultRetryPolicy().Do(context.Background(), "test", func(ctx context.Context) error {
+		_, err := client.Execute(ctx, &Call{Endpoint: "test", URL: "https://developer.toutiao.com/test"})
+		return WrapError("test", err)
+	})
+	if apiErr, ok := AsAPIError(err); !ok || apiErr.Attempts != 1 || attempts != 1 {
+		t.Fatalf("want 1 attempt, got %d: %v", attempts, err)
+	}
+}
+
+// roundTripFunc 使用函数模拟 http 请求
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// slowServer 直到客户端断开才返回的服务
+func slowServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+}
+
+// 测试 http.Client.Timeout 超时会重试, 调用方的 context 超时不再重试
+func TestRetryPolicy_Timeout(t *testing.T) {
+	server := slowServer()
+	defer server.Close()
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	call := &Call{Endpoint: "test", URL: server.URL}
+
+	attempts := 0
+	client := NewClient(&http.Client{Timeout: 20 * time.Millisecond})
+	err := policy.Do(context.Background(), "test", func(ctx context.Context) error {
+		attempts++
+		_, err := client.Execute(ctx, call)
+		return WrapError("test", err)
+	})
+	if !IsRetryable(err) || attempts != 3 {
+		t.Fatalf("want 3 attempts for client timeout, got %d: %v", attempts, err)
+	}
+
+	attempts = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = policy.Do(ctx, "test", func(ctx context.Context) error {
+		attempts++
+		_, err := NewClient(nil).Execute(ctx, call)
+		return WrapError("test", err)
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || attempts != 1 {
+		t.Fatalf("want 1 attempt for caller deadline, got %d: %v", attempts, err)
+	}
+}
@@ -2,43 +2,39 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"net/http"
 	"net/url"
 )
 
 // PostForm post form 数据请求
 func PostForm(uri string, obj url.Values) ([]byte, error) {
-	response, err := http.PostForm(uri, obj)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
+	return PostFormContext(context.Background(), uri, obj)
+}
 
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http get error : uri=%v , statusCode=%v", uri, response.StatusCode)
-	}
-	return ioutil.ReadAll(response.Body)
+// PostFormContext post form 数据请求, 支持传入 context
+func PostFormContext(ctx context.Context, uri string, obj url.Values) ([]byte, error) {
+	return NewClient(nil).PostForm(ctx, uri, obj)
+}
+
+// Get get 请求
+func Get(uri string, query url.Values) ([]byte, error) {
+	return GetContext(context.Background(), uri, query)
+}
+
+// GetContext get 请求, 支持传入 context
+func GetContext(ctx context.Context, uri string, query url.Values) ([]byte, error) {
+	return NewClient(nil).Get(ctx, uri, query)
 }
 
 // PostJSON post json 数据请求
 func PostJSON(uri string, obj interface{}) ([]byte, error) {
-	marshal, err := json.Marshal(obj)
-	if err != nil {
-		return nil, err
-	}
-	response, err := http.Post(uri, "application/json;charset=utf-8", bytes.NewBuffer(marshal))
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
+	return PostJSONContext(context.Background(), uri, obj)
+}
 
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http get error : uri=%v , statusCode=%v", uri, response.StatusCode)
-	}
-	return ioutil.ReadAll(response.Body)
+// PostJSONContext post json 数据请求, 支持传入 context
+func PostJSONContext(ctx context.Context, uri string, obj interface{}) ([]byte, error) {
+	return NewClient(nil).PostJSON(ctx, uri, obj)
 }
 
 // JsonStructToMap ...
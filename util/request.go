@@ -0,0 +1,171 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// Call 一次接口调用的描述, 由 Client.Execute 构建成 http 请求
+// 请求内容按 JSON > Form > Multipart > Body 的优先级选择其一
+type Call struct {
+	Endpoint    string      // 接口名称, 用于错误/监控/限流
+	Method      string      // 请求方法, 为空时为 POST
+	URL         string      // 请求地址, 可以已经带有查询参数
+	Query       url.Values  // 查询参数, 追加到 URL 上
+	Header      http.Header // 请求头
+	JSON        interface{} // json 请求内容
+	Form        url.Values  // 表单请求内容
+	Multipart   *Multipart  // multipart/form-data 请求内容, 用于上传文件
+	Body        []byte      // 原始请求内容
+	ContentType string      // 原始请求内容的类型
+	Auth        AuthScheme  // access_token 的传递方式, 为空时使用接口描述中声明的方式
+	Family      Family      // 接口分组, 决定使用哪个 token(如开放平台接口使用 client_token), 为空时使用接口描述中的分组
+}
+
+// Multipart multipart/form-data 请求内容
+type Multipart struct {
+	Fields map[string]string // 普通字段
+	Files  []MultipartFile   // 文件字段
+}
+
+// MultipartFile multipart 中的一个文件
+type MultipartFile struct {
+	Field       string    // 字段名
+	FileName    string    // 文件名
+	ContentType string    // 文件类型, 为空时为 application/octet-stream
+	Content     []byte    // 文件内容
+	Reader      io.Reader // 文件内容, Content 为空时读取, 只能读取一次, 需要重试时请使用 Content
+}
+
+// AddField 添加普通字段
+func (m *Multipart) AddField(name, value string) *Multipart {
+	if m.Fields == nil {
+		m.Fields = map[string]string{}
+	}
+	m.Fields[name] = value
+	return m
+}
+
+// AddFile 添加文件
+func (m *Multipart) AddFile(field, fileName string, content []byte) *Multipart {
+	m.Files = append(m.Files, MultipartFile{Field: field, FileName: fileName, Content: content})
+	return m
+}
+
+// encode 编码为请求内容, 返回内容及 Content-Type
+func (m *Multipart) encode() ([]byte, string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for name, value := range m.Fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, "", err
+		}
+	}
+	for _, file := range m.Files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(file.Field), escapeQuotes(file.FileName)))
+		header.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if file.Content != nil || file.Reader == nil {
+			_, err = part.Write(file.Content)
+		} else {
+			_, err = io.Copy(part, file.Reader)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), writer.FormDataContentType(), nil
+}
+
+// escapeQuotes 转义 multipart 头中的引号
+func escapeQuotes(s string) string {
+	return strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace(s)
+}
+
+// Request 构建请求
+func (call *Call) Request() (*Request, error) {
+	req := &Request{
+		Endpoint: call.Endpoint,
+		Method:   call.Method,
+		URL:      call.URL,
+		Header:   http.Header{},
+	}
+	if req.Method == "" {
+		req.Method = http.MethodPost
+	}
+	if len(call.Query) > 0 {
+		sep := "?"
+		if strings.Contains(req.URL, "?") {
+			sep = "&"
+		}
+		req.URL += sep + call.Query.Encode()
+	}
+	for key, values := range call.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	contentType := call.ContentType
+	switch {
+	case call.JSON != nil:
+		body, err := json.Marshal(call.JSON)
+		if err != nil {
+			return nil, err
+		}
+		req.Body, contentType = body, "application/json;charset=utf-8"
+	case call.Form != nil:
+		req.Body, contentType = []byte(call.Form.Encode()), "application/x-www-form-urlencoded"
+	case call.Multipart != nil:
+		body, multipartType, err := call.Multipart.encode()
+		if err != nil {
+			return nil, err
+		}
+		req.Body, contentType = body, multipartType
+	default:
+		req.Body = call.Body
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// Execute 构建并执行一次接口调用, 返回完整的响应, 非 200 状态码不视为错误
+// 响应内容原样保存在 Response.Body 中, 可以是 json 也可以是图片等二进制数据
+func (c *Client) Execute(ctx context.Context, call *Call) (*Response, error) {
+	req, err := call.Request()
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(ctx, req)
+}
+
+// Get get 请求, 返回原始内容, 非 200 状态码返回错误
+func (c *Client) Get(ctx context.Context, uri string, query url.Values) ([]byte, error) {
+	return readBody(c.Execute(ctx, &Call{Method: http.MethodGet, URL: uri, Query: query}))
+}
+
+// IsJSON 返回内容是否为 json, 未声明 Content-Type 或为 text/plain 时也按 json 处理(部分接口以 text/plain 返回 json)
+func (r *Response) IsJSON() bool {
+	contentType := r.Header.Get("Content-Type")
+	return contentType == "" || strings.Contains(contentType, "json") || strings.HasPrefix(contentType, "text/plain")
+}
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryPolicy 重试策略, 按指数退避并加入随机抖动
+type RetryPolicy struct {
+	MaxAttempts int                                                                // 最大尝试次数(包含第一次), 小于等于 1 时不重试
+	BaseDelay   time.Duration                                                      // 第一次重试前的等待时间
+	MaxDelay    time.Duration                                                      // 最大等待时间
+	Retryable   func(err error) bool                                               // 判断错误是否可以重试, 为空时使用 IsRetryable
+	OnRetry     func(endpoint string, attempt int, err error, delay time.Duration) // 每次重试前的回调, attempt 为已经尝试的次数
+}
+
+// DefaultRetryPolicy 默认的重试策略: 最多 3 次, 100ms 起按指数退避, 最长等待 2s
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+	}
+}
+
+// Do 按重试策略执行 fn, policy 为空时只执行一次
+// ctx 被取消或超时后不再重试, 传输层的超时(如 http.Client.Timeout)按错误本身判断是否重试
+// 最终返回 APIError 时会记录尝试的次数
+func (p *RetryPolicy) Do(ctx context.Context, endpoint string, fn func(ctx context.Context) error) error {
+	attempt := 0
+	for {
+		attempt++
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if p == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !p.retryable(err) {
+			if apiErr, ok := AsAPIError(err); ok {
+				apiErr.Attempts = attempt
+			}
+			return err
+		}
+		delay := p.Backoff(attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(endpoint, attempt, err, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if apiErr, ok := AsAPIError(err); ok {
+				apiErr.Attempts = attempt
+			}
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff 第 attempt 次失败后的等待时间: 指数增长, 取其一半加上随机抖动
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + Jitter(delay-half)
+}
+
+// retryable 判断错误是否可以重试
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+var (
+	jitterLock sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Jitter 返回 [0, max) 之间的随机时长
+func Jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	jitterLock.Lock()
+	defer jitterLock.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(max)))
+}